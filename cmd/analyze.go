@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/tgagor/frameo-miniatures/internal/app"
+)
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Print quality scores of photos to tune the quality gates",
+	Long: `Scan the input directory and print the sharpness, brightness and clipping
+of every photo, measured the same way as the quality gates do (after resizing
+to the target resolution). Photos failing the configured gates are marked
+with the reason. No output files are written.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := app.Config{
+			InputDir:      inputDir,
+			Resolution:    resolution,
+			IgnoreFile:    ignoreFile,
+			Workers:       workers,
+			Filter:        filterExpr,
+			MinRating:     minRating,
+			ExcludeTags:   excludeTags,
+			IgnoreEdits:   ignoreEdits,
+			MinSharpness:  minSharpness,
+			MinBrightness: minBrightness,
+			MaxBrightness: maxBrightness,
+			MaxClipped:    maxClipped,
+			MinResolution: minResolution,
+		}
+
+		results, err := app.Analyze(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Analysis failed")
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tSIZE\tSHARPNESS\tBRIGHTNESS\tSHADOWS\tHIGHLIGHTS\tVERDICT")
+		for _, r := range results {
+			if r.Err != nil {
+				fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\terror: %v\n", r.Path, r.Err)
+				continue
+			}
+			verdict := "ok"
+			if r.Reason != "" {
+				verdict = r.Reason + ": " + r.Detail
+			}
+			s := r.Scores
+			fmt.Fprintf(w, "%s\t%dx%d\t%.1f\t%.3f\t%.1f%%\t%.1f%%\t%s\n",
+				r.Path, s.Width, s.Height, s.Sharpness, s.Exposure.Mean,
+				s.Exposure.Shadows*100, s.Exposure.Highlights*100, verdict)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+}
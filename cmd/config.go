@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// findConfigFile returns the config file to use. It searches in the following order:
+// 1. Explicit path (if provided)
+// 2. ~/.config/frameo.yaml
+func findConfigFile(explicitPath string) string {
+	if explicitPath != "" {
+		return explicitPath
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(home, ".config", "frameo.yaml")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// loadConfigFile applies settings from a YAML config file to every flag not
+// set on the command line. Keys are the long flag names, lists are applied
+// item by item, for example:
+//
+//	input: /mnt/photos
+//	format: webp
+//	filter: year >= 2019 && landscape
+func loadConfigFile(cmd *cobra.Command, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for key, value := range values {
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil {
+			// Settings of other subcommands are fine, typos are not
+			if !isKnownFlag(cmd.Root(), key) {
+				return fmt.Errorf("unknown setting %q in config file %s", key, path)
+			}
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := setFlag(flag, value); err != nil {
+			return fmt.Errorf("invalid value for %q in config file %s: %w", key, path, err)
+		}
+	}
+	return nil
+}
+
+func setFlag(flag *pflag.Flag, value interface{}) error {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if err := flag.Value.Set(fmt.Sprint(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return flag.Value.Set(fmt.Sprint(value))
+}
+
+func isKnownFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, sub := range cmd.Commands() {
+		if isKnownFlag(sub, name) {
+			return true
+		}
+	}
+	return false
+}
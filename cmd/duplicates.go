@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/tgagor/frameo-miniatures/internal/app"
+)
+
+var duplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "List clusters of duplicate and near-duplicate photos",
+	Long: `Scan the input directory, compute a perceptual hash of every photo and
+print groups of photos that look the same. The highest resolution photo of
+each group is listed first. No output files are written.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := app.Config{
+			InputDir:     inputDir,
+			IgnoreFile:   ignoreFile,
+			Workers:      workers,
+			Filter:       filterExpr,
+			MinRating:    minRating,
+			ExcludeTags:  excludeTags,
+			IgnoreEdits:  ignoreEdits,
+			DupThreshold: dupThreshold,
+		}
+
+		clusters, err := app.FindDuplicates(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Duplicate search failed")
+		}
+
+		for _, c := range clusters {
+			fmt.Printf("%s (%dx%d)\n", c.Kept.Path, c.Kept.Width, c.Kept.Height)
+			for _, d := range c.Duplicates {
+				fmt.Printf("  %s (%dx%d)\n", d.Path, d.Width, d.Height)
+			}
+		}
+		log.Info().Int("clusters", len(clusters)).Msg("Duplicate search completed")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(duplicatesCmd)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
+)
+
+// logOptions are the logging flags
+type logOptions struct {
+	level   string // Explicit level, overrides quiet and verbose
+	format  string // "console" or "json"
+	file    string // Append logs to this file instead of stderr
+	quiet   bool
+	verbose int
+}
+
+// setupLogging configures the global logger from the logging flags
+func setupLogging(opts logOptions) error {
+	level, err := logLevel(opts)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stderr
+	color := term.IsTerminal(int(os.Stderr.Fd()))
+	if opts.file != "" {
+		f, err := os.OpenFile(opts.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		// Stays open for the rest of the run
+		out, color = f, false
+	}
+
+	switch strings.ToLower(opts.format) {
+	case "", "console":
+		out = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339, NoColor: !color}
+	case "json":
+		// Durations are logged in milliseconds
+		zerolog.DurationFieldUnit = time.Millisecond
+	default:
+		return fmt.Errorf("invalid log format: %s (expected console or json)", opts.format)
+	}
+
+	zerolog.SetGlobalLevel(level)
+	log.Logger = zerolog.New(out).With().Timestamp().Logger()
+	return nil
+}
+
+// logLevel picks the level: an explicit --log-level wins, otherwise
+// --quiet shows warnings and errors and every -v adds detail
+func logLevel(opts logOptions) (zerolog.Level, error) {
+	if opts.level != "" {
+		level, err := zerolog.ParseLevel(strings.ToLower(opts.level))
+		if err != nil || level == zerolog.NoLevel {
+			return zerolog.InfoLevel, fmt.Errorf("invalid log level: %s (expected trace, debug, info, warn or error)", opts.level)
+		}
+		return level, nil
+	}
+	switch {
+	case opts.quiet:
+		return zerolog.WarnLevel, nil
+	case opts.verbose >= 2:
+		return zerolog.TraceLevel, nil
+	case opts.verbose == 1:
+		return zerolog.DebugLevel, nil
+	}
+	return zerolog.InfoLevel, nil
+}
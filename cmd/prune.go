@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/tgagor/frameo-miniatures/internal/app"
+	"github.com/tgagor/frameo-miniatures/internal/trash"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove orphaned files from the output without processing",
+	Long: `Walk the input directory and remove the outputs whose source is gone,
+ignored or filtered out, the same way --prune does after processing. Only
+outputs recorded in the output's manifest are touched, and they are moved to
+the trash unless --trash-retention is 0. Photos rejected as duplicates or by
+the quality gates are only known while processing, so their outputs are left
+alone here.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := app.Config{
+			InputDir:       inputDir,
+			OutputDir:      outputDir,
+			Format:         format,
+			Workers:        workers,
+			Force:          force,
+			DryRun:         dryRun,
+			IgnoreFile:     ignoreFile,
+			Filter:         filterExpr,
+			MinRating:      minRating,
+			ExcludeTags:    excludeTags,
+			PruneThreshold: pruneLimit,
+			TrashRetention: trashKeep,
+		}
+
+		if err := app.Prune(cfg); err != nil {
+			log.Fatal().Err(err).Msg("Pruning failed")
+		}
+	},
+}
+
+func init() {
+	pruneCmd.Flags().StringVarP(&outputDir, "output", "o", "./output", "Destination directory path")
+	pruneCmd.Flags().StringVarP(&format, "format", "f", "webp", "Output format (webp, jpg, auto)")
+	pruneCmd.Flags().BoolVar(&force, "force", false, "Prune even if more than --prune-threshold of the output would be removed")
+	pruneCmd.Flags().Float64Var(&pruneLimit, "prune-threshold", 50, "Abort pruning if more than this percentage of the output would be removed (0 = off)")
+	pruneCmd.Flags().DurationVar(&trashKeep, "trash-retention", trash.DefaultRetention, "Keep pruned files in the output's .trash this long (0 = delete right away)")
+	pruneCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Simulate without removing files")
+	rootCmd.AddCommand(pruneCmd)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/tgagor/frameo-miniatures/internal/app"
+)
+
+var listTrash bool
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [batch]",
+	Short: "Restore pruned files from the output's trash",
+	Long: `Pruning moves orphaned files into a timestamped batch in the .trash
+directory of the output instead of deleting them. Restore moves the files of
+a batch back, the latest one unless a batch is named. Files written again
+since they were pruned are kept and their trashed copy stays in the trash.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := app.Config{OutputDir: outputDir}
+
+		if listTrash {
+			batches, err := app.ListTrash(cfg)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to read trash")
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "BATCH\tPRUNED\tFILES")
+			for _, b := range batches {
+				fmt.Fprintf(w, "%s\t%s\t%d\n", b.Name, b.Time.Format("2006-01-02 15:04:05"), b.Files)
+			}
+			w.Flush()
+			return
+		}
+
+		var name string
+		if len(args) > 0 {
+			name = args[0]
+		}
+		restored, err := app.Restore(cfg, name)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Restore failed")
+		}
+		log.Info().Int("restored", restored).Msg("Restore completed")
+	},
+}
+
+func init() {
+	restoreCmd.Flags().StringVarP(&outputDir, "output", "o", "./output", "Destination directory path")
+	restoreCmd.Flags().BoolVar(&listTrash, "list", false, "List the batches in the trash instead of restoring")
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -5,10 +5,15 @@ import (
 	"os"
 	"time"
 
-	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/tgagor/frameo-miniatures/internal/app"
+	"github.com/tgagor/frameo-miniatures/internal/caption"
+	"github.com/tgagor/frameo-miniatures/internal/dedup"
+	"github.com/tgagor/frameo-miniatures/internal/ordering"
+	"github.com/tgagor/frameo-miniatures/internal/processor"
+	"github.com/tgagor/frameo-miniatures/internal/selection"
+	"github.com/tgagor/frameo-miniatures/internal/trash"
 )
 
 var (
@@ -22,6 +27,60 @@ var (
 	dryRun       bool
 	ignoreFile   string
 	skipExisting bool
+	lossless     bool
+	nearLossless int
+	exact        bool
+	autoColors   int
+	duplicates   string
+	dupThreshold int
+	reportFile   string
+	ignoreEdits  bool
+	cropMode     string
+	colorProfile string
+	toneMap      string
+	enhanceSteps []string
+	resample     string
+	linearLight  bool
+	fastDecode   bool
+
+	decodeWorkers int
+	encodeWorkers int
+	maxMemory     string
+	order         string
+	orderWindow   int
+	metricsAddr   string
+	force         bool
+	pruneLimit    float64
+	trashKeep     time.Duration
+	pprofEnabled  bool
+	burstWindow   time.Duration
+	burstDist     int
+	burstKeep     string
+
+	minSharpness  float64
+	minBrightness float64
+	maxBrightness float64
+	maxClipped    float64
+	minResolution string
+
+	filterExpr  string
+	minRating   int
+	excludeTags []string
+	configFile  string
+
+	captionText       string
+	captionPosition   string
+	captionSize       float64
+	captionOpacity    float64
+	captionShadow     bool
+	captionDateFormat string
+
+	selectMode  string
+	selectCount int
+	selectSeed  int64
+	selectDays  int
+
+	logging logOptions
 )
 
 var rootCmd = &cobra.Command{
@@ -30,9 +89,21 @@ var rootCmd = &cobra.Command{
 	Long: `Frameo Miniatures is a CLI tool to resize, compress, and organize photos
 for Frameo digital photo frames. It supports resizing with aspect ratio preservation,
 WebP conversion, and metadata copying.`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		// Setup logging
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// The config file may set the logging flags too
+		path := findConfigFile(configFile)
+		if path != "" {
+			if err := loadConfigFile(cmd, path); err != nil {
+				return err
+			}
+		}
+		if err := setupLogging(logging); err != nil {
+			return err
+		}
+		if path != "" {
+			log.Info().Str("file", path).Msg("Loaded config file")
+		}
+		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Info().
@@ -44,6 +115,9 @@ WebP conversion, and metadata copying.`,
 			Int("workers", workers).
 			Bool("prune", prune).
 			Bool("dry_run", dryRun).
+			Str("duplicates", duplicates).
+			Str("filter", filterExpr).
+			Str("select", selectMode).
 			Msg("Starting Frameo Miniatures")
 
 		cfg := app.Config{
@@ -54,9 +128,64 @@ WebP conversion, and metadata copying.`,
 			Quality:      quality,
 			Workers:      workers,
 			Prune:        prune,
+			Force:        force,
 			DryRun:       dryRun,
+			Quiet:        logging.quiet,
 			IgnoreFile:   ignoreFile,
 			SkipExisting: skipExisting,
+			Lossless:     lossless,
+			NearLossless: nearLossless,
+			Exact:        exact,
+			AutoColors:   autoColors,
+			Duplicates:   duplicates,
+			DupThreshold: dupThreshold,
+			BurstWindow:  burstWindow,
+			BurstDist:    burstDist,
+			BurstKeep:    burstKeep,
+			ReportFile:   reportFile,
+			IgnoreEdits:  ignoreEdits,
+			Crop:         cropMode,
+			ColorProfile: colorProfile,
+			ToneMap:      toneMap,
+			Enhance:      enhanceSteps,
+			Resample:     resample,
+			LinearLight:  linearLight,
+			FastDecode:   fastDecode,
+
+			DecodeWorkers: decodeWorkers,
+			EncodeWorkers: encodeWorkers,
+			MaxMemory:     maxMemory,
+
+			Order:       order,
+			OrderWindow: orderWindow,
+
+			PruneThreshold: pruneLimit,
+			TrashRetention: trashKeep,
+
+			MetricsAddr: metricsAddr,
+			Pprof:       pprofEnabled,
+
+			MinSharpness:  minSharpness,
+			MinBrightness: minBrightness,
+			MaxBrightness: maxBrightness,
+			MaxClipped:    maxClipped,
+			MinResolution: minResolution,
+
+			Filter:      filterExpr,
+			MinRating:   minRating,
+			ExcludeTags: excludeTags,
+
+			Caption:           captionText,
+			CaptionPosition:   captionPosition,
+			CaptionSize:       captionSize,
+			CaptionOpacity:    captionOpacity,
+			CaptionShadow:     captionShadow,
+			CaptionDateFormat: captionDateFormat,
+
+			SelectMode:  selectMode,
+			SelectCount: selectCount,
+			SelectSeed:  selectSeed,
+			SelectDays:  selectDays,
 		}
 
 		if err := app.Run(cfg); err != nil {
@@ -75,14 +204,66 @@ func Execute(appName string, version string) {
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&inputDir, "input", "i", ".", "Source directory path")
+	rootCmd.PersistentFlags().StringVarP(&inputDir, "input", "i", ".", "Source directory path")
 	rootCmd.Flags().StringVarP(&outputDir, "output", "o", "./output", "Destination directory path")
-	rootCmd.Flags().StringVarP(&resolution, "resolution", "r", "1280x800", "Target frame resolution (bounding box)")
-	rootCmd.Flags().StringVarP(&format, "format", "f", "webp", "Output format (webp, jpg)")
+	rootCmd.PersistentFlags().StringVarP(&resolution, "resolution", "r", "1280x800", "Target frame resolution (bounding box)")
+	rootCmd.Flags().StringVarP(&format, "format", "f", "webp", "Output format (webp, jpg, auto); JPEG is always baseline 4:2:0, WebP uses the default method and preset")
 	rootCmd.Flags().IntVarP(&quality, "quality", "q", 75, "Compression quality (0-100)")
-	rootCmd.Flags().IntVarP(&workers, "workers", "j", 0, "Number of concurrent workers (0 = auto)")
+	rootCmd.PersistentFlags().IntVarP(&workers, "workers", "j", 0, "Number of concurrent workers (0 = auto)")
+	rootCmd.Flags().IntVar(&decodeWorkers, "decode-workers", 0, "Number of concurrent decoders (0 = same as --workers)")
+	rootCmd.Flags().IntVar(&encodeWorkers, "encode-workers", 0, "Number of concurrent encoders (0 = same as --workers)")
+	rootCmd.Flags().StringVar(&maxMemory, "max-memory", "", "Memory budget for photos being processed, e.g. 2GB (empty = unlimited)")
+	rootCmd.Flags().StringVar(&order, "order", "", "Processing order: newest, taken, smallest or round-robin (empty = as found)")
+	rootCmd.Flags().IntVar(&orderWindow, "order-window", ordering.DefaultWindow, "Number of files looked at ahead when ordering")
+	rootCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9090")
+	rootCmd.Flags().BoolVar(&pprofEnabled, "pprof", false, "Serve the Go profiler on /debug/pprof/ at --metrics-addr")
 	rootCmd.Flags().BoolVar(&prune, "prune", false, "Remove orphaned files from output (no source or ignored)")
+	rootCmd.Flags().BoolVar(&force, "force", false, "Prune even if more than --prune-threshold of the output would be removed")
+	rootCmd.Flags().Float64Var(&pruneLimit, "prune-threshold", 50, "Abort pruning if more than this percentage of the output would be removed (0 = off)")
+	rootCmd.Flags().DurationVar(&trashKeep, "trash-retention", trash.DefaultRetention, "Keep pruned files in the output's .trash this long (0 = delete right away)")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Simulate without writing files")
-	rootCmd.Flags().StringVar(&ignoreFile, "ignore-file", "", "Path to .frameoignore file")
+	rootCmd.PersistentFlags().StringVar(&ignoreFile, "ignore-file", "", "Path to .frameoignore file")
 	rootCmd.Flags().BoolVar(&skipExisting, "skip-existing", false, "Skip processing if output file already exists")
+	rootCmd.Flags().BoolVar(&lossless, "lossless", false, "Use lossless WebP encoding")
+	rootCmd.Flags().IntVar(&nearLossless, "near-lossless", 100, "Near-lossless WebP preprocessing level (0-100, 100 = off)")
+	rootCmd.Flags().BoolVar(&exact, "exact", false, "Preserve RGB values under transparent pixels (WebP)")
+	rootCmd.Flags().IntVar(&autoColors, "auto-max-colors", processor.DefaultAutoMaxColors, "Colour count up to which the auto format encodes losslessly")
+	rootCmd.Flags().StringVar(&duplicates, "duplicates", "", "Duplicate photo policy (report, skip, keep-highest)")
+	rootCmd.PersistentFlags().IntVar(&dupThreshold, "duplicate-threshold", dedup.DefaultThreshold, "Maximum perceptual hash distance for near duplicates (0 = exact)")
+	rootCmd.Flags().DurationVar(&burstWindow, "burst-window", 0, "Thin out similar shots taken within this time of each other, e.g. 3s (0 = off)")
+	rootCmd.Flags().IntVar(&burstDist, "burst-threshold", 12, "Maximum perceptual hash distance for shots of the same burst")
+	rootCmd.Flags().StringVar(&burstKeep, "burst-keep", "sharpest", "Which shot of a burst to keep (sharpest, exposure, resolution)")
+	rootCmd.Flags().StringVar(&cropMode, "crop", "none", "Fill the frame by cropping (none, center, faces)")
+	rootCmd.Flags().StringVar(&colorProfile, "color-profile", "convert", "Handling of embedded colour profiles (convert to sRGB, embed in output, ignore)")
+	rootCmd.Flags().StringVar(&toneMap, "tonemap", "reinhard", "Tone mapping of HDR photos (reinhard, hable, gainmap, clip)")
+	rootCmd.Flags().StringVar(&resample, "resample", "catmullrom", "Resampling filter (lanczos, catmullrom, box, linear, nearest)")
+	rootCmd.Flags().BoolVar(&linearLight, "linear-light", false, "Resize in linear light, keeping fine detail from darkening")
+	rootCmd.Flags().BoolVar(&fastDecode, "fast-decode", false, "Use embedded previews or shrink huge photos right after decoding")
+	rootCmd.Flags().StringSliceVar(&enhanceSteps, "enhance", nil, "Enhancement steps applied after resizing, in order (levels, contrast, gamma, saturation, sharpen; e.g. sharpen=0.8)")
+	rootCmd.Flags().StringVar(&captionText, "caption", "", "Caption template drawn on photos, e.g. '{date} · {folder}' (empty = off)")
+	rootCmd.Flags().StringVar(&captionPosition, "caption-position", caption.DefaultPosition, "Caption position (top-left, top-center, top-right, bottom-left, bottom-center, bottom-right)")
+	rootCmd.Flags().Float64Var(&captionSize, "caption-size", caption.DefaultSize, "Caption text height as a fraction of the image height")
+	rootCmd.Flags().Float64Var(&captionOpacity, "caption-opacity", caption.DefaultOpacity, "Caption opacity, 0-1")
+	rootCmd.Flags().BoolVar(&captionShadow, "caption-shadow", true, "Draw a shadow behind the caption")
+	rootCmd.Flags().StringVar(&captionDateFormat, "caption-date-format", caption.DefaultDateFormat, "Go layout used by {date}")
+	rootCmd.Flags().StringVar(&selectMode, "select", "", "Process only a subset of photos (random, per-year, per-folder, on-this-day, recent)")
+	rootCmd.Flags().IntVar(&selectCount, "select-count", 0, "Number of photos to select (per group for per-year and per-folder)")
+	rootCmd.Flags().Int64Var(&selectSeed, "select-seed", 0, "Seed for random selection (0 = different on every run)")
+	rootCmd.Flags().IntVar(&selectDays, "select-days", selection.DefaultDays, "Days around today's date used by on-this-day")
+	rootCmd.Flags().StringVar(&reportFile, "report", "", "Write a JSON report of the run to this file")
+	rootCmd.PersistentFlags().Float64Var(&minSharpness, "min-sharpness", 0, "Skip photos with a lower sharpness score (0 = off)")
+	rootCmd.PersistentFlags().Float64Var(&minBrightness, "min-brightness", 0, "Skip photos with a lower mean brightness, 0-1 (0 = off)")
+	rootCmd.PersistentFlags().Float64Var(&maxBrightness, "max-brightness", 0, "Skip photos with a higher mean brightness, 0-1 (0 = off)")
+	rootCmd.PersistentFlags().Float64Var(&maxClipped, "max-clipped", 0, "Skip photos with a larger fraction of clipped pixels, 0-1 (0 = off)")
+	rootCmd.PersistentFlags().StringVar(&filterExpr, "filter", "", "Only process files matching this expression, e.g. 'year >= 2019 && landscape'")
+	rootCmd.PersistentFlags().IntVar(&minRating, "min-rating", 0, "Only process photos rated at least this many stars in XMP (0 = off)")
+	rootCmd.PersistentFlags().StringSliceVar(&excludeTags, "exclude-tag", nil, "Skip photos with this XMP tag (repeatable)")
+	rootCmd.PersistentFlags().BoolVar(&ignoreEdits, "ignore-edits", false, "Ignore crops and rotations stored in XMP sidecars")
+	rootCmd.PersistentFlags().StringVar(&logging.level, "log-level", "", "Log level: trace, debug, info, warn or error (default info)")
+	rootCmd.PersistentFlags().StringVar(&logging.format, "log-format", "console", "Log format: console or json")
+	rootCmd.PersistentFlags().StringVar(&logging.file, "log-file", "", "Append logs to this file instead of stderr")
+	rootCmd.PersistentFlags().BoolVar(&logging.quiet, "quiet", false, "Only log warnings and errors, no progress bar")
+	rootCmd.PersistentFlags().CountVarP(&logging.verbose, "verbose", "v", "Log more detail (-v debug, -vv trace)")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Path to YAML config file (default ~/.config/frameo.yaml)")
+	rootCmd.PersistentFlags().StringVar(&minResolution, "min-resolution", "", "Skip photos smaller than WxH (orientation independent)")
 }
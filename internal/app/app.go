@@ -1,22 +1,43 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
-	"github.com/schollz/progressbar/v3"
+	"github.com/tgagor/frameo-miniatures/internal/caption"
+	"github.com/tgagor/frameo-miniatures/internal/dedup"
 	"github.com/tgagor/frameo-miniatures/internal/discovery"
+	"github.com/tgagor/frameo-miniatures/internal/enhance"
+	"github.com/tgagor/frameo-miniatures/internal/filter"
+	"github.com/tgagor/frameo-miniatures/internal/geo"
+	"github.com/tgagor/frameo-miniatures/internal/manifest"
+	"github.com/tgagor/frameo-miniatures/internal/metrics"
+	"github.com/tgagor/frameo-miniatures/internal/ordering"
+	"github.com/tgagor/frameo-miniatures/internal/phash"
+	"github.com/tgagor/frameo-miniatures/internal/pipeline"
 	"github.com/tgagor/frameo-miniatures/internal/processor"
+	"github.com/tgagor/frameo-miniatures/internal/progress"
 	"github.com/tgagor/frameo-miniatures/internal/pruner"
+	"github.com/tgagor/frameo-miniatures/internal/quality"
+	"github.com/tgagor/frameo-miniatures/internal/report"
+	"github.com/tgagor/frameo-miniatures/internal/selection"
+	"github.com/tgagor/frameo-miniatures/internal/tonemap"
+	"github.com/tgagor/frameo-miniatures/internal/trash"
 )
 
+// progressInterval is how often progress is logged when stderr isn't a
+// terminal
+const progressInterval = 30 * time.Second
+
 type Config struct {
 	InputDir     string
 	OutputDir    string
@@ -25,9 +46,76 @@ type Config struct {
 	Quality      int
 	Workers      int
 	Prune        bool
+	Force        bool // Prune even beyond PruneThreshold
 	DryRun       bool
+	Quiet        bool // No progress bar or progress log lines
 	IgnoreFile   string
 	SkipExisting bool
+	Lossless     bool
+	NearLossless int
+	Exact        bool
+	AutoColors   int
+	Duplicates   string // Duplicate policy: "", "report", "skip" or "keep-highest"
+	DupThreshold int
+	BurstWindow  time.Duration // 0 disables burst thinning
+	BurstDist    int
+	BurstKeep    string
+	ReportFile   string
+	IgnoreEdits  bool     // Don't apply crops and rotations from XMP sidecars
+	Crop         string   // Framing: "none", "center" or "faces"
+	ColorProfile string   // "convert", "embed" or "ignore"
+	ToneMap      string   // HDR tone mapping: "reinhard", "hable", "gainmap" or "clip"
+	Enhance      []string // Enhancement steps after resizing, e.g. "levels", "sharpen=0.8"
+	Resample     string   // Resampling filter, see processor.Filters
+	LinearLight  bool     // Resize in linear light
+	FastDecode   bool     // Use embedded previews or shrink huge photos early
+
+	DecodeWorkers int    // Concurrent decoders, 0 = Workers
+	EncodeWorkers int    // Concurrent encoders, 0 = Workers
+	MaxMemory     string // Budget for images in flight, e.g. "2GB", empty = unlimited
+
+	PruneThreshold float64       // Abort pruning above this percentage of the output, 0 = off
+	TrashRetention time.Duration // Keep pruned files this long, 0 deletes them right away
+
+	MetricsAddr string // Serve Prometheus metrics on this address, empty = off
+	Pprof       bool   // Serve the Go profiler next to the metrics
+
+	Order       string // Processing order, see the ordering package, empty = walk order
+	OrderWindow int    // Files looked at ahead when ordering, 0 = default
+
+	// Quality gates, zero values disable them
+	MinSharpness  float64
+	MinBrightness float64
+	MaxBrightness float64
+	MaxClipped    float64
+	MinResolution string // WxH, compared independent of orientation
+
+	Filter      string // Filter expression, see the filter package
+	MinRating   int    // Minimum XMP star rating, 0 = off
+	ExcludeTags []string
+
+	// Caption overlay, empty template disables it
+	Caption           string
+	CaptionPosition   string
+	CaptionSize       float64
+	CaptionOpacity    float64
+	CaptionShadow     bool
+	CaptionDateFormat string
+
+	// Selection of a subset of the library, see the selection package
+	SelectMode  string
+	SelectCount int
+	SelectSeed  int64
+	SelectDays  int
+}
+
+// AnalysisResult holds the quality scores of a single file
+type AnalysisResult struct {
+	Path   string
+	Scores quality.Scores
+	Reason string // Failed gate, empty when the file passes
+	Detail string
+	Err    error
 }
 
 func Run(cfg Config) error {
@@ -37,79 +125,761 @@ func Run(cfg Config) error {
 		return err
 	}
 
+	if err := validateFormat(cfg.Format); err != nil {
+		return err
+	}
+
+	dupPolicy, err := dedup.ParsePolicy(cfg.Duplicates)
+	if err != nil {
+		return err
+	}
+
+	switch cfg.BurstKeep {
+	case "", "sharpest", "exposure", "resolution":
+	default:
+		return fmt.Errorf("invalid burst selection: %s (expected sharpest, exposure or resolution)", cfg.BurstKeep)
+	}
+
+	if err := validateCrop(cfg.Crop); err != nil {
+		return err
+	}
+
+	switch cfg.ColorProfile {
+	case "", "convert", "embed", "ignore":
+	default:
+		return fmt.Errorf("invalid colour profile handling: %s (expected convert, embed or ignore)", cfg.ColorProfile)
+	}
+
+	toneMap, err := tonemap.Parse(cfg.ToneMap)
+	if err != nil {
+		return err
+	}
+
+	steps, err := enhance.Parse(cfg.Enhance)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Resample != "" {
+		if err := processor.ValidateFilter(cfg.Resample); err != nil {
+			return err
+		}
+	}
+
+	gates, err := buildGates(cfg)
+	if err != nil {
+		return err
+	}
+
 	// Setup workers
 	if cfg.Workers <= 0 {
 		cfg.Workers = runtime.NumCPU()
 	}
+	if cfg.DecodeWorkers <= 0 {
+		cfg.DecodeWorkers = cfg.Workers
+	}
+	if cfg.EncodeWorkers <= 0 {
+		cfg.EncodeWorkers = cfg.Workers
+	}
+	maxMemory, err := pipeline.ParseSize(cfg.MaxMemory)
+	if err != nil {
+		return err
+	}
+	if cfg.Pprof && cfg.MetricsAddr == "" {
+		return fmt.Errorf("pprof is served on the metrics address, set one too")
+	}
+
+	orderMode, err := ordering.ParseMode(cfg.Order)
+	if err != nil {
+		return err
+	}
+
+	selectMode, err := selection.ParseMode(cfg.SelectMode)
+	if err != nil {
+		return err
+	}
+	selectOpts := selection.Options{
+		Mode:    selectMode,
+		Count:   cfg.SelectCount,
+		Seed:    cfg.SelectSeed,
+		Days:    cfg.SelectDays,
+		Workers: cfg.Workers,
+	}
+	if err := selectOpts.Validate(); err != nil {
+		return err
+	}
 
 	// Setup processor
 	proc := processor.NewProcessor(width, height, cfg.Quality, cfg.Format, cfg.SkipExisting)
+	proc.Encoder = processor.EncoderOptions{
+		Lossless:      cfg.Lossless,
+		NearLossless:  cfg.NearLossless,
+		Exact:         cfg.Exact,
+		AutoMaxColors: cfg.AutoColors,
+	}
+	proc.Gates = gates
+	proc.ApplyEdits = !cfg.IgnoreEdits
+	proc.Crop = cfg.Crop
+	if cfg.ColorProfile != "" {
+		proc.ColorProfile = cfg.ColorProfile
+	}
+	proc.ToneMap = toneMap
+	proc.Enhance = steps
+	if cfg.Resample != "" {
+		proc.Filter = cfg.Resample
+	}
+	proc.LinearLight = cfg.LinearLight
+	proc.FastDecode = cfg.FastDecode
+	if cfg.Caption != "" {
+		proc.Caption, err = caption.New(caption.Options{
+			Template:   cfg.Caption,
+			Position:   cfg.CaptionPosition,
+			Size:       cfg.CaptionSize,
+			Opacity:    cfg.CaptionOpacity,
+			Shadow:     cfg.CaptionShadow,
+			DateFormat: cfg.CaptionDateFormat,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if dupPolicy != dedup.PolicyOff {
+		proc.Dedup = dedup.NewIndex(dupPolicy, cfg.DupThreshold)
+	}
+	if cfg.BurstWindow > 0 {
+		proc.Burst = dedup.NewIndex(dedup.PolicyKeepBest, cfg.BurstDist)
+		proc.Burst.Window = cfg.BurstWindow
+		proc.BurstKeep = cfg.BurstKeep
+	}
 
-	// Setup ignore matcher
-	matcher, err := discovery.NewIgnoreMatcher(cfg.IgnoreFile, cfg.InputDir)
+	// The manifest tells changed sources apart on incremental runs
+	// Without it the outputs of earlier runs are unknown and none are pruned
+	var manifestErr error
+	if !cfg.DryRun {
+		proc.Manifest, manifestErr = manifest.Load(cfg.OutputDir)
+		if manifestErr != nil {
+			log.Error().Err(manifestErr).Msg("Failed to load manifest, pruning will be skipped")
+		}
+	}
+
+	rep := report.New()
+	if cfg.ReportFile != "" {
+		proc.FacesFound = rep.AddFaces
+	}
+
+	// Metrics are served for as long as the process runs
+	var stats *metrics.Metrics
+	if cfg.MetricsAddr != "" {
+		stats = metrics.New()
+		if err := stats.Serve(cfg.MetricsAddr, cfg.Pprof); err != nil {
+			return err
+		}
+		proc.StepTimed = stats.ObserveStep
+	}
+
+	// Setup ignore matcher and filters
+	matcher := loadMatcher(cfg)
+	filters, err := buildFilters(cfg)
 	if err != nil {
-		log.Warn().Err(err).Msg("Failed to load .frameoignore")
-		matcher = &discovery.IgnoreMatcher{} // Empty matcher
+		return err
+	}
+	// Faces are counted on photos decoded for processing anyway, rather than
+	// decoding every photo twice while discovering them
+	proc.FaceFilter = deferFaceFilters(cfg.InputDir, filters)
+
+	// Selection needs the whole library up front, otherwise files are streamed
+	var selected []discovery.File
+	if selectMode != selection.ModeAll {
+		var set selection.Set
+		selected, set = selectFiles(cfg.InputDir, matcher, filters, selectOpts)
+		// The pruner must keep exactly the selected files
+		filters = append(filters, set)
 	}
 
 	// Channels
 	files := make(chan discovery.File, 1000)
 
-	// Progress Bar (Indeterminate initially)
-	bar := progressbar.NewOptions64(-1,
-		progressbar.OptionSetDescription("Processing"),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionShowBytes(false),
-		progressbar.OptionSetWidth(10),
-		progressbar.OptionThrottle(65*time.Millisecond),
-		progressbar.OptionShowCount(),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSpinnerType(14),
-		progressbar.OptionFullWidth(),
-	)
+	// Progress, the total is counted alongside processing
+	tracker := progress.NewTracker()
+	display := progress.Hidden(tracker)
+	if !cfg.Quiet {
+		display = progress.Start(tracker, progressInterval)
+	}
 
 	// Start Producer
-	go discovery.WalkFiles(cfg.InputDir, files, matcher)
+	if selected != nil {
+		for _, file := range selected {
+			tracker.AddTotal(1, fileSize(file.Path))
+		}
+		tracker.Counted()
+		go func() {
+			defer close(files)
+			for _, file := range selected {
+				files <- file
+			}
+		}()
+	} else {
+		go func() {
+			discovery.CountFiles(cfg.InputDir, matcher, func(size int64) {
+				tracker.AddTotal(1, size)
+			})
+			tracker.Counted()
+			display.Refresh()
+		}()
+		walkFilters := filters
+		if len(filters) > 0 {
+			walkFilters = []discovery.Filter{uncounted{filters: filters, tracker: tracker}}
+		}
+		go discovery.WalkFiles(cfg.InputDir, files, matcher, walkFilters...)
+	}
+
+	// Ordering looks ahead a bounded number of files, without it files go
+	// to the workers as soon as they are found
+	queue := files
+	if orderMode != ordering.ModeNone {
+		ordered := make(chan discovery.File)
+		go ordering.Stream(files, ordered, orderMode, cfg.OrderWindow)
+		queue = ordered
+	}
+
+	// Start the stages, the memory budget keeps large photos waiting
+	// instead of all being decoded at once
+	pipe := stages{
+		decoders:     cfg.DecodeWorkers,
+		transformers: cfg.Workers,
+		encoders:     cfg.EncodeWorkers,
+		metrics:      stats,
+	}
+	stats.QueueDepth("files", func() int { return len(files) })
+	if maxMemory > 0 {
+		pipe.budget = pipeline.NewBudget(maxMemory)
+	}
+	// The pruner keeps the outputs of every file seen here, which saves
+	// it a second walk of the input
+	expected := pruner.NewExpected(cfg.Format)
+	procs := newProcessors(proc, cfg.InputDir)
+	pipe.process(cfg, procs, queue, func(t task, err error) {
+		// Only files written or confirmed up to date have the current
+		// settings. When a rebuild fails, the previous output is kept until
+		// one succeeds. A dry run rebuilds nothing.
+		var params string
+		if err == nil && t.proc != nil && !cfg.DryRun {
+			params = t.proc.Params()
+		}
+		expected.Add(t.file, params)
+		if !cfg.DryRun {
+			recordResult(rep, t, err)
+			if err == nil && cfg.ReportFile != "" {
+				recordLocation(rep, &t.file)
+			}
+		}
+		tracker.Done(outcome(t, err), fileSize(t.file.Path))
+		stats.FileDone(resultLabels(t, err))
+		display.Refresh()
+	})
+	display.Finish()
+
+	// Rejected photos must not come back, neither in this run nor through pruning
+	excluded := make(map[string]bool)
+	for _, path := range rep.SkippedPaths() {
+		excluded[path] = true
+	}
+	collectRejected(rep, proc.Dedup, "duplicate", excluded)
+	collectRejected(rep, proc.Burst, "burst", excluded)
+
+	// Outputs written before a better copy came along go the way pruned
+	// files do
+	if replaced := replacedOutputs(cfg, proc); len(replaced) > 0 {
+		p := newPruner(cfg, matcher)
+		p.Exclude = excluded
+		p.Expected = expected
+		p.Manifest = proc.Manifest
+		if err := preparePruner(cfg, p); err != nil {
+			log.Error().Err(err).Msg("Failed to remove replaced duplicates")
+		} else {
+			removed := p.Remove(replaced)
+			log.Info().Int("removed", removed).Msg("Removed outputs of replaced duplicates")
+		}
+	}
+
+	if proc.Manifest != nil {
+		if err := proc.Manifest.Save(); err != nil {
+			log.Error().Err(err).Msg("Failed to save manifest")
+		}
+	}
+
+	rep.Log()
+	if cfg.ReportFile != "" {
+		if err := rep.WriteFile(cfg.ReportFile); err != nil {
+			log.Error().Err(err).Str("file", cfg.ReportFile).Msg("Failed to write report")
+		}
+	}
+
+	if cfg.Prune && manifestErr == nil {
+		p := newPruner(cfg, matcher)
+		p.Exclude = excluded
+		p.Filters = filters
+		p.Expected = expected
+		p.Manifest = proc.Manifest
+		if err := prune(cfg, p, stats); err != nil {
+			log.Error().Err(err).Msg("Pruning failed")
+		}
+	}
+
+	return nil
+}
+
+// Prune removes orphaned files from the output without processing
+// anything, walking the input on its own to find them
+func Prune(cfg Config) error {
+	if err := validateFormat(cfg.Format); err != nil {
+		return err
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	filters, err := buildFilters(cfg)
+	if err != nil {
+		return err
+	}
+
+	p := newPruner(cfg, loadMatcher(cfg))
+	p.Filters = filters
+	return prune(cfg, p, nil)
+}
+
+// newPruner creates a pruner for the output with the configured safety
+// threshold
+func newPruner(cfg Config, matcher *discovery.IgnoreMatcher) *pruner.Pruner {
+	p := pruner.NewPruner(cfg.InputDir, cfg.OutputDir, cfg.Format, matcher, cfg.DryRun)
+	p.MaxPercent = cfg.PruneThreshold
+	p.Force = cfg.Force
+	p.Workers = cfg.Workers
+	return p
+}
+
+// prune runs the pruner, loading the manifest unless the processor left
+// one, and empties old trash afterwards
+func prune(cfg Config, p *pruner.Pruner, stats *metrics.Metrics) error {
+	log.Info().Msg("Starting pruning phase...")
+	if err := preparePruner(cfg, p); err != nil {
+		return err
+	}
+
+	removedCount, err := p.Prune()
+	if err != nil {
+		return err
+	}
+	log.Info().Int("removed", removedCount).Msg("Pruning completed")
+	if !cfg.DryRun {
+		stats.AddPruned(removedCount)
+		if err := p.Manifest.Save(); err != nil {
+			log.Error().Err(err).Msg("Failed to save manifest")
+		}
+	}
+	if p.Trash != nil {
+		if _, err := trash.Purge(cfg.OutputDir, cfg.TrashRetention, time.Now()); err != nil {
+			log.Warn().Err(err).Msg("Failed to empty old trash")
+		}
+	}
+	return nil
+}
+
+// preparePruner loads the manifest unless the processor left one and the
+// protected files, and sets up the trash
+func preparePruner(cfg Config, p *pruner.Pruner) error {
+	// Only outputs recorded in the manifest are pruned, nothing else in the
+	// output belongs to this tool
+	var err error
+	if p.Manifest == nil {
+		p.Manifest, err = manifest.Load(cfg.OutputDir)
+		if err != nil {
+			return err
+		}
+	}
+	p.Protect, err = discovery.LoadIgnoreFile(filepath.Join(cfg.OutputDir, pruner.ProtectFile))
+	if err != nil {
+		return err
+	}
+	if cfg.TrashRetention > 0 && !cfg.DryRun {
+		p.Trash = trash.New(cfg.OutputDir, time.Now())
+	}
+	return nil
+}
+
+// ListTrash returns the batches of pruned files in the output's trash
+func ListTrash(cfg Config) ([]trash.Batch, error) {
+	return trash.Batches(cfg.OutputDir)
+}
+
+// Restore moves pruned files of a trash batch back into the output, the
+// latest batch when name is empty, and returns how many were restored
+func Restore(cfg Config, name string) (int, error) {
+	m, err := manifest.Load(cfg.OutputDir)
+	if err != nil {
+		return 0, err
+	}
+	restored, err := trash.Restore(cfg.OutputDir, name)
+
+	// Restored files belong to the tool again. Their source is unknown, so
+	// they are rebuilt once it is back.
+	for _, relPath := range restored {
+		m.Put(filepath.Join(cfg.OutputDir, relPath), manifest.Source{})
+	}
+	if saveErr := m.Save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return len(restored), err
+}
+
+// FindDuplicates hashes every discovered file and returns clusters of
+// duplicates, without writing any output
+func FindDuplicates(cfg Config) ([]dedup.Cluster, error) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+
+	matcher := loadMatcher(cfg)
+	filters, err := buildFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep-highest marks the largest file of each cluster as the original.
+	// Entries carry no output path, so nothing is ever removed.
+	index := dedup.NewIndex(dedup.PolicyKeepHighest, cfg.DupThreshold)
+	proc := processor.NewProcessor(0, 0, 0, "", false)
+	proc.ApplyEdits = !cfg.IgnoreEdits
+
+	files := make(chan discovery.File, 1000)
+	go discovery.WalkFiles(cfg.InputDir, files, matcher, filters...)
 
-	// Start Consumers
 	var wg sync.WaitGroup
 	for i := 0; i < cfg.Workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for file := range files {
-				destDir := filepath.Join(cfg.OutputDir, filepath.Dir(file.RelativePath))
-
-				if cfg.DryRun {
-					// Simulate
-					// time.Sleep(10 * time.Millisecond)
-				} else {
-					if err := proc.ProcessFile(file.Path, destDir); err != nil {
-						log.Error().Err(err).Str("file", file.Path).Msg("Failed to process file")
-					}
+				img, err := proc.LoadImage(file.Path)
+				if err != nil {
+					log.Error().Err(err).Str("file", file.Path).Msg("Failed to load file")
+					continue
 				}
-				bar.Add(1)
+				bounds := img.Bounds()
+				index.Add(dedup.Entry{
+					Path:   file.Path,
+					Hash:   phash.DHash(img),
+					Width:  bounds.Dx(),
+					Height: bounds.Dy(),
+				})
 			}
 		}()
 	}
+	wg.Wait()
+
+	return index.Clusters(), nil
+}
+
+// Analyze measures the quality of every discovered file and checks it
+// against the configured gates, without writing any output
+func Analyze(cfg Config) ([]AnalysisResult, error) {
+	width, height, err := parseResolution(cfg.Resolution)
+	if err != nil {
+		return nil, err
+	}
+	gates, err := buildGates(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+
+	matcher := loadMatcher(cfg)
+	filters, err := buildFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	proc := processor.NewProcessor(width, height, 0, "", false)
+	proc.ApplyEdits = !cfg.IgnoreEdits
 
+	files := make(chan discovery.File, 1000)
+	go discovery.WalkFiles(cfg.InputDir, files, matcher, filters...)
+
+	var (
+		mu      sync.Mutex
+		results []AnalysisResult
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				result := AnalysisResult{Path: file.Path}
+				result.Scores, result.Err = proc.Analyze(file.Path)
+				if result.Err == nil {
+					result.Reason, result.Detail = gates.Check(result.Scores)
+				}
+
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}()
+	}
 	wg.Wait()
-	bar.Finish()
 
-	if cfg.Prune {
-		log.Info().Msg("Starting pruning phase...")
-		pruner := pruner.NewPruner(cfg.InputDir, cfg.OutputDir, cfg.Format, matcher, cfg.DryRun)
-		removedCount, err := pruner.Prune()
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	return results, nil
+}
+
+// loadMatcher loads the ignore rules, falling back to an empty matcher
+func loadMatcher(cfg Config) *discovery.IgnoreMatcher {
+	matcher, err := discovery.NewIgnoreMatcher(cfg.IgnoreFile, cfg.InputDir)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load .frameoignore")
+		return &discovery.IgnoreMatcher{} // Empty matcher
+	}
+	return matcher
+}
+
+// buildFilters compiles the configured filter expression and rating/tag filters
+func buildFilters(cfg Config) ([]discovery.Filter, error) {
+	var filters []*filter.Filter
+	if strings.TrimSpace(cfg.Filter) != "" {
+		f, err := filter.Parse(cfg.Filter)
 		if err != nil {
-			log.Error().Err(err).Msg("Pruning failed")
-		} else {
-			log.Info().Int("removed", removedCount).Msg("Pruning completed")
+			return nil, fmt.Errorf("invalid filter: %w", err)
 		}
+		// Faces are counted on the photo as displayed
+		loader := processor.NewProcessor(0, 0, 0, cfg.Format, false)
+		loader.ApplyEdits = !cfg.IgnoreEdits
+		f.CountFaces = loader.CountFaces
+		filters = append(filters, f)
+	}
+	if cfg.MinRating > 0 {
+		filters = append(filters, filter.MinRating(cfg.MinRating))
+	}
+	if len(cfg.ExcludeTags) > 0 {
+		filters = append(filters, filter.ExcludeTags(cfg.ExcludeTags))
 	}
 
-	return nil
+	result := make([]discovery.Filter, 0, len(filters))
+	for _, f := range filters {
+		log.Info().Str("filter", f.String()).Msg("Filtering input files")
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// deferFaceFilters leaves the face comparisons of the filters to the
+// processor and returns the check it should make, or nil when no filter
+// refers to faces
+func deferFaceFilters(inputDir string, filters []discovery.Filter) func(srcPath string, faces int) bool {
+	var deferred []*filter.Filter
+	for _, f := range filters {
+		if ff, ok := f.(*filter.Filter); ok && ff.NeedsFaces() {
+			ff.DeferFaces = true
+			deferred = append(deferred, ff)
+		}
+	}
+	if len(deferred) == 0 {
+		return nil
+	}
+	return func(srcPath string, faces int) bool {
+		relPath, err := filepath.Rel(inputDir, srcPath)
+		if err != nil {
+			relPath = srcPath
+		}
+		file := discovery.File{Path: srcPath, RelativePath: relPath}
+		for _, f := range deferred {
+			if !f.MatchFaces(&file, faces) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// selectFiles discovers all input files and picks a subset of them
+func selectFiles(root string, matcher *discovery.IgnoreMatcher, filters []discovery.Filter, opts selection.Options) ([]discovery.File, selection.Set) {
+	found := make(chan discovery.File, 1000)
+	go discovery.WalkFiles(root, found, matcher, filters...)
+
+	var candidates []discovery.File
+	for file := range found {
+		candidates = append(candidates, file)
+	}
+
+	set := selection.Select(candidates, opts)
+	selected := make([]discovery.File, 0, len(set))
+	for _, file := range candidates {
+		if set[file.Path] {
+			selected = append(selected, file)
+		}
+	}
+	return selected, set
+}
+
+func buildGates(cfg Config) (quality.Gates, error) {
+	gates := quality.Gates{
+		MinSharpness:  cfg.MinSharpness,
+		MinBrightness: cfg.MinBrightness,
+		MaxBrightness: cfg.MaxBrightness,
+		MaxClipped:    cfg.MaxClipped,
+	}
+	if cfg.MinResolution != "" {
+		w, h, err := parseResolution(cfg.MinResolution)
+		if err != nil {
+			return gates, fmt.Errorf("invalid minimum resolution: %w", err)
+		}
+		gates.MinLong, gates.MinShort = max(w, h), min(w, h)
+	}
+	return gates, nil
+}
+
+// collectRejected adds the groups of an index to the report and
+// marks the rejected source files as excluded
+func collectRejected(rep *report.Report, index *dedup.Index, kind string, excluded map[string]bool) {
+	if index == nil {
+		return
+	}
+	for _, c := range index.Clusters() {
+		group := report.Group{Kind: kind, Kept: c.Kept.Path}
+		for _, d := range c.Duplicates {
+			group.Rejected = append(group.Rejected, d.Path)
+		}
+		rep.AddGroup(group)
+	}
+	for _, path := range index.Rejected() {
+		excluded[path] = true
+	}
+}
+
+// replacedOutputs lists the outputs of photos replaced by a better copy,
+// relative to the output directory
+func replacedOutputs(cfg Config, proc *processor.Processor) []string {
+	var outputs []string
+	for _, index := range []*dedup.Index{proc.Dedup, proc.Burst} {
+		if index == nil {
+			continue
+		}
+		for _, output := range index.Replaced() {
+			if relPath, err := filepath.Rel(cfg.OutputDir, output); err == nil {
+				outputs = append(outputs, relPath)
+			}
+		}
+	}
+	return outputs
+}
+
+// recordResult logs the outcome of processing a single file and adds it to the report
+func recordResult(rep *report.Report, t task, err error) {
+	path := t.file.Path
+	var skip *processor.SkipError
+	switch {
+	case upToDate(t, err):
+		log.Debug().Str("file", path).Msg("Output up to date")
+		rep.AddUpToDate()
+	case err == nil:
+		log.Debug().Str("file", path).Dur("duration", time.Since(t.start)).Msg("Processed file")
+		rep.AddProcessed()
+	case errors.As(err, &skip):
+		log.Info().Str("file", path).Str("stage", t.stage).Str("reason", skip.Reason).Str("detail", skip.Detail).Msg("Skipping file")
+		rep.AddSkipped(path, skip.Reason, skip.Detail)
+	default:
+		log.Error().Err(err).Str("file", path).Str("stage", t.stage).Msg("Failed to process file")
+		rep.AddFailed(path, err)
+	}
+}
+
+// upToDate reports whether a file was skipped because its output is current
+func upToDate(t task, err error) bool {
+	return err == nil && t.job != nil && t.job.UpToDate()
+}
+
+// outcome classifies the result of processing a file for progress
+func outcome(t task, err error) progress.Outcome {
+	var skip *processor.SkipError
+	switch {
+	case upToDate(t, err):
+		return progress.Skipped
+	case err == nil:
+		return progress.Processed
+	case errors.As(err, &skip):
+		return progress.Skipped
+	}
+	return progress.Failed
+}
+
+// resultLabels describes the result of processing a file for metrics: the
+// outcome and the skip reason or the stage that failed
+func resultLabels(t task, err error) (string, string) {
+	var skip *processor.SkipError
+	switch {
+	case upToDate(t, err):
+		return "skipped", report.ReasonUpToDate
+	case err == nil:
+		return "processed", ""
+	case errors.As(err, &skip):
+		return "skipped", skip.Reason
+	}
+	return "failed", t.stage
+}
+
+// uncounted applies filters and takes the files they reject out of the
+// progress total, which is counted without them
+type uncounted struct {
+	filters []discovery.Filter
+	tracker *progress.Tracker
+}
+
+func (u uncounted) Match(file *discovery.File) bool {
+	for _, f := range u.filters {
+		if !f.Match(file) {
+			u.tracker.AddTotal(-1, -fileSize(file.Path))
+			return false
+		}
+	}
+	return true
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// recordLocation adds the place a photo was taken at to the report
+func recordLocation(rep *report.Report, file *discovery.File) {
+	m := file.Metadata()
+	if !m.HasGPS {
+		return
+	}
+	if place, ok := geo.Lookup(m.Latitude, m.Longitude); ok {
+		rep.AddLocation(place.String())
+	}
+}
+
+func validateFormat(format string) error {
+	switch format {
+	case "webp", "jpg", "jpeg", "auto":
+		return nil
+	}
+	return fmt.Errorf("invalid format: %s (expected webp, jpg or auto)", format)
+}
+
+// validateCrop checks a crop mode, empty meaning none
+func validateCrop(mode string) error {
+	switch mode {
+	case "", "none", "center", "faces":
+		return nil
+	}
+	return fmt.Errorf("invalid crop mode: %s (expected none, center or faces)", mode)
 }
 
 func parseResolution(res string) (int, int, error) {
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+	"github.com/tgagor/frameo-miniatures/internal/enhance"
+	"github.com/tgagor/frameo-miniatures/internal/overrides"
+	"github.com/tgagor/frameo-miniatures/internal/processor"
+)
+
+// processors hands out the processor of a file: the configured one, or a
+// copy with the settings of the file's .frameo.yaml files applied. It is
+// safe for concurrent use.
+type processors struct {
+	base       *processor.Processor
+	tree       *overrides.Tree
+	mu         sync.Mutex
+	bySettings map[string]*processor.Processor
+}
+
+func newProcessors(base *processor.Processor, inputDir string) *processors {
+	return &processors{
+		base:       base,
+		tree:       overrides.NewTree(inputDir),
+		bySettings: make(map[string]*processor.Processor),
+	}
+}
+
+// For returns the processor of a file
+func (p *processors) For(file discovery.File) (*processor.Processor, error) {
+	settings, err := p.tree.For(file.RelativePath)
+	if err != nil {
+		return nil, err
+	}
+	if settings.IsZero() {
+		return p.base, nil
+	}
+
+	// Folders with the same settings share a processor
+	data, _ := json.Marshal(settings)
+	key := string(data)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if proc, ok := p.bySettings[key]; ok {
+		return proc, nil
+	}
+	proc, err := applySettings(*p.base, settings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder settings for %s: %w", file.RelativePath, err)
+	}
+	p.bySettings[key] = proc
+	return proc, nil
+}
+
+// applySettings returns a copy of the processor with folder settings
+// applied, validated like their flags
+func applySettings(proc processor.Processor, s overrides.Settings) (*processor.Processor, error) {
+	if s.Resolution != nil {
+		width, height, err := parseResolution(*s.Resolution)
+		if err != nil {
+			return nil, err
+		}
+		proc.Width, proc.Height = width, height
+	}
+	if s.Quality != nil {
+		proc.Quality = *s.Quality
+	}
+	if s.Crop != nil {
+		if err := validateCrop(*s.Crop); err != nil {
+			return nil, err
+		}
+		proc.Crop = *s.Crop
+	}
+	if s.Lossless != nil {
+		proc.Encoder.Lossless = *s.Lossless
+	}
+	if s.NearLossless != nil {
+		proc.Encoder.NearLossless = *s.NearLossless
+	}
+	if s.Resample != nil {
+		if err := processor.ValidateFilter(*s.Resample); err != nil {
+			return nil, err
+		}
+		proc.Filter = *s.Resample
+	}
+	if s.Enhance != nil {
+		steps, err := enhance.Parse(s.Enhance)
+		if err != nil {
+			return nil, err
+		}
+		proc.Enhance = steps
+	}
+	return &proc, nil
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+	"github.com/tgagor/frameo-miniatures/internal/metrics"
+	"github.com/tgagor/frameo-miniatures/internal/pipeline"
+	"github.com/tgagor/frameo-miniatures/internal/processor"
+)
+
+// task is a file travelling through the stages
+type task struct {
+	file discovery.File
+	proc *processor.Processor // With the settings of the file's folder
+	job  *processor.Job
+	cost int64 // Bytes held from the memory budget
+
+	stage string    // Last stage the file went through
+	start time.Time // When decoding started
+}
+
+// stages configures the concurrency of the processing pipeline
+type stages struct {
+	decoders     int
+	transformers int
+	encoders     int
+	budget       *pipeline.Budget
+	metrics      *metrics.Metrics
+}
+
+// process runs every file through three pools: decode, transform and
+// encode. Full size images only live between decoding and the end of the
+// transform, which is what the memory budget is held for. done is called
+// once per file with the outcome.
+func (s stages) process(cfg Config, procs *processors, files <-chan discovery.File, done func(t task, err error)) {
+	decoded := make(chan task)
+	transformed := make(chan task)
+
+	run := func(workers int, work func(), then func()) {
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				work()
+			}()
+		}
+		go func() {
+			wg.Wait()
+			then()
+		}()
+	}
+
+	run(s.decoders, func() {
+		for file := range files {
+			t := task{file: file, stage: processor.StageDecode}
+			proc, err := procs.For(file)
+			if err != nil {
+				done(t, err)
+				continue
+			}
+			t.proc = proc
+			if cfg.DryRun {
+				done(t, nil)
+				continue
+			}
+			if s.budget != nil {
+				t.cost = processor.EstimateMemory(file.Path)
+				s.budget.Acquire(t.cost)
+			}
+
+			destDir := filepath.Join(cfg.OutputDir, filepath.Dir(file.RelativePath))
+			t.stage, t.start = processor.StageDecode, time.Now()
+			job, err := t.proc.Read(file.Path, destDir)
+			size := fileSize(file.Path)
+			logStage(t, time.Since(t.start), size)
+			s.metrics.AddBytes(size, 0)
+			if err != nil {
+				s.release(t)
+				done(t, err)
+				continue
+			}
+			t.job = job
+			decoded <- t
+		}
+	}, func() { close(decoded) })
+
+	run(s.transformers, func() {
+		for t := range decoded {
+			t.stage = processor.StageTransform
+			start := time.Now()
+			err := t.proc.Transform(t.job)
+			logStage(t, time.Since(start), 0)
+			s.release(t)
+			if err != nil {
+				done(t, err)
+				continue
+			}
+			transformed <- t
+		}
+	}, func() { close(transformed) })
+
+	finished := make(chan struct{})
+	run(s.encoders, func() {
+		for t := range transformed {
+			t.stage = processor.StageEncode
+			start := time.Now()
+			err := t.proc.Write(t.job)
+			var size int64
+			if err == nil && !t.job.UpToDate() {
+				size = fileSize(t.job.Output())
+			}
+			logStage(t, time.Since(start), size)
+			s.metrics.AddBytes(0, size)
+			done(t, err)
+		}
+	}, func() { close(finished) })
+	<-finished
+}
+
+// logStage logs how long a stage took for a file and how many bytes it
+// read or wrote
+func logStage(t task, duration time.Duration, bytes int64) {
+	event := log.Debug().
+		Str("file", t.file.Path).
+		Str("stage", t.stage).
+		Dur("duration", duration)
+	if bytes > 0 {
+		event = event.Int64("bytes", bytes)
+	}
+	event.Msg("Stage finished")
+}
+
+func (s stages) release(t task) {
+	if s.budget != nil {
+		s.budget.Release(t.cost)
+	}
+}
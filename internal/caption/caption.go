@@ -0,0 +1,222 @@
+package caption
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Defaults used when an option is left at its zero value
+const (
+	DefaultPosition   = "bottom-right"
+	DefaultSize       = 0.04
+	DefaultOpacity    = 0.9
+	DefaultDateFormat = "2 January 2006"
+)
+
+// Options configures the caption overlay
+type Options struct {
+	// Template with {placeholders}, e.g. "{date} · {folder}".
+	// Dates accept a Go layout: {date:2006-01-02}.
+	Template string
+	// Position is one of top-left, top-center, top-right,
+	// bottom-left, bottom-center or bottom-right
+	Position string
+	// Size is the text height as a fraction of the image height,
+	// so captions look the same at any output resolution
+	Size    float64
+	Opacity float64 // 0-1
+	Shadow  bool
+	// DateFormat is the Go layout used by {date} without an explicit one
+	DateFormat string
+}
+
+// Vars are the values available to templates. Missing values expand to
+// an empty string.
+type Vars struct {
+	Taken  time.Time
+	Values map[string]string
+}
+
+// Renderer draws captions onto images. It is safe for concurrent use.
+type Renderer struct {
+	opts Options
+	font *opentype.Font
+
+	mu    sync.Mutex
+	faces map[int]*sync.Pool // Keyed by pixel size, a face can only draw one caption at a time
+}
+
+var validPositions = map[string]bool{
+	"top-left": true, "top-center": true, "top-right": true,
+	"bottom-left": true, "bottom-center": true, "bottom-right": true,
+}
+
+// New creates a renderer using the bundled Go font
+func New(opts Options) (*Renderer, error) {
+	if opts.Position == "" {
+		opts.Position = DefaultPosition
+	}
+	if !validPositions[opts.Position] {
+		return nil, fmt.Errorf("invalid caption position: %s", opts.Position)
+	}
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.Size > 0.5 {
+		return nil, fmt.Errorf("caption size must be a fraction of the image height, got %g", opts.Size)
+	}
+	if opts.Opacity <= 0 || opts.Opacity > 1 {
+		opts.Opacity = DefaultOpacity
+	}
+	if opts.DateFormat == "" {
+		opts.DateFormat = DefaultDateFormat
+	}
+
+	f, err := opentype.Parse(gomedium.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load font: %w", err)
+	}
+	return &Renderer{opts: opts, font: f, faces: make(map[int]*sync.Pool)}, nil
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)(?::([^}]*))?\}`)
+
+// Options returns the options the renderer was created with
+func (r *Renderer) Options() Options {
+	return r.opts
+}
+
+// Text expands the template for a photo
+func (r *Renderer) Text(vars Vars) string {
+	text := placeholder.ReplaceAllStringFunc(r.opts.Template, func(m string) string {
+		parts := placeholder.FindStringSubmatch(m)
+		name, arg := parts[1], parts[2]
+		if name == "date" {
+			if vars.Taken.IsZero() {
+				return ""
+			}
+			layout := r.opts.DateFormat
+			if arg != "" {
+				layout = arg
+			}
+			return vars.Taken.Format(layout)
+		}
+		return vars.Values[name]
+	})
+
+	// Drop separators left over from missing values. Lines are separated
+	// by newlines or a literal "\n", which is easier to type in a shell.
+	lines := strings.Split(strings.ReplaceAll(text, `\n`, "\n"), "\n")
+	var result []string
+	for _, line := range lines {
+		line = strings.Trim(line, " ·|,-–")
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return strings.Join(result, "\n")
+}
+
+// Render draws the text onto a copy of the image. Lines are separated by "\n".
+func (r *Renderer) Render(img image.Image, text string) image.Image {
+	if text == "" {
+		return img
+	}
+
+	dst := imaging.Clone(img)
+	bounds := dst.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	px := int(float64(h) * r.opts.Size)
+	if px < 6 {
+		px = 6
+	}
+
+	face, pool, err := r.face(px)
+	if err != nil {
+		return img
+	}
+	defer pool.Put(face)
+
+	lines := strings.Split(text, "\n")
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	margin := max(min(w, h)/40, 2)
+
+	// Top of the text block
+	blockHeight := lineHeight * len(lines)
+	y := margin
+	if strings.HasPrefix(r.opts.Position, "bottom") {
+		y = h - margin - blockHeight
+	}
+
+	alpha := uint8(r.opts.Opacity * 255)
+	shadowOffset := max(px/16, 1)
+
+	for _, line := range lines {
+		width := font.MeasureString(face, line).Ceil()
+		x := margin
+		switch {
+		case strings.HasSuffix(r.opts.Position, "right"):
+			x = w - margin - width
+		case strings.HasSuffix(r.opts.Position, "center"):
+			x = (w - width) / 2
+		}
+		baseline := y + metrics.Ascent.Ceil()
+
+		if r.opts.Shadow {
+			drawString(dst, face, line, x+shadowOffset, baseline+shadowOffset, color.NRGBA{0, 0, 0, alpha / 4 * 3})
+		}
+		drawString(dst, face, line, x, baseline, color.NRGBA{255, 255, 255, alpha})
+		y += lineHeight
+	}
+	return dst
+}
+
+func drawString(dst draw.Image, face font.Face, text string, x, baseline int, c color.Color) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(dst.Bounds().Min.X+x, dst.Bounds().Min.Y+baseline),
+	}
+	d.DrawString(text)
+}
+
+// face borrows a font face of the given pixel size, to be put back into
+// the pool when done. Only the lookup is locked, captions are drawn in
+// parallel.
+func (r *Renderer) face(px int) (font.Face, *sync.Pool, error) {
+	r.mu.Lock()
+	pool, ok := r.faces[px]
+	if !ok {
+		pool = &sync.Pool{}
+		r.faces[px] = pool
+	}
+	r.mu.Unlock()
+
+	if f, ok := pool.Get().(font.Face); ok {
+		return f, pool, nil
+	}
+	f, err := opentype.NewFace(r.font, &opentype.FaceOptions{
+		Size:    float64(px),
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, pool, nil
+}
@@ -0,0 +1,123 @@
+package caption
+
+import (
+	"image"
+	"image/color"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderer_Text(t *testing.T) {
+	r, err := New(Options{Template: "{date} · {folder}"})
+	require.NoError(t, err)
+
+	taken := time.Date(2019, 8, 11, 9, 48, 0, 0, time.UTC)
+	assert.Equal(t, "11 August 2019 · Holidays", r.Text(Vars{Taken: taken, Values: map[string]string{"folder": "Holidays"}}))
+
+	// Missing values don't leave dangling separators
+	assert.Equal(t, "Holidays", r.Text(Vars{Values: map[string]string{"folder": "Holidays"}}))
+	assert.Equal(t, "", r.Text(Vars{}))
+
+	r, err = New(Options{Template: `{date:2006-01-02}\n{title}`})
+	require.NoError(t, err)
+	assert.Equal(t, "2019-08-11\nAt the lake", r.Text(Vars{Taken: taken, Values: map[string]string{"title": "At the lake"}}))
+	assert.Equal(t, "2019-08-11", r.Text(Vars{Taken: taken}))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New(Options{Template: "{date}", Position: "middle"})
+	assert.Error(t, err)
+
+	_, err = New(Options{Template: "{date}", Size: 2})
+	assert.Error(t, err)
+}
+
+// inkBounds returns the bounding box of pixels that differ from the background
+func inkBounds(img image.Image, bg color.NRGBA) image.Rectangle {
+	var ink image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA) != bg {
+				ink = ink.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return ink
+}
+
+func TestRenderer_Render(t *testing.T) {
+	bg := color.NRGBA{40, 80, 120, 255}
+
+	tests := []struct {
+		position string
+		check    func(t *testing.T, ink image.Rectangle, w, h int)
+	}{
+		{"bottom-right", func(t *testing.T, ink image.Rectangle, w, h int) {
+			assert.Greater(t, ink.Min.X, w/2)
+			assert.Greater(t, ink.Min.Y, h/2)
+		}},
+		{"top-left", func(t *testing.T, ink image.Rectangle, w, h int) {
+			assert.Less(t, ink.Max.X, w/2)
+			assert.Less(t, ink.Max.Y, h/2)
+		}},
+		{"bottom-center", func(t *testing.T, ink image.Rectangle, w, h int) {
+			assert.InDelta(t, w/2, (ink.Min.X+ink.Max.X)/2, float64(w)/20)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			r, err := New(Options{Position: tt.position, Shadow: true})
+			require.NoError(t, err)
+
+			img := imaging.New(640, 400, bg)
+			out := r.Render(img, "11 August 2019")
+
+			ink := inkBounds(out, bg)
+			require.False(t, ink.Empty(), "caption must be drawn")
+			tt.check(t, ink, 640, 400)
+			assert.Equal(t, image.Rectangle{}, inkBounds(img, bg), "source image must not change")
+		})
+	}
+}
+
+func TestRenderer_RenderScales(t *testing.T) {
+	bg := color.NRGBA{0, 0, 0, 255}
+	r, err := New(Options{Size: 0.05})
+	require.NoError(t, err)
+
+	small := inkBounds(r.Render(imaging.New(640, 400, bg), "Holidays"), bg)
+	large := inkBounds(r.Render(imaging.New(1280, 800, bg), "Holidays"), bg)
+
+	// Twice the resolution, twice the text
+	assert.InDelta(t, 2.0, float64(large.Dx())/float64(small.Dx()), 0.2)
+	assert.InDelta(t, 2.0, float64(large.Dy())/float64(small.Dy()), 0.3)
+}
+
+func TestRenderer_RenderConcurrent(t *testing.T) {
+	bg := color.NRGBA{0, 0, 0, 255}
+	r, err := New(Options{Shadow: true})
+	require.NoError(t, err)
+	want := r.Render(imaging.New(640, 400, bg), "Holidays").(*image.NRGBA)
+
+	// Encoder workers draw captions at the same time
+	var wg sync.WaitGroup
+	results := make([]image.Image, 8)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.Render(imaging.New(640, 400, bg), "Holidays")
+		}()
+	}
+	wg.Wait()
+	for _, got := range results {
+		assert.Equal(t, want.Pix, got.(*image.NRGBA).Pix)
+	}
+}
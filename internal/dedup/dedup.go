@@ -0,0 +1,335 @@
+package dedup
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/phash"
+)
+
+// Policy decides what happens with duplicate photos
+type Policy string
+
+const (
+	// PolicyOff disables duplicate detection
+	PolicyOff Policy = ""
+	// PolicyReport only lists duplicates, every file is still processed
+	PolicyReport Policy = "report"
+	// PolicySkip keeps the first file of each cluster (in path order)
+	PolicySkip Policy = "skip"
+	// PolicyKeepHighest keeps the highest resolution file of each cluster
+	PolicyKeepHighest Policy = "keep-highest"
+	// PolicyKeepBest keeps the file with the highest Score of each cluster
+	PolicyKeepBest Policy = "keep-best"
+)
+
+// DefaultThreshold is the maximum hash distance for two photos to count as duplicates
+const DefaultThreshold = 5
+
+// ParsePolicy validates a policy name
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case PolicyOff, PolicyReport, PolicySkip, PolicyKeepHighest:
+		return p, nil
+	}
+	if name == "off" {
+		return PolicyOff, nil
+	}
+	return PolicyOff, fmt.Errorf("invalid duplicate policy: %s (expected report, skip or keep-highest)", name)
+}
+
+// Entry describes a single processed photo
+type Entry struct {
+	Path   string // Source path
+	Output string // Output path, empty when nothing is written
+	Hash   phash.Hash
+	Width  int // Source dimensions
+	Height int
+	Taken  time.Time // Capture time, only used when the index has a time window
+	Score  float64   // Quality score, only used by PolicyKeepBest
+}
+
+// Cluster is a group of photos considered to be the same shot
+type Cluster struct {
+	Kept       Entry
+	Duplicates []Entry
+}
+
+// Decision tells the caller whether to keep processing a file
+type Decision struct {
+	Skip        bool
+	DuplicateOf string
+}
+
+type entry struct {
+	Entry
+	cluster  int
+	written  bool
+	rejected bool
+}
+
+// Index collects perceptual hashes across a run and groups near-identical photos.
+// It is safe for concurrent use.
+type Index struct {
+	Policy    Policy
+	Threshold int
+	// Window limits matches to photos taken at most this far apart.
+	// Photos without a capture time never match when it is set.
+	Window time.Duration
+
+	mu      sync.Mutex
+	entries []*entry
+	byPath  map[string]int
+	tree    bkTree
+	parent  []int // union-find over cluster ids
+	best    []int // cluster id -> index of the best entry
+}
+
+// NewIndex creates a new duplicate index
+func NewIndex(policy Policy, threshold int) *Index {
+	return &Index{
+		Policy:    policy,
+		Threshold: threshold,
+	}
+}
+
+// Add registers a photo and decides whether it should be written.
+// When a better copy replaces an already written one, the old output is
+// listed by Replaced.
+func (idx *Index) Add(e Entry) Decision {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	n := &entry{Entry: e}
+	id := len(idx.entries)
+	idx.entries = append(idx.entries, n)
+	if idx.byPath == nil {
+		idx.byPath = make(map[string]int)
+	}
+	idx.byPath[e.Path] = id
+
+	// Find all clusters this photo is close to
+	roots := make(map[int]bool)
+	for _, other := range idx.tree.search(e.Hash, idx.Threshold) {
+		if !idx.withinWindow(idx.entries[other], n) {
+			continue
+		}
+		roots[idx.find(idx.entries[other].cluster)] = true
+	}
+	idx.tree.add(e.Hash, id)
+
+	if len(roots) == 0 {
+		n.cluster = len(idx.parent)
+		idx.parent = append(idx.parent, n.cluster)
+		idx.best = append(idx.best, id)
+		return Decision{}
+	}
+
+	// Merge the matching clusters and pick the best photo among their winners
+	var root int
+	candidates := []int{id}
+	first := true
+	for r := range roots {
+		candidates = append(candidates, idx.best[r])
+		if first || r < root {
+			root = r
+		}
+		first = false
+	}
+	for r := range roots {
+		idx.parent[r] = root
+	}
+	n.cluster = root
+
+	winner := id
+	for _, c := range candidates {
+		if idx.better(idx.entries[c], idx.entries[winner]) {
+			winner = c
+		}
+	}
+	idx.best[root] = winner
+
+	if idx.Policy == PolicyReport {
+		return Decision{}
+	}
+
+	for _, c := range candidates {
+		if c != winner && c != id {
+			idx.reject(idx.entries[c], idx.entries[winner].Path)
+		}
+	}
+	if winner != id {
+		n.rejected = true
+		return Decision{Skip: true, DuplicateOf: idx.entries[winner].Path}
+	}
+	return Decision{}
+}
+
+// Written marks the output of a photo as present on disk
+func (idx *Index) Written(path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if id, ok := idx.byPath[path]; ok {
+		idx.entries[id].written = true
+	}
+}
+
+// Replaced returns the outputs written for photos that lost against a
+// better copy later in the run. The index doesn't remove them, that is
+// left to the caller.
+func (idx *Index) Replaced() []string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var outputs []string
+	for _, e := range idx.entries {
+		if e.rejected && e.written && e.Output != "" {
+			outputs = append(outputs, e.Output)
+		}
+	}
+	sort.Strings(outputs)
+	return outputs
+}
+
+// Rejected returns the source paths of all photos that were not kept
+func (idx *Index) Rejected() []string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var paths []string
+	for _, e := range idx.entries {
+		if e.rejected {
+			paths = append(paths, e.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Clusters returns all groups with more than one photo, sorted by the kept path
+func (idx *Index) Clusters() []Cluster {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	members := make(map[int][]Entry)
+	for i, e := range idx.entries {
+		root := idx.find(e.cluster)
+		if idx.best[root] != i {
+			members[root] = append(members[root], e.Entry)
+		}
+	}
+
+	var clusters []Cluster
+	for root, dups := range members {
+		sort.Slice(dups, func(i, j int) bool { return dups[i].Path < dups[j].Path })
+		clusters = append(clusters, Cluster{
+			Kept:       idx.entries[idx.best[root]].Entry,
+			Duplicates: dups,
+		})
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Kept.Path < clusters[j].Kept.Path })
+	return clusters
+}
+
+func (idx *Index) find(c int) int {
+	for idx.parent[c] != c {
+		idx.parent[c] = idx.parent[idx.parent[c]]
+		c = idx.parent[c]
+	}
+	return c
+}
+
+func (idx *Index) withinWindow(a, b *entry) bool {
+	if idx.Window <= 0 {
+		return true
+	}
+	if a.Taken.IsZero() || b.Taken.IsZero() {
+		return false
+	}
+	d := a.Taken.Sub(b.Taken)
+	return d <= idx.Window && d >= -idx.Window
+}
+
+// better reports whether a should be kept over b
+func (idx *Index) better(a, b *entry) bool {
+	if idx.Policy == PolicyKeepBest && a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	if idx.Policy == PolicyKeepHighest || idx.Policy == PolicyKeepBest {
+		pa, pb := a.Width*a.Height, b.Width*b.Height
+		if pa != pb {
+			return pa > pb
+		}
+	}
+	return a.Path < b.Path
+}
+
+func (idx *Index) reject(e *entry, by string) {
+	if e.rejected {
+		return
+	}
+	e.rejected = true
+	log.Info().Str("file", e.Path).Str("kept", by).Msg("Replacing duplicate with a better copy")
+}
+
+// bkTree indexes hashes by Hamming distance for fast near-neighbour lookups
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	hash     phash.Hash
+	ids      []int
+	children map[int]*bkNode
+}
+
+func (t *bkTree) add(h phash.Hash, id int) {
+	if t.root == nil {
+		t.root = &bkNode{hash: h, ids: []int{id}}
+		return
+	}
+	node := t.root
+	for {
+		d := phash.Distance(h, node.hash)
+		if d == 0 {
+			node.ids = append(node.ids, id)
+			return
+		}
+		child, ok := node.children[d]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[d] = &bkNode{hash: h, ids: []int{id}}
+			return
+		}
+		node = child
+	}
+}
+
+func (t *bkTree) search(h phash.Hash, threshold int) []int {
+	if t.root == nil {
+		return nil
+	}
+	var result []int
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := phash.Distance(h, node.hash)
+		if d <= threshold {
+			result = append(result, node.ids...)
+		}
+		for cd, child := range node.children {
+			if cd >= d-threshold && cd <= d+threshold {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, name := range []string{"", "off", "report", "skip", "keep-highest"} {
+		_, err := ParsePolicy(name)
+		assert.NoError(t, err, name)
+	}
+	_, err := ParsePolicy("delete")
+	assert.Error(t, err)
+}
+
+func TestIndex_Skip(t *testing.T) {
+	idx := NewIndex(PolicySkip, DefaultThreshold)
+
+	assert.False(t, idx.Add(Entry{Path: "a.jpg", Hash: 0xF0F0}).Skip)
+	assert.False(t, idx.Add(Entry{Path: "unrelated.jpg", Hash: 0xFFFFFFFF00000000}).Skip)
+
+	// Near duplicate (2 bits off) arriving later in path order is skipped
+	d := idx.Add(Entry{Path: "b.jpg", Hash: 0xF0F3})
+	assert.True(t, d.Skip)
+	assert.Equal(t, "a.jpg", d.DuplicateOf)
+
+	assert.Equal(t, []string{"b.jpg"}, idx.Rejected())
+
+	clusters := idx.Clusters()
+	require.Len(t, clusters, 1)
+	assert.Equal(t, "a.jpg", clusters[0].Kept.Path)
+	assert.Equal(t, "b.jpg", clusters[0].Duplicates[0].Path)
+}
+
+func TestIndex_KeepHighestReplacesWrittenOutput(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "dedup-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	smallOut := filepath.Join(tmpDir, "small.webp")
+	require.NoError(t, os.WriteFile(smallOut, []byte("x"), 0644))
+
+	idx := NewIndex(PolicyKeepHighest, DefaultThreshold)
+
+	assert.False(t, idx.Add(Entry{Path: "small.jpg", Output: smallOut, Hash: 42, Width: 640, Height: 480}).Skip)
+	idx.Written("small.jpg")
+
+	// Bigger copy wins, the output written for the small one is left to
+	// the caller to remove
+	assert.False(t, idx.Add(Entry{Path: "big.jpg", Hash: 42, Width: 4000, Height: 3000}).Skip)
+	assert.FileExists(t, smallOut)
+	assert.Equal(t, []string{smallOut}, idx.Replaced())
+
+	// Mid-sized copy loses
+	d := idx.Add(Entry{Path: "mid.jpg", Hash: 43, Width: 1920, Height: 1080})
+	assert.True(t, d.Skip)
+	assert.Equal(t, "big.jpg", d.DuplicateOf)
+
+	assert.Equal(t, []string{"mid.jpg", "small.jpg"}, idx.Rejected())
+}
+
+func TestIndex_LateWriteOfRejectedOutput(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "dedup-late-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	out := filepath.Join(tmpDir, "b.webp")
+	idx := NewIndex(PolicySkip, DefaultThreshold)
+
+	// b is accepted first, then a (earlier in path order) takes over
+	// before b's worker managed to write its output
+	assert.False(t, idx.Add(Entry{Path: "b.jpg", Output: out, Hash: 7}).Skip)
+	assert.False(t, idx.Add(Entry{Path: "a.jpg", Hash: 7}).Skip)
+
+	assert.Empty(t, idx.Replaced())
+	require.NoError(t, os.WriteFile(out, []byte("x"), 0644))
+	idx.Written("b.jpg")
+	assert.Equal(t, []string{out}, idx.Replaced())
+}
+
+func TestIndex_Report(t *testing.T) {
+	idx := NewIndex(PolicyReport, DefaultThreshold)
+
+	assert.False(t, idx.Add(Entry{Path: "a.jpg", Hash: 1}).Skip)
+	assert.False(t, idx.Add(Entry{Path: "b.jpg", Hash: 1}).Skip)
+	assert.False(t, idx.Add(Entry{Path: "c.jpg", Hash: 3}).Skip)
+
+	assert.Empty(t, idx.Rejected())
+	clusters := idx.Clusters()
+	require.Len(t, clusters, 1)
+	assert.Len(t, clusters[0].Duplicates, 2)
+}
+
+func TestIndex_MergesClusters(t *testing.T) {
+	idx := NewIndex(PolicyReport, 2)
+
+	// x and z are 4 bits apart, y sits in between and joins both
+	idx.Add(Entry{Path: "x.jpg", Hash: 0b0000})
+	idx.Add(Entry{Path: "z.jpg", Hash: 0b1111})
+	assert.Empty(t, idx.Clusters())
+
+	idx.Add(Entry{Path: "y.jpg", Hash: 0b0011})
+	clusters := idx.Clusters()
+	require.Len(t, clusters, 1)
+	assert.Equal(t, "x.jpg", clusters[0].Kept.Path)
+	assert.Len(t, clusters[0].Duplicates, 2)
+}
+
+func TestIndex_KeepBestWithinWindow(t *testing.T) {
+	idx := NewIndex(PolicyKeepBest, 10)
+	idx.Window = 5 * time.Second
+
+	base := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, idx.Add(Entry{Path: "1.jpg", Hash: 0, Taken: base, Score: 10}).Skip)
+	// Sharper shot two seconds later replaces the first one
+	assert.False(t, idx.Add(Entry{Path: "2.jpg", Hash: 3, Taken: base.Add(2 * time.Second), Score: 50}).Skip)
+	// Blurrier shot of the same burst is rejected
+	d := idx.Add(Entry{Path: "3.jpg", Hash: 1, Taken: base.Add(4 * time.Second), Score: 20})
+	assert.True(t, d.Skip)
+	assert.Equal(t, "2.jpg", d.DuplicateOf)
+
+	// Same pose a minute later is a separate shot
+	assert.False(t, idx.Add(Entry{Path: "4.jpg", Hash: 0, Taken: base.Add(time.Minute), Score: 1}).Skip)
+	// No capture time, no burst
+	assert.False(t, idx.Add(Entry{Path: "5.jpg", Hash: 0, Score: 1}).Skip)
+
+	assert.Equal(t, []string{"1.jpg", "3.jpg"}, idx.Rejected())
+}
@@ -3,71 +3,60 @@ package discovery
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	gitignore "github.com/sabhiram/go-gitignore"
 )
 
+// IgnoreFileName is the name of ignore files, in the input directory and
+// any of its subdirectories
+const IgnoreFileName = ".frameoignore"
+
 // IgnoreMatcher checks if a file should be ignored
 type IgnoreMatcher struct {
 	ignorer *gitignore.GitIgnore
 }
 
-// NewIgnoreMatcher creates a new matcher from a .frameoignore file
-// It searches in the following order:
-// 1. Explicit path (if provided)
-// 2. ~/.config/frameoignore
+// NewIgnoreMatcher creates a matcher from the global ignore files, merged
+// in this order, later rules taking precedence:
+// 1. Explicit path (if provided), otherwise ~/.config/frameoignore
+// 2. Current directory
 // 3. Input directory
-// 4. Current directory
+// Ignore files in subdirectories of the input are found while walking.
 func NewIgnoreMatcher(explicitPath, inputDir string) (*IgnoreMatcher, error) {
-	var ignorePath string
-
-	// Helper to check if file exists
-	exists := func(path string) bool {
-		_, err := os.Stat(path)
-		return err == nil
+	var paths []string
+	if explicitPath != "" {
+		paths = append(paths, explicitPath)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "frameoignore"))
 	}
+	paths = append(paths, IgnoreFileName, filepath.Join(inputDir, IgnoreFileName))
 
-	if explicitPath != "" && exists(explicitPath) {
-		ignorePath = explicitPath
-	} else {
-		// Check ~/.config/frameoignore
-		home, err := os.UserHomeDir()
-		if err == nil {
-			configPath := filepath.Join(home, ".config", "frameoignore")
-			if exists(configPath) {
-				ignorePath = configPath
-			}
+	var lines []string
+	loaded := make(map[string]bool)
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil || loaded[abs] {
+			continue
 		}
-
-		// Check input dir
-		if ignorePath == "" {
-			inputIgnore := filepath.Join(inputDir, ".frameoignore")
-			if exists(inputIgnore) {
-				ignorePath = inputIgnore
-			}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
 		}
-
-		// Check current dir
-		if ignorePath == "" {
-			currentIgnore := ".frameoignore"
-			if exists(currentIgnore) {
-				ignorePath = currentIgnore
-			}
+		if err != nil {
+			return nil, err
 		}
+		log.Info().Str("file", path).Msg("Loading .frameoignore")
+		loaded[abs] = true
+		lines = append(lines, strings.Split(string(data), "\n")...)
 	}
 
-	if ignorePath == "" {
+	if len(loaded) == 0 {
 		return &IgnoreMatcher{ignorer: nil}, nil
 	}
-
-	log.Info().Str("path", ignorePath).Msg("Loading .frameoignore")
-	ignorer, err := gitignore.CompileIgnoreFile(ignorePath)
-	if err != nil {
-		return nil, err
-	}
-
-	return &IgnoreMatcher{ignorer: ignorer}, nil
+	return &IgnoreMatcher{ignorer: gitignore.CompileIgnoreLines(lines...)}, nil
 }
 
 // Matches returns true if the path should be ignored
@@ -77,3 +66,96 @@ func (m *IgnoreMatcher) Matches(path string, isDir bool) bool {
 	}
 	return m.ignorer.MatchesPath(path)
 }
+
+// LoadIgnoreFile creates a matcher from a single file in .frameoignore
+// syntax. A missing file matches nothing.
+func LoadIgnoreFile(path string) (*IgnoreMatcher, error) {
+	if _, err := os.Stat(path); err != nil {
+		return &IgnoreMatcher{}, nil
+	}
+	log.Info().Str("file", path).Msg("Loading ignore file")
+	ignorer, err := gitignore.CompileIgnoreFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &IgnoreMatcher{ignorer: ignorer}, nil
+}
+
+// nestedIgnores holds the ignore files of the subdirectories of an input
+// directory, each scoped to its directory. They are loaded as the walk
+// reaches them and are safe for concurrent use.
+type nestedIgnores struct {
+	root    string
+	verbose bool
+
+	mu     sync.Mutex
+	scopes map[string]*ignoreScope // Keyed by directory relative to root
+}
+
+// ignoreScope is the ignore file of a directory, chained to the nearest
+// one above it
+type ignoreScope struct {
+	dir     string // Relative to the input directory
+	ignorer *gitignore.GitIgnore
+	matches *gitignore.GitIgnore // The same patterns without negation
+	parent  *ignoreScope
+}
+
+func newNestedIgnores(root string, verbose bool) *nestedIgnores {
+	return &nestedIgnores{root: root, verbose: verbose, scopes: make(map[string]*ignoreScope)}
+}
+
+// decide returns whether the nearest ignore file with a rule for a path,
+// relative to root, ignores it. decided is false when none has a rule.
+func (n *nestedIgnores) decide(relPath string) (ignored, decided bool) {
+	for s := n.scope(filepath.Dir(relPath)); s != nil; s = s.parent {
+		rel, err := filepath.Rel(s.dir, relPath)
+		if err != nil {
+			continue
+		}
+		// A negated rule that matches decides as much as a plain one
+		if s.matches.MatchesPath(rel) {
+			return s.ignorer.MatchesPath(rel), true
+		}
+	}
+	return false, false
+}
+
+// scope returns the nearest ignore file of a directory relative to root,
+// nil when there is none below the input directory itself
+func (n *nestedIgnores) scope(dir string) *ignoreScope {
+	if dir == "." {
+		return nil // The input directory's file is part of the IgnoreMatcher
+	}
+
+	n.mu.Lock()
+	s, ok := n.scopes[dir]
+	n.mu.Unlock()
+	if ok {
+		return s
+	}
+
+	s = n.scope(filepath.Dir(dir))
+	path := filepath.Join(n.root, dir, IgnoreFileName)
+	if data, err := os.ReadFile(path); err == nil {
+		if n.verbose {
+			log.Debug().Str("file", path).Msg("Loading .frameoignore")
+		}
+		lines := strings.Split(string(data), "\n")
+		plain := make([]string, len(lines))
+		for i, line := range lines {
+			plain[i] = strings.TrimPrefix(strings.TrimSpace(line), "!")
+		}
+		s = &ignoreScope{
+			dir:     dir,
+			ignorer: gitignore.CompileIgnoreLines(lines...),
+			matches: gitignore.CompileIgnoreLines(plain...),
+			parent:  s,
+		}
+	}
+
+	n.mu.Lock()
+	n.scopes[dir] = s
+	n.mu.Unlock()
+	return s
+}
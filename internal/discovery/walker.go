@@ -4,38 +4,158 @@ import (
 	"io/fs"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/metadata"
 )
 
 // File represents a file to be processed
 type File struct {
 	Path         string
 	RelativePath string
+
+	meta *metadata.Metadata // Loaded lazily by Metadata
+}
+
+// Metadata returns the file's metadata, reading it on first use.
+// Unreadable metadata results in an empty record.
+func (f *File) Metadata() *metadata.Metadata {
+	if f.meta == nil {
+		m, err := metadata.Read(f.Path)
+		if err != nil {
+			log.Debug().Err(err).Str("file", f.Path).Msg("Failed to read metadata")
+			m = &metadata.Metadata{Orientation: 1}
+		}
+		f.meta = m
+	}
+	return f.meta
+}
+
+// Filter selects which discovered files are processed
+type Filter interface {
+	Match(file *File) bool
 }
 
 // WalkFiles walks the input directory and sends valid files to the files channel.
+// Files rejected by any of the filters are treated like ignored files.
 // It closes the channel when done.
-func WalkFiles(root string, files chan<- File, matcher *IgnoreMatcher) {
+func WalkFiles(root string, files chan<- File, matcher *IgnoreMatcher, filters ...Filter) {
+	defer close(files)
+
+	newWalker(root, matcher, true).walk(root, nil, sendMatching(files, filters))
+}
+
+// WalkSubtrees walks the input directory like WalkFiles, with up to
+// workers top-level directories walked concurrently. Files arrive in no
+// particular order, which suits passes that only collect them. Filters
+// must be safe for concurrent use.
+func WalkSubtrees(root string, files chan<- File, matcher *IgnoreMatcher, workers int, filters ...Filter) {
 	defer close(files)
+	send := sendMatching(files, filters)
+	w := newWalker(root, matcher, true)
+
+	subtrees := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range subtrees {
+				w.walk(dir, nil, send)
+			}
+		}()
+	}
+
+	// Files at the top level are sent right away, directories go to the workers
+	w.walk(root, func(dir string) bool {
+		subtrees <- dir
+		return true
+	}, send)
+	close(subtrees)
+	wg.Wait()
+}
 
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+func sendMatching(files chan<- File, filters []Filter) func(File, fs.DirEntry) {
+	return func(file File, _ fs.DirEntry) {
+		for _, filter := range filters {
+			if !filter.Match(&file) {
+				log.Debug().Str("file", file.Path).Msg("Skipping filtered file")
+				return
+			}
+		}
+
+		// Valid image file that's not ignored
+		files <- file
+	}
+}
+
+// CountFiles walks the input directory like WalkFiles, without filters and
+// without logging, and calls found with the size of every valid file. It
+// is cheap enough to run alongside processing to estimate the total work.
+func CountFiles(root string, matcher *IgnoreMatcher, found func(size int64)) {
+	newWalker(root, matcher, false).walk(root, nil, func(_ File, d fs.DirEntry) {
+		var size int64
+		if info, err := d.Info(); err == nil {
+			size = info.Size()
+		}
+		found(size)
+	})
+}
+
+// walker walks an input directory, skipping what the global ignore rules
+// or the ignore files of its subdirectories exclude
+type walker struct {
+	root    string
+	matcher *IgnoreMatcher
+	nested  *nestedIgnores
+	verbose bool
+}
+
+func newWalker(root string, matcher *IgnoreMatcher, verbose bool) *walker {
+	return &walker{root: root, matcher: matcher, nested: newNestedIgnores(root, verbose), verbose: verbose}
+}
+
+// ignored reports whether a path is excluded. The nearest ignore file with
+// a rule for it decides, the global rules only apply without one.
+func (w *walker) ignored(relPath, path string, isDir bool) bool {
+	if ignored, decided := w.nested.decide(relPath); decided {
+		return ignored
+	}
+	return w.matcher.Matches(relPath, isDir) || w.matcher.Matches(path, isDir)
+}
+
+// walk calls visit for every image file under start that isn't ignored,
+// with paths relative to the root. split is offered every directory below
+// start; when it returns true, the directory is left out.
+func (w *walker) walk(start string, split func(dir string) bool, visit func(File, fs.DirEntry)) {
+	root, verbose := w.root, w.verbose
+	err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			log.Error().Err(err).Str("path", path).Msg("Error walking path")
+			if verbose {
+				log.Error().Err(err).Str("path", path).Msg("Error walking path")
+			}
 			return nil // Continue walking
 		}
 
 		relPath, err := filepath.Rel(root, path)
 		if err != nil {
-			log.Error().Err(err).Str("path", path).Msg("Error getting relative path")
+			if verbose {
+				log.Error().Err(err).Str("path", path).Msg("Error getting relative path")
+			}
 			return nil
 		}
 
 		// Skip directories early (but still check ignore rules for them)
 		if d.IsDir() {
 			// Check ignore rules for directories
-			if matcher.Matches(relPath, true) || matcher.Matches(path, true) {
-				log.Info().Str("path", path).Msg("Skipping ignored directory")
+			if w.ignored(relPath, path, true) {
+				if verbose {
+					log.Debug().Str("dir", path).Msg("Skipping ignored directory")
+				}
+				return filepath.SkipDir
+			}
+			if split != nil && path != start && split(path) {
 				return filepath.SkipDir
 			}
 			return nil
@@ -47,21 +167,18 @@ func WalkFiles(root string, files chan<- File, matcher *IgnoreMatcher) {
 		}
 
 		// Now check ignore rules (only for valid image files)
-		if matcher.Matches(relPath, false) || matcher.Matches(path, false) {
-			log.Info().Str("path", path).Msg("Skipping ignored file")
+		if w.ignored(relPath, path, false) {
+			if verbose {
+				log.Debug().Str("file", path).Msg("Skipping ignored file")
+			}
 			return nil
 		}
 
-		// Valid image file that's not ignored
-		files <- File{
-			Path:         path,
-			RelativePath: relPath,
-		}
-
+		visit(File{Path: path, RelativePath: relPath}, d)
 		return nil
 	})
 
-	if err != nil {
+	if err != nil && verbose {
 		log.Error().Err(err).Msg("Error walking directory")
 	}
 }
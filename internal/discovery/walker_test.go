@@ -64,6 +64,21 @@ func TestIgnoreMatcher(t *testing.T) {
 	}
 }
 
+func TestIgnoreMatcher_Merged(t *testing.T) {
+	tmpDir := t.TempDir()
+	explicit := filepath.Join(tmpDir, "global-ignore")
+	require.NoError(t, os.WriteFile(explicit, []byte("*.png.jpg\nprivate/\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".frameoignore"), []byte("!private/\nold/\n"), 0644))
+
+	// The input directory's rules come on top of the global file
+	matcher, err := NewIgnoreMatcher(explicit, tmpDir)
+	require.NoError(t, err)
+	assert.True(t, matcher.Matches("shot.png.jpg", false))
+	assert.True(t, matcher.Matches("old/photo.jpg", false))
+	assert.False(t, matcher.Matches("private/photo.jpg", false))
+	assert.False(t, matcher.Matches("photo.jpg", false))
+}
+
 func TestWalkFiles_UserScenario(t *testing.T) {
 	// Simulate the user's exact scenario
 	// root/
@@ -115,3 +130,105 @@ func TestWalkFiles_UserScenario(t *testing.T) {
 	// Should NOT be found
 	assert.False(t, found, "File should have been ignored")
 }
+
+type nameFilter string
+
+func (f nameFilter) Match(file *File) bool {
+	return filepath.Base(file.Path) != string(f)
+}
+
+func TestWalkFiles_Filters(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "frameo-filter-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	for _, name := range []string{"keep.jpg", "drop.jpg", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte("x"), 0644))
+	}
+
+	files := make(chan File, 10)
+	go WalkFiles(tmpDir, files, &IgnoreMatcher{}, nameFilter("drop.jpg"))
+
+	var found []string
+	for f := range files {
+		found = append(found, f.RelativePath)
+	}
+	assert.Equal(t, []string{"keep.jpg"}, found)
+}
+
+func TestWalkFiles_NestedIgnoreFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	ignoreFiles := map[string]string{
+		".frameoignore":            "*.tmp.jpg\nscreenshots/\n",
+		"2020/.frameoignore":       "drafts/\n!keep.tmp.jpg\n",
+		"2020/trip/.frameoignore":  "*.jpg\n!best.jpg\n",
+		"2021/.frameoignore":       "# Nothing here\n",
+		"2021/party/.frameoignore": "!*.tmp.jpg\n",
+	}
+	for name, content := range ignoreFiles {
+		path := filepath.Join(tmpDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	for _, name := range []string{
+		"a.jpg", "a.tmp.jpg", "screenshots/s.jpg",
+		"2020/b.jpg", "2020/keep.tmp.jpg", "2020/other.tmp.jpg", "2020/drafts/c.jpg",
+		"2020/trip/d.jpg", "2020/trip/best.jpg",
+		"2021/e.jpg", "2021/e.tmp.jpg", "2021/party/f.tmp.jpg",
+		"2022/drafts/g.jpg",
+	} {
+		path := filepath.Join(tmpDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	}
+	matcher, err := NewIgnoreMatcher("", tmpDir)
+	require.NoError(t, err)
+
+	files := make(chan File, 20)
+	go WalkFiles(tmpDir, files, matcher)
+
+	var found []string
+	for f := range files {
+		found = append(found, f.RelativePath)
+	}
+
+	// Rules apply to their directory and below, the nearest file decides,
+	// and the global rules still apply where no nested file has a rule
+	assert.ElementsMatch(t, []string{
+		"a.jpg",
+		"2020/b.jpg", "2020/keep.tmp.jpg",
+		"2020/trip/best.jpg",
+		"2021/e.jpg", "2021/party/f.tmp.jpg",
+		"2022/drafts/g.jpg",
+	}, found)
+}
+
+func TestWalkSubtrees(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".frameoignore"), []byte("skip/\n"), 0644))
+	for _, name := range []string{"top.jpg", "2020/a.jpg", "2020/trip/b.jpg", "2021/c.jpg", "2021/drop.jpg", "skip/d.jpg"} {
+		path := filepath.Join(tmpDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	}
+	matcher, err := NewIgnoreMatcher("", tmpDir)
+	require.NoError(t, err)
+
+	files := make(chan File, 10)
+	go WalkSubtrees(tmpDir, files, matcher, 3, nameFilter("drop.jpg"))
+
+	var found []string
+	for f := range files {
+		found = append(found, f.RelativePath)
+	}
+	assert.ElementsMatch(t, []string{"top.jpg", "2020/a.jpg", "2020/trip/b.jpg", "2021/c.jpg"}, found)
+}
+
+func TestFile_Metadata(t *testing.T) {
+	// Unreadable files still produce an empty record
+	f := File{Path: "/nonexistent/photo.jpg"}
+	m := f.Metadata()
+	require.NotNil(t, m)
+	assert.True(t, m.Taken.IsZero())
+	assert.Same(t, m, f.Metadata(), "metadata is cached")
+}
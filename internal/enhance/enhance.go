@@ -0,0 +1,156 @@
+package enhance
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Step is one adjustment of the chain
+type Step struct {
+	Name   string
+	Amount float64
+}
+
+// Pipeline is a chain of steps, applied in order
+type Pipeline []Step
+
+// steps lists the supported steps with their default amounts
+var steps = map[string]struct {
+	def      float64
+	min, max float64
+}{
+	"levels":     {0.5, 0, 10},    // Percent of darkest and brightest pixels clipped
+	"contrast":   {10, -100, 100}, // Percent
+	"gamma":      {1.1, 0.1, 10},  // Above 1 brightens midtones
+	"saturation": {15, -100, 500}, // Percent
+	"sharpen":    {0.6, 0, 5},     // Unsharp mask strength for a 4x reduction
+}
+
+// Parse reads steps written as "name" or "name=amount", e.g.
+// "levels", "sharpen=0.8" or "saturation=20"
+func Parse(specs []string) (Pipeline, error) {
+	var p Pipeline
+	for _, spec := range specs {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(spec), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		def, ok := steps[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid enhancement step: %s (expected levels, contrast, gamma, saturation or sharpen)", name)
+		}
+
+		step := Step{Name: name, Amount: def.def}
+		if hasValue {
+			amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid amount for %s: %s", name, value)
+			}
+			if amount < def.min || amount > def.max {
+				return nil, fmt.Errorf("amount for %s out of range: %g (expected %g to %g)", name, amount, def.min, def.max)
+			}
+			step.Amount = amount
+		}
+		p = append(p, step)
+	}
+	return p, nil
+}
+
+// Apply runs the chain on a resized image. reduction is how many times
+// the source was scaled down, stronger reductions get more sharpening.
+func (p Pipeline) Apply(img image.Image, reduction float64) image.Image {
+	for _, step := range p {
+		switch step.Name {
+		case "levels":
+			img = Levels(img, step.Amount/100)
+		case "contrast":
+			img = imaging.AdjustContrast(img, step.Amount)
+		case "gamma":
+			img = imaging.AdjustGamma(img, step.Amount)
+		case "saturation":
+			img = imaging.AdjustSaturation(img, step.Amount)
+		case "sharpen":
+			img = Sharpen(img, sharpenAmount(step.Amount, reduction))
+		}
+	}
+	return img
+}
+
+// sharpenAmount scales the strength with the reduction, reaching the full
+// amount at 4x. Resampling softens more the more pixels it merges, while
+// images that weren't reduced need no sharpening at all.
+func sharpenAmount(amount, reduction float64) float64 {
+	if reduction <= 1 {
+		return 0
+	}
+	return amount * math.Min(math.Log2(reduction)/2, 1)
+}
+
+// Levels stretches the luminance range so that the given fraction of the
+// darkest and brightest pixels clips. All channels are stretched alike,
+// so colours don't shift.
+func Levels(img image.Image, clip float64) *image.NRGBA {
+	dst := imaging.Clone(img)
+	n := dst.Rect.Dx() * dst.Rect.Dy()
+	if n == 0 {
+		return dst
+	}
+
+	var hist [256]int
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		hist[luma(dst.Pix[i:])]++
+	}
+	limit := int(clip * float64(n))
+	lo, hi := 0, 255
+	for count := hist[lo]; lo < 254 && count <= limit; count += hist[lo] {
+		lo++
+	}
+	for count := hist[hi]; hi > lo+1 && count <= limit; count += hist[hi] {
+		hi--
+	}
+	if lo == 0 && hi == 255 {
+		return dst
+	}
+
+	var table [256]uint8
+	for v := range table {
+		table[v] = uint8(math.Round(math.Max(0, math.Min(255, float64(v-lo)*255/float64(hi-lo)))))
+	}
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		dst.Pix[i] = table[dst.Pix[i]]
+		dst.Pix[i+1] = table[dst.Pix[i+1]]
+		dst.Pix[i+2] = table[dst.Pix[i+2]]
+	}
+	return dst
+}
+
+func luma(pix []uint8) uint8 {
+	return uint8((299*int(pix[0]) + 587*int(pix[1]) + 114*int(pix[2]) + 500) / 1000)
+}
+
+// sharpenSigma is the blur radius of the unsharp mask, matched to the
+// width of the edges resampling leaves behind
+const sharpenSigma = 0.8
+
+// Sharpen applies an unsharp mask of the given strength, 1 adds the full
+// difference to the blurred image back
+func Sharpen(img image.Image, amount float64) image.Image {
+	if amount <= 0 {
+		return img
+	}
+	dst := imaging.Clone(img)
+	blurred := imaging.Blur(dst, sharpenSigma)
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		for c := i; c < i+3; c++ {
+			v := float64(dst.Pix[c]) + amount*(float64(dst.Pix[c])-float64(blurred.Pix[c]))
+			dst.Pix[c] = uint8(math.Round(math.Max(0, math.Min(255, v))))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,76 @@
+package enhance
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]string{"levels", " sharpen = 0.8", "Saturation=20", ""})
+	require.NoError(t, err)
+	assert.Equal(t, Pipeline{{"levels", 0.5}, {"sharpen", 0.8}, {"saturation", 20}}, p)
+
+	_, err = Parse([]string{"vignette"})
+	assert.Error(t, err)
+	_, err = Parse([]string{"gamma=0"})
+	assert.Error(t, err)
+	_, err = Parse([]string{"contrast=much"})
+	assert.Error(t, err)
+}
+
+func TestLevels(t *testing.T) {
+	// A dull gradient from 64 to 191
+	img := image.NewNRGBA(image.Rect(0, 0, 128, 1))
+	for x := 0; x < 128; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{uint8(64 + x), uint8(64 + x), uint8(64 + x), 255})
+	}
+
+	out := Levels(img, 0)
+	assert.Equal(t, uint8(0), out.Pix[0])
+	assert.Equal(t, uint8(255), out.Pix[127*4])
+	assert.Equal(t, uint8(64), img.Pix[0], "source image must not change")
+
+	// Nothing to stretch in a full range image
+	img.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	img.SetNRGBA(127, 0, color.NRGBA{255, 255, 255, 255})
+	assert.Equal(t, img.Pix, Levels(img, 0).Pix)
+}
+
+func TestSharpen(t *testing.T) {
+	// A soft edge gets steeper
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			v := uint8(min(255, max(0, (x-6)*64)))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	out := imaging.Clone(Sharpen(img, 1))
+	assert.Less(t, out.NRGBAAt(7, 8).R, img.NRGBAAt(7, 8).R)
+	assert.Greater(t, out.NRGBAAt(9, 8).R, img.NRGBAAt(9, 8).R)
+
+	assert.Same(t, img, Sharpen(img, 0))
+}
+
+func TestSharpenAmount(t *testing.T) {
+	assert.Equal(t, 0.0, sharpenAmount(1, 1))
+	assert.InDelta(t, 0.5, sharpenAmount(1, 2), 1e-9)
+	assert.Equal(t, 1.0, sharpenAmount(1, 4))
+	assert.Equal(t, 1.0, sharpenAmount(1, 10))
+}
+
+func TestPipeline_Apply(t *testing.T) {
+	img := imaging.New(4, 4, color.NRGBA{200, 150, 150, 255})
+
+	p, err := Parse([]string{"saturation=50"})
+	require.NoError(t, err)
+	out := imaging.Clone(p.Apply(img, 3))
+	assert.Less(t, out.NRGBAAt(0, 0).G, uint8(150), "saturation boost moves colours away from gray")
+
+	assert.Same(t, img, Pipeline(nil).Apply(img, 3))
+}
@@ -0,0 +1,164 @@
+package faces
+
+import (
+	_ "embed"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	pigo "github.com/esimov/pigo/core"
+)
+
+// cascade is the frontal face classifier shipped with pigo
+// (github.com/esimov/pigo, MIT License, Copyright (c) 2018 Endre Simo)
+//
+//go:embed facefinder
+var cascade []byte
+
+// MinScore is the detection score below which a candidate is not a face
+const MinScore = 5.0
+
+// detectSize is the longer side images are reduced to before detection.
+// Faces smaller than about 3% of it are not found.
+const detectSize = 640
+
+// Face is a detected face in image coordinates
+type Face struct {
+	Rect  image.Rectangle
+	Score float32
+}
+
+var (
+	classifierOnce sync.Once
+	classifier     *pigo.Pigo
+)
+
+func loadClassifier() {
+	c, err := pigo.NewPigo().Unpack(cascade)
+	if err != nil {
+		panic(fmt.Sprintf("invalid face cascade: %v", err))
+	}
+	classifier = c
+}
+
+// Detect finds frontal faces in the image, ordered from left to right.
+// It runs on the CPU and is safe for concurrent use.
+func Detect(img image.Image) []Face {
+	classifierOnce.Do(loadClassifier)
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return nil
+	}
+
+	// Detection on a reduced copy is much faster and just as reliable
+	scale := 1.0
+	if long := max(w, h); long > detectSize {
+		scale = float64(detectSize) / float64(long)
+	}
+	small := imaging.Resize(img, max(int(float64(w)*scale), 1), max(int(float64(h)*scale), 1), imaging.Box)
+	cols, rows := small.Bounds().Dx(), small.Bounds().Dy()
+
+	params := pigo.CascadeParams{
+		MinSize:     20,
+		MaxSize:     min(cols, rows),
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+		ImageParams: pigo.ImageParams{
+			Pixels: grayscale(small),
+			Rows:   rows,
+			Cols:   cols,
+			Dim:    cols,
+		},
+	}
+	detections := classifier.ClusterDetections(classifier.RunCascade(params, 0), 0.2)
+
+	var result []Face
+	for _, d := range detections {
+		if d.Q < MinScore {
+			continue
+		}
+		half := float64(d.Scale) / 2
+		r := image.Rect(
+			int((float64(d.Col)-half)/scale), int((float64(d.Row)-half)/scale),
+			int((float64(d.Col)+half)/scale), int((float64(d.Row)+half)/scale),
+		).Add(bounds.Min).Intersect(bounds)
+		if !r.Empty() {
+			result = append(result, Face{Rect: r, Score: d.Q})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Rect.Min.X < result[j].Rect.Min.X })
+	return result
+}
+
+func grayscale(img *image.NRGBA) []uint8 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	gray := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			r, g, b := row[x*4], row[x*4+1], row[x*4+2]
+			gray[y*w+x] = uint8((299*int(r) + 587*int(g) + 114*int(b)) / 1000)
+		}
+	}
+	return gray
+}
+
+// Window returns the largest window with the given aspect ratio (width
+// over height) that fits in bounds, placed to keep as many faces inside as
+// possible. Without faces the window is centred.
+func Window(bounds image.Rectangle, aspect float64, faces []Face) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 || aspect <= 0 {
+		return bounds
+	}
+	winW, winH := w, int(float64(w)/aspect+0.5)
+	if winH > h {
+		winW, winH = int(float64(h)*aspect+0.5), h
+	}
+	winW, winH = min(max(winW, 1), w), min(max(winH, 1), h)
+
+	// Biggest faces first, a group that doesn't fit keeps the main subjects
+	sorted := append([]Face(nil), faces...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return area(sorted[i].Rect) > area(sorted[j].Rect)
+	})
+	var keep image.Rectangle
+	for _, f := range sorted {
+		r := headroom(f.Rect).Intersect(bounds)
+		u := keep.Union(r)
+		if u.Dx() > winW || u.Dy() > winH {
+			if keep.Empty() {
+				keep = r // Even the biggest face is cut, at least centre on it
+			}
+			continue
+		}
+		keep = u
+	}
+
+	center := image.Pt(bounds.Min.X+w/2, bounds.Min.Y+h/2)
+	if !keep.Empty() {
+		center = image.Pt((keep.Min.X+keep.Max.X)/2, (keep.Min.Y+keep.Max.Y)/2)
+	}
+	x := clamp(center.X-winW/2, bounds.Min.X, bounds.Max.X-winW)
+	y := clamp(center.Y-winH/2, bounds.Min.Y, bounds.Max.Y-winH)
+	return image.Rect(x, y, x+winW, y+winH)
+}
+
+// headroom grows a face box to cover hair and chin, which the detector
+// leaves out
+func headroom(r image.Rectangle) image.Rectangle {
+	dx, dy := r.Dx()/5, r.Dy()/3
+	return image.Rect(r.Min.X-dx, r.Min.Y-dy, r.Max.X+dx, r.Max.Y+dy/2)
+}
+
+func area(r image.Rectangle) int {
+	return r.Dx() * r.Dy()
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
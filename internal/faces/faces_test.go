@@ -0,0 +1,75 @@
+package faces
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadFace(t *testing.T) image.Image {
+	img, err := imaging.Open("testdata/face.jpg")
+	require.NoError(t, err)
+	return img
+}
+
+func TestDetect(t *testing.T) {
+	img := loadFace(t)
+
+	found := Detect(img)
+	require.Len(t, found, 1)
+
+	// The portrait is centred, between the ears and from forehead to chin
+	face := found[0].Rect
+	b := img.Bounds()
+	assert.InDelta(t, b.Dx()/2, (face.Min.X+face.Max.X)/2, float64(b.Dx())/10)
+	assert.InDelta(t, b.Dy()/2, (face.Min.Y+face.Max.Y)/2, float64(b.Dy())/5)
+	assert.Greater(t, face.Dx(), b.Dx()/3)
+}
+
+func TestDetect_NoFaces(t *testing.T) {
+	assert.Empty(t, Detect(imaging.New(800, 600, color.NRGBA{120, 160, 200, 255})))
+	assert.Empty(t, Detect(image.NewNRGBA(image.Rect(0, 0, 0, 0))))
+}
+
+func TestDetect_LargeImage(t *testing.T) {
+	// A face in the right part of a wide, high resolution photo
+	canvas := imaging.New(4000, 1500, color.NRGBA{235, 235, 235, 255})
+	face := imaging.Resize(loadFace(t), 0, 1200, imaging.Lanczos)
+	canvas = imaging.Paste(canvas, face, image.Pt(3000, 150))
+
+	found := Detect(canvas)
+	require.Len(t, found, 1)
+	assert.Greater(t, found[0].Rect.Min.X, 2900)
+}
+
+func TestWindow(t *testing.T) {
+	bounds := image.Rect(0, 0, 4000, 1500)
+
+	// Centred without faces
+	assert.Equal(t, image.Rect(1000, 0, 3000, 1500), Window(bounds, 4.0/3, nil))
+
+	// Slides right to keep a face at the edge
+	faces := []Face{{Rect: image.Rect(3300, 500, 3800, 1000)}}
+	w := Window(bounds, 4.0/3, faces)
+	assert.Equal(t, 2000, w.Dx())
+	assert.True(t, faces[0].Rect.In(w), "face %v must be inside %v", faces[0].Rect, w)
+
+	// Faces too far apart keep the biggest one
+	faces = []Face{
+		{Rect: image.Rect(100, 500, 400, 800)},
+		{Rect: image.Rect(3300, 400, 3900, 1000)},
+	}
+	w = Window(bounds, 4.0/3, faces)
+	assert.True(t, faces[1].Rect.In(w))
+	assert.False(t, faces[0].Rect.In(w))
+
+	// Portrait window in a portrait photo moves vertically
+	bounds = image.Rect(0, 0, 1000, 3000)
+	faces = []Face{{Rect: image.Rect(400, 200, 600, 400)}}
+	w = Window(bounds, 1, faces)
+	assert.Equal(t, image.Rect(0, 0, 1000, 1000), w)
+}
@@ -0,0 +1,155 @@
+package filter
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tgagor/frameo-miniatures/internal/geo"
+	"github.com/tgagor/frameo-miniatures/internal/metadata"
+)
+
+// Record is the information a filter expression is evaluated against
+type Record struct {
+	Path string // Path relative to the input directory
+	Meta *metadata.Metadata
+	// Faces is the number of faces in the photo, nil when not detected
+	Faces *int
+}
+
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindNumber
+	kindDate
+	kindBool
+	kindList // Compared item by item, == matches when any item equals
+)
+
+// field describes a value available in expressions. get returns false when
+// the value is unknown for the record.
+type field struct {
+	kind  fieldKind
+	meta  bool // Needs file metadata
+	faces bool // Needs face detection, which decodes the whole image
+	get   func(r *Record) (interface{}, bool)
+}
+
+func pathField(fn func(p string) string) field {
+	return field{kind: kindString, get: func(r *Record) (interface{}, bool) {
+		return fn(filepath.ToSlash(r.Path)), true
+	}}
+}
+
+func metaField(kind fieldKind, fn func(m *metadata.Metadata) (interface{}, bool)) field {
+	return field{kind: kind, meta: true, get: func(r *Record) (interface{}, bool) {
+		if r.Meta == nil {
+			return nil, false
+		}
+		return fn(r.Meta)
+	}}
+}
+
+func dateField(fn func(t time.Time) interface{}) field {
+	kind := kindNumber
+	if _, ok := fn(time.Time{}).(time.Time); ok {
+		kind = kindDate
+	}
+	return metaField(kind, func(m *metadata.Metadata) (interface{}, bool) {
+		if m.Taken.IsZero() {
+			return nil, false
+		}
+		return fn(m.Taken), true
+	})
+}
+
+func textField(fn func(m *metadata.Metadata) string) field {
+	return metaField(kindString, func(m *metadata.Metadata) (interface{}, bool) {
+		s := fn(m)
+		return s, s != ""
+	})
+}
+
+func placeField(fn func(p geo.Place) string) field {
+	return metaField(kindString, func(m *metadata.Metadata) (interface{}, bool) {
+		if !m.HasGPS {
+			return nil, false
+		}
+		place, ok := geo.Lookup(m.Latitude, m.Longitude)
+		if !ok {
+			return nil, false
+		}
+		return fn(place), true
+	})
+}
+
+func facesField(kind fieldKind, fn func(n int) interface{}) field {
+	return field{kind: kind, faces: true, get: func(r *Record) (interface{}, bool) {
+		if r.Faces == nil {
+			return nil, false
+		}
+		return fn(*r.Faces), true
+	}}
+}
+
+func sizeField(fn func(m *metadata.Metadata) float64) field {
+	return metaField(kindNumber, func(m *metadata.Metadata) (interface{}, bool) {
+		return fn(m), m.Width > 0 && m.Height > 0
+	})
+}
+
+var fields = map[string]field{
+	// Location in the input tree
+	"path": pathField(func(p string) string { return p }),
+	"name": pathField(path.Base),
+	"dir":  pathField(path.Dir),
+	"ext":  pathField(func(p string) string { return strings.TrimPrefix(strings.ToLower(path.Ext(p)), ".") }),
+
+	// Capture date
+	"date":  dateField(func(t time.Time) interface{} { return t }),
+	"year":  dateField(func(t time.Time) interface{} { return float64(t.Year()) }),
+	"month": dateField(func(t time.Time) interface{} { return float64(t.Month()) }),
+	"day":   dateField(func(t time.Time) interface{} { return float64(t.Day()) }),
+
+	// Camera
+	"make":  textField(func(m *metadata.Metadata) string { return m.Make }),
+	"model": textField(func(m *metadata.Metadata) string { return m.Model }),
+	"camera": textField(func(m *metadata.Metadata) string {
+		return strings.TrimSpace(m.Make + " " + m.Model)
+	}),
+
+	// Dimensions as displayed
+	"width":      sizeField(func(m *metadata.Metadata) float64 { return float64(m.Width) }),
+	"height":     sizeField(func(m *metadata.Metadata) float64 { return float64(m.Height) }),
+	"megapixels": sizeField(func(m *metadata.Metadata) float64 { return float64(m.Width*m.Height) / 1e6 }),
+	"orientation": metaField(kindString, func(m *metadata.Metadata) (interface{}, bool) {
+		switch {
+		case m.Landscape():
+			return "landscape", true
+		case m.Portrait():
+			return "portrait", true
+		}
+		return "square", m.Width > 0
+	}),
+	"landscape": metaField(kindBool, func(m *metadata.Metadata) (interface{}, bool) { return m.Landscape(), true }),
+	"portrait":  metaField(kindBool, func(m *metadata.Metadata) (interface{}, bool) { return m.Portrait(), true }),
+
+	// Location
+	"gps":     metaField(kindBool, func(m *metadata.Metadata) (interface{}, bool) { return m.HasGPS, true }),
+	"city":    placeField(func(p geo.Place) string { return p.City }),
+	"country": placeField(func(p geo.Place) string { return p.Country }),
+	"place":   placeField(geo.Place.String),
+
+	// Ratings and tags from XMP, unrated photos have rating 0
+	"rating":   metaField(kindNumber, func(m *metadata.Metadata) (interface{}, bool) { return float64(m.Rating), true }),
+	"label":    textField(func(m *metadata.Metadata) string { return m.Label }),
+	"tag":      metaField(kindList, func(m *metadata.Metadata) (interface{}, bool) { return m.Keywords, true }),
+	"picked":   metaField(kindBool, func(m *metadata.Metadata) (interface{}, bool) { return m.Pick > 0, true }),
+	"rejected": metaField(kindBool, func(m *metadata.Metadata) (interface{}, bool) { return m.Pick < 0, true }),
+
+	// People, found by face detection
+	"faces":  facesField(kindNumber, func(n int) interface{} { return float64(n) }),
+	"people": facesField(kindBool, func(n int) interface{} { return n > 0 }),
+}
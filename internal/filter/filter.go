@@ -0,0 +1,445 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+)
+
+// Filter is a compiled filter expression, for example:
+//
+//	year >= 2019 && year <= 2022 && model ~ "EOS" && landscape
+//
+// It implements discovery.Filter.
+type Filter struct {
+	src        string
+	root       node
+	needsMeta  bool
+	needsFaces bool
+	faceCounts []int // Face counts covering every outcome of the expression
+
+	// CountFaces detects faces for the faces and people fields. Without it
+	// those fields are unknown and comparisons with them don't match.
+	CountFaces func(path string) (int, error)
+	// DeferFaces leaves the faces and people fields to MatchFaces, called
+	// once the photo is decoded anyway. Match then passes files that some
+	// number of faces would let through.
+	DeferFaces bool
+}
+
+// Parse compiles a filter expression
+func Parse(src string) (*Filter, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return &Filter{src: src, root: root, needsMeta: p.needsMeta, needsFaces: p.needsFaces, faceCounts: p.faceCounts()}, nil
+}
+
+// String returns the source expression
+func (f *Filter) String() string {
+	return f.src
+}
+
+// MinRating returns a filter accepting photos rated at least n stars
+func MinRating(n int) *Filter {
+	return &Filter{
+		src:       fmt.Sprintf("rating >= %d", n),
+		root:      compareNode{field: fields["rating"], op: ">=", value: float64(n)},
+		needsMeta: true,
+	}
+}
+
+// ExcludeTags returns a filter rejecting photos tagged with any of the tags.
+// At least one tag is required.
+func ExcludeTags(tags []string) *Filter {
+	var root node
+	var src []string
+	for _, tag := range tags {
+		n := compareNode{field: fields["tag"], op: "!=", value: tag}
+		if root == nil {
+			root = n
+		} else {
+			root = andNode{root, n}
+		}
+		src = append(src, fmt.Sprintf("tag != %q", tag))
+	}
+	return &Filter{src: strings.Join(src, " && "), root: root, needsMeta: true}
+}
+
+// NeedsFaces reports whether the expression refers to faces
+func (f *Filter) NeedsFaces() bool {
+	return f.needsFaces
+}
+
+// Match evaluates the filter against a discovered file.
+// Metadata is only read and faces only detected when the expression
+// refers to them.
+func (f *Filter) Match(file *discovery.File) bool {
+	r := Record{Path: file.RelativePath}
+	if f.needsMeta {
+		r.Meta = file.Metadata()
+	}
+	if f.needsFaces && f.DeferFaces {
+		for _, n := range f.faceCounts {
+			r.Faces = &n
+			if f.Eval(&r) {
+				return true
+			}
+		}
+		return false
+	}
+	if f.needsFaces && f.CountFaces != nil {
+		n, err := f.CountFaces(file.Path)
+		if err != nil {
+			log.Debug().Err(err).Str("file", file.Path).Msg("Failed to detect faces")
+		} else {
+			r.Faces = &n
+		}
+	}
+	return f.Eval(&r)
+}
+
+// MatchFaces evaluates the filter against a file with a known number of faces
+func (f *Filter) MatchFaces(file *discovery.File, faces int) bool {
+	r := Record{Path: file.RelativePath, Faces: &faces}
+	if f.needsMeta {
+		r.Meta = file.Metadata()
+	}
+	return f.Eval(&r)
+}
+
+// Eval evaluates the filter against a record
+func (f *Filter) Eval(r *Record) bool {
+	return f.root.eval(r)
+}
+
+type node interface {
+	eval(r *Record) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(r *Record) bool { return n.left.eval(r) && n.right.eval(r) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(r *Record) bool { return n.left.eval(r) || n.right.eval(r) }
+
+type notNode struct{ inner node }
+
+func (n notNode) eval(r *Record) bool { return !n.inner.eval(r) }
+
+type boolNode struct{ field field }
+
+func (n boolNode) eval(r *Record) bool {
+	v, ok := n.field.get(r)
+	return ok && v.(bool)
+}
+
+// compareNode compares a field with a literal. Unknown values (e.g. a photo
+// without EXIF date) never match, except for "!=".
+type compareNode struct {
+	field field
+	op    string
+	value interface{}
+	re    *regexp.Regexp
+}
+
+func (n compareNode) eval(r *Record) bool {
+	v, ok := n.field.get(r)
+	if !ok {
+		return n.op == "!=" || n.op == "!~"
+	}
+
+	switch n.field.kind {
+	case kindString:
+		s := v.(string)
+		switch n.op {
+		case "~":
+			return n.re.MatchString(s)
+		case "!~":
+			return !n.re.MatchString(s)
+		}
+		return compare(strings.Compare(strings.ToLower(s), strings.ToLower(n.value.(string))), n.op)
+	case kindNumber:
+		a, b := v.(float64), n.value.(float64)
+		switch {
+		case a < b:
+			return compare(-1, n.op)
+		case a > b:
+			return compare(1, n.op)
+		}
+		return compare(0, n.op)
+	case kindDate:
+		return compare(n.value.(dateRange).compare(v.(time.Time)), n.op)
+	case kindBool:
+		return compare(boolCompare(v.(bool), n.value.(bool)), n.op)
+	case kindList:
+		found := false
+		for _, item := range v.([]string) {
+			if n.re != nil {
+				found = n.re.MatchString(item)
+			} else {
+				found = strings.EqualFold(item, n.value.(string))
+			}
+			if found {
+				break
+			}
+		}
+		if n.op == "!=" || n.op == "!~" {
+			return !found
+		}
+		return found
+	}
+	return false
+}
+
+func boolCompare(a, b bool) int {
+	if a == b {
+		return 0
+	}
+	return 1
+}
+
+// compare applies an operator to the result of a three-way comparison
+func compare(c int, op string) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+type parser struct {
+	tokens     []token
+	pos        int
+	needsMeta  bool
+	needsFaces bool
+	faceLimits []float64 // Numbers the face count is compared with
+}
+
+// faceCounts returns a face count from every range the compared numbers
+// split the counts into, so trying them all tells whether any count matches
+func (p *parser) faceCounts() []int {
+	if !p.needsFaces {
+		return nil
+	}
+	seen := map[int]bool{0: true, 1: true}
+	for _, v := range p.faceLimits {
+		for _, n := range []float64{math.Floor(v) - 1, math.Floor(v), math.Ceil(v), math.Ceil(v) + 1} {
+			if n >= 0 && n <= math.MaxInt32 {
+				seen[int(n)] = true
+			}
+		}
+	}
+	counts := make([]int, 0, len(seen))
+	for n := range seen {
+		counts = append(counts, n)
+	}
+	sort.Ints(counts)
+	return counts
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at position %d", closing.pos)
+		}
+		return inner, nil
+	case tokIdent:
+		return p.parseComparison(t)
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *parser) parseComparison(name token) (node, error) {
+	f, ok := fields[strings.ToLower(name.text)]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", name.text, name.pos)
+	}
+	if f.meta {
+		p.needsMeta = true
+	}
+	if f.faces {
+		p.needsFaces = true
+	}
+
+	if p.peek().kind != tokOp {
+		if f.kind != kindBool {
+			return nil, fmt.Errorf("field %q needs a comparison", name.text)
+		}
+		return boolNode{f}, nil
+	}
+	op := p.next().text
+
+	lit := p.next()
+	if lit.kind != tokString && lit.kind != tokNumber && lit.kind != tokIdent {
+		return nil, fmt.Errorf("expected a value after %s at position %d", op, lit.pos)
+	}
+
+	n := compareNode{field: f, op: op}
+	switch f.kind {
+	case kindString, kindList:
+		if f.kind == kindList && op != "==" && op != "!=" && op != "~" && op != "!~" {
+			return nil, fmt.Errorf("field %q only supports ==, !=, ~ and !~", name.text)
+		}
+		if op == "~" || op == "!~" {
+			re, err := regexp.Compile("(?i)" + lit.text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", lit.text, err)
+			}
+			n.re = re
+		}
+		n.value = lit.text
+	case kindNumber:
+		v, err := strconv.ParseFloat(lit.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("field %q expects a number, got %q", name.text, lit.text)
+		}
+		n.value = v
+		if f.faces {
+			p.faceLimits = append(p.faceLimits, v)
+		}
+	case kindDate:
+		v, err := parseDate(lit.text)
+		if err != nil {
+			return nil, fmt.Errorf("field %q expects a date (YYYY-MM-DD), got %q", name.text, lit.text)
+		}
+		n.value = v
+	case kindBool:
+		v, err := strconv.ParseBool(lit.text)
+		if err != nil {
+			return nil, fmt.Errorf("field %q expects true or false, got %q", name.text, lit.text)
+		}
+		n.value = v
+	}
+
+	if (op == "~" || op == "!~") && f.kind != kindString && f.kind != kindList {
+		return nil, fmt.Errorf("operator %s only works on text fields", op)
+	}
+	return n, nil
+}
+
+// dateRange is the span of time a date literal stands for: a whole month,
+// day or second. "date <= 2020-07-14" includes the whole 14th.
+type dateRange struct {
+	from, to time.Time // to is exclusive
+}
+
+// compare places t before (-1), within (0) or after (1) the range
+func (d dateRange) compare(t time.Time) int {
+	switch {
+	case t.Before(d.from):
+		return -1
+	case t.Before(d.to):
+		return 0
+	}
+	return 1
+}
+
+func parseDate(s string) (dateRange, error) {
+	layouts := []struct {
+		layout string
+		span   func(t time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01-02T15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l.layout, strings.ToUpper(s)); err == nil {
+			return dateRange{from: t, to: l.span(t)}, nil
+		}
+	}
+	return dateRange{}, fmt.Errorf("invalid date: %s", s)
+}
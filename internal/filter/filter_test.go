@@ -0,0 +1,253 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+	"github.com/tgagor/frameo-miniatures/internal/metadata"
+)
+
+func TestFilter_Eval(t *testing.T) {
+	dad := &Record{
+		Path: "2020/Holidays/IMG_0001.jpg",
+		Meta: &metadata.Metadata{
+			Taken:  time.Date(2020, 7, 14, 10, 0, 0, 0, time.UTC),
+			Make:   "Canon",
+			Model:  "Canon EOS 5D Mark II",
+			Width:  5616,
+			Height: 3744,
+			HasGPS: true,
+		},
+	}
+	scan := &Record{
+		Path: "Scans/grandma.jpg",
+		Meta: &metadata.Metadata{Width: 1200, Height: 1800},
+	}
+
+	tests := []struct {
+		expr string
+		dad  bool
+		scan bool
+	}{
+		{"year >= 2019 && year <= 2022", true, false},
+		{"date >= 2020-07-01 and date < 2020-08-01", true, false},
+		{"make == canon", true, false},
+		{`model ~ "EOS 5D"`, true, false},
+		{`camera ~ "^canon"`, true, false},
+		{"make != canon", false, true},
+		{"landscape", true, false},
+		{"portrait", false, true},
+		{"orientation == portrait", false, true},
+		{"gps", true, false},
+		{"!gps", false, true},
+		{"not gps", false, true},
+		{`path ~ "^scans/"`, false, true},
+		{`dir == "2020/Holidays"`, true, false},
+		{"ext == jpg", true, true},
+		{"megapixels > 10", true, false},
+		{"width >= 1200 && (year < 2000 || !gps)", false, true},
+		{"gps == false", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := Parse(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.dad, f.Eval(dad), "dad")
+			assert.Equal(t, tt.scan, f.Eval(scan), "scan")
+		})
+	}
+}
+
+func TestFilter_Dates(t *testing.T) {
+	r := &Record{Meta: &metadata.Metadata{Taken: time.Date(2020, 7, 14, 10, 0, 0, 0, time.UTC)}}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// A date covers the whole day, a month the whole month
+		{"date <= 2020-07-14", true},
+		{"date == 2020-07-14", true},
+		{"date < 2020-07-14", false},
+		{"date > 2020-07-14", false},
+		{"date >= 2020-07-14", true},
+		{"date > 2020-07-13", true},
+		{"date <= 2020-06", false},
+		{"date == 2020-07", true},
+		{"date > 2020-07", false},
+		// Times need no quotes
+		{"date >= 2020-07-14T09:59:59", true},
+		{"date < 2020-07-14T10:00:01", true},
+		{"date == 2020-07-14T10:00:00", true},
+		{"date > 2020-07-14T10:00:00", false},
+		{"date < 2020-07-14t10:00:00", false},
+		{`date <= "2020-07-14T09:00:00"`, false},
+		{"date >= 2020-07-14T10:00:00 && gps == false", true},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, f.Eval(r), tt.expr)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"year >=",
+		"unknown == 1",
+		"year == abc",
+		"date > 2019",
+		"date > 2020-07-14T",
+		"date > 2020-07-14 10:00:00",
+		"make",
+		"(gps",
+		"gps)",
+		`model ~ "["`,
+		"year ~ 2019",
+		`name == "unterminated`,
+		"year # 2019",
+		"tag > private",
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestFilter_NeedsMeta(t *testing.T) {
+	f, err := Parse(`path ~ "vacation"`)
+	require.NoError(t, err)
+	assert.False(t, f.needsMeta, "path filters must not read files")
+
+	f, err = Parse(`path ~ "vacation" || gps`)
+	require.NoError(t, err)
+	assert.True(t, f.needsMeta)
+}
+
+func TestFilter_RatingsAndTags(t *testing.T) {
+	favourite := &Record{Meta: &metadata.Metadata{Rating: 5, Label: "green", Keywords: []string{"Beach", "People|Family"}, Pick: 1}}
+	private := &Record{Meta: &metadata.Metadata{Rating: 2, Keywords: []string{"private"}}}
+	unrated := &Record{Meta: &metadata.Metadata{}}
+
+	tests := []struct {
+		expr      string
+		favourite bool
+		private   bool
+		unrated   bool
+	}{
+		{"rating >= 3", true, false, false},
+		{"rating == 0", false, false, true},
+		{"tag == beach", true, false, false},
+		{"tag != Private", true, false, true},
+		{`tag ~ "^people[|]"`, true, false, false},
+		{"label == green", true, false, false},
+		{"picked", true, false, false},
+		{"!rejected", true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := Parse(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.favourite, f.Eval(favourite), "favourite")
+			assert.Equal(t, tt.private, f.Eval(private), "private")
+			assert.Equal(t, tt.unrated, f.Eval(unrated), "unrated")
+		})
+	}
+
+	assert.True(t, MinRating(3).Eval(favourite))
+	assert.False(t, MinRating(3).Eval(unrated))
+
+	exclude := ExcludeTags([]string{"private", "nsfw"})
+	assert.Equal(t, `tag != "private" && tag != "nsfw"`, exclude.String())
+	assert.True(t, exclude.Eval(favourite))
+	assert.False(t, exclude.Eval(private))
+}
+
+func TestFilter_Places(t *testing.T) {
+	rome := &Record{Meta: &metadata.Metadata{HasGPS: true, Latitude: 41.8902, Longitude: 12.4922}}
+	noGPS := &Record{Meta: &metadata.Metadata{}}
+
+	for expr, want := range map[string]bool{
+		"country == italy":  true,
+		"city == Rome":      true,
+		`place ~ "^rome, "`: true,
+		"country != Italy":  false,
+		"country == Poland": false,
+	} {
+		f, err := Parse(expr)
+		require.NoError(t, err)
+		assert.Equal(t, want, f.Eval(rome), expr)
+		assert.Equal(t, expr == "country != Italy", f.Eval(noGPS), "%s without GPS", expr)
+	}
+}
+
+func TestFilter_Faces(t *testing.T) {
+	two, none := 2, 0
+	group := &Record{Faces: &two}
+	landscape := &Record{Faces: &none}
+
+	for expr, want := range map[string]bool{
+		"people":     true,
+		"faces >= 2": true,
+		"faces == 1": false,
+		"!people":    false,
+	} {
+		f, err := Parse(expr)
+		require.NoError(t, err)
+		assert.True(t, f.needsFaces, expr)
+		assert.False(t, f.needsMeta, expr)
+		assert.Equal(t, want, f.Eval(group), expr)
+		assert.Equal(t, expr == "!people", f.Eval(landscape), "%s without faces", expr)
+	}
+
+	// Faces are only detected for expressions using them
+	var detected []string
+	count := func(path string) (int, error) {
+		detected = append(detected, path)
+		return 1, nil
+	}
+	f, err := Parse(`people && path ~ "family"`)
+	require.NoError(t, err)
+	f.CountFaces = count
+	assert.True(t, f.Match(&discovery.File{Path: "/photos/family/a.jpg", RelativePath: "family/a.jpg"}))
+
+	f, err = Parse(`path ~ "family"`)
+	require.NoError(t, err)
+	f.CountFaces = count
+	assert.True(t, f.Match(&discovery.File{Path: "/photos/family/b.jpg", RelativePath: "family/b.jpg"}))
+	assert.Equal(t, []string{"/photos/family/a.jpg"}, detected)
+}
+
+func TestFilter_DeferFaces(t *testing.T) {
+	file := &discovery.File{Path: "/photos/family/a.jpg", RelativePath: "family/a.jpg"}
+	for _, tc := range []struct {
+		expr  string
+		match bool // Before faces are known
+		faces map[int]bool
+	}{
+		{"faces >= 2", true, map[int]bool{0: false, 1: false, 2: true, 5: true}},
+		{"faces > 1 && faces < 3", true, map[int]bool{1: false, 2: true, 3: false}},
+		{"faces == 1.5", false, map[int]bool{1: false, 2: false}},
+		{"!people", true, map[int]bool{0: true, 1: false}},
+		{`people && path ~ "holiday"`, false, map[int]bool{1: false}},
+		{`faces <= 0.5 || path ~ "family"`, true, map[int]bool{0: true, 4: true}},
+	} {
+		f, err := Parse(tc.expr)
+		require.NoError(t, err)
+		assert.True(t, f.NeedsFaces(), tc.expr)
+		f.DeferFaces = true
+		f.CountFaces = func(string) (int, error) {
+			t.Fatalf("%s: faces detected while discovering files", tc.expr)
+			return 0, nil
+		}
+		assert.Equal(t, tc.match, f.Match(file), tc.expr)
+		for n, want := range tc.faces {
+			assert.Equal(t, want, f.MatchFaces(file, n), "%s with %d faces", tc.expr, n)
+		}
+	}
+}
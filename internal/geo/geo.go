@@ -0,0 +1,116 @@
+package geo
+
+import (
+	"math"
+	"sync"
+
+	"github.com/tidwall/cities"
+)
+
+// MaxDistance is the distance in km beyond which a photo is considered to
+// be taken nowhere near a known city
+const MaxDistance = 150
+
+const earthRadius = 6371.0 // km
+
+// cellSize is the size of the lookup grid cells in degrees
+const cellSize = 2
+
+// Place is the nearest known city to a location
+type Place struct {
+	City     string
+	Country  string
+	Distance float64 // km
+}
+
+// String formats the place as "City, Country"
+func (p Place) String() string {
+	if p.City == "" {
+		return p.Country
+	}
+	return p.City + ", " + p.Country
+}
+
+type cell struct{ lat, lon int }
+
+var (
+	gridOnce sync.Once
+	grid     map[cell][]int // Indexes into cities.Cities
+)
+
+// Lookup returns the nearest city to the coordinates, using the bundled
+// GeoNames based dataset of about 10,000 cities. No network is involved.
+func Lookup(lat, lon float64) (Place, bool) {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return Place{}, false
+	}
+	gridOnce.Do(buildGrid)
+
+	best, bestDist := -1, math.Inf(1)
+	origin := cellOf(lat, lon)
+
+	// Search rings of cells around the origin until no closer city can exist
+	for r := 0; r <= 180/cellSize; r++ {
+		for dlat := -r; dlat <= r; dlat++ {
+			for dlon := -r; dlon <= r; dlon++ {
+				if max(abs(dlat), abs(dlon)) != r {
+					continue // Inner cells were searched already
+				}
+				c := cell{origin.lat + dlat, wrapLon(origin.lon + dlon)}
+				for _, i := range grid[c] {
+					city := cities.Cities[i]
+					if d := distance(lat, lon, city.Latitude, city.Longitude); d < bestDist {
+						best, bestDist = i, d
+					}
+				}
+			}
+		}
+		// Cities in the next ring are at least r cells away, a degree
+		// of longitude being the shorter one
+		reach := float64(r) * cellSize * 111 * math.Max(math.Cos(lat*math.Pi/180), 0.01)
+		if (best >= 0 && bestDist <= reach) || reach > MaxDistance {
+			break
+		}
+	}
+
+	if best < 0 || bestDist > MaxDistance {
+		return Place{}, false
+	}
+	city := cities.Cities[best]
+	return Place{City: city.City, Country: city.Country, Distance: bestDist}, true
+}
+
+func buildGrid() {
+	grid = make(map[cell][]int)
+	for i, city := range cities.Cities {
+		c := cellOf(city.Latitude, city.Longitude)
+		grid[c] = append(grid[c], i)
+	}
+}
+
+func cellOf(lat, lon float64) cell {
+	return cell{int(math.Floor(lat / cellSize)), wrapLon(int(math.Floor(lon / cellSize)))}
+}
+
+// wrapLon keeps longitude cells in range across the antimeridian
+func wrapLon(c int) int {
+	n := 360 / cellSize
+	return ((c+n/2)%n+n)%n - n/2
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// distance returns the great-circle distance in km
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,54 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		city     string
+		country  string
+	}{
+		{"Colosseum", 41.8902, 12.4922, "Rome", "Italy"},
+		{"Wawel", 50.0540, 19.9354, "Krakow", "Poland"},
+		{"Sydney Opera House", -33.8568, 151.2153, "Sydney", "Australia"},
+		{"Golden Gate Bridge", 37.8199, -122.4783, "San Francisco", "United States"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			place, ok := Lookup(tt.lat, tt.lon)
+			require.True(t, ok)
+			assert.Equal(t, tt.city, place.City)
+			assert.Equal(t, tt.country, place.Country)
+			assert.Less(t, place.Distance, 25.0)
+			assert.Equal(t, tt.city+", "+tt.country, place.String())
+		})
+	}
+}
+
+func TestLookup_Nowhere(t *testing.T) {
+	// Middle of the Pacific
+	_, ok := Lookup(-30, -130)
+	assert.False(t, ok)
+
+	_, ok = Lookup(91, 0)
+	assert.False(t, ok)
+}
+
+func TestLookup_Antimeridian(t *testing.T) {
+	// Nearest cities of Fiji lie on both sides of 180 degrees
+	place, ok := Lookup(-16.8, 179.99)
+	require.True(t, ok)
+	assert.Equal(t, "Fiji", place.Country)
+}
+
+func TestDistance(t *testing.T) {
+	// Warsaw - Krakow is about 250 km
+	assert.InDelta(t, 252, distance(52.2297, 21.0122, 50.0647, 19.9450), 5)
+}
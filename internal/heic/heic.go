@@ -0,0 +1,316 @@
+package heic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/adrium/goheif"
+	"github.com/adrium/goheif/heif"
+	"github.com/adrium/goheif/heif/bmff"
+	"github.com/adrium/goheif/libde265"
+	"github.com/tgagor/frameo-miniatures/internal/icc"
+	"github.com/tgagor/frameo-miniatures/internal/tonemap"
+)
+
+// gainMapType identifies the HDR gain map Apple stores next to the photo
+const gainMapType = "urn:com:apple:photo:2020:aux:hdrgainmap"
+
+// Decode reads the primary image of a HEIC file.
+//
+// 8-bit SDR photos decode through goheif as before. Photos with more bits
+// per sample keep them and decode to *image.NRGBA64 in their own colour
+// space. PQ and HLG photos are tone mapped with op and converted to sRGB.
+// With tonemap.GainMap, Apple HDR gain maps are applied where present.
+func Decode(ra io.ReaderAt, op tonemap.Operator) (image.Image, error) {
+	file := heif.Open(ra)
+	item, err := file.PrimaryItem()
+	if err != nil {
+		return nil, err
+	}
+
+	colors, _ := icc.ReadHEIC(ra)
+	hdr := len(colors.ICC) == 0 && colors.NCLX != nil && colors.NCLX.HDR()
+	var gainMap *heif.Item
+	if op == tonemap.GainMap {
+		gainMap = findGainMap(ra, file, item.ID)
+	}
+
+	if !hdr && gainMap == nil && bitDepth(file, item) <= 8 {
+		return goheif.Decode(io.NewSectionReader(ra, 0, math.MaxInt64))
+	}
+
+	dec, err := libde265.NewDecoder(libde265.WithSafeEncoding(true))
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Free()
+
+	base, err := decodeItem(dec, file, item)
+	if err != nil {
+		return nil, err
+	}
+	conv := newConverter(colors.NCLX, base.depth)
+
+	switch {
+	case hdr:
+		return renderHDR(base, conv, colors.NCLX, op), nil
+	case gainMap != nil:
+		gain, err := decodeItem(dec, file, gainMap)
+		if err != nil {
+			// The photo itself is fine without its HDR highlights
+			return render(base, conv), nil
+		}
+		return renderGainMap(base, gain, conv, op), nil
+	}
+	return render(base, conv), nil
+}
+
+// planes holds decoded samples of any bit depth
+type planes struct {
+	width, height int // Luma samples
+	depth         int
+	sx, sy        uint // Chroma subsampling as shifts
+	cw, ch        int  // Chroma plane size
+	y, cb, cr     []uint16
+}
+
+func newPlanes(width, height, depth int, sx, sy uint) *planes {
+	p := &planes{width: width, height: height, depth: depth, sx: sx, sy: sy}
+	p.cw = (width + (1 << p.sx) - 1) >> p.sx
+	p.ch = (height + (1 << p.sy) - 1) >> p.sy
+	p.y = make([]uint16, width*height)
+	p.cb = make([]uint16, p.cw*p.ch)
+	p.cr = make([]uint16, p.cw*p.ch)
+	return p
+}
+
+// at returns the samples at a luma position
+func (p *planes) at(x, y int) (uint16, uint16, uint16) {
+	c := (y>>p.sy)*p.cw + x>>p.sx
+	return p.y[y*p.width+x], p.cb[c], p.cr[c]
+}
+
+// paste copies a tile into the planes at a luma position, cutting off
+// what falls outside
+func (p *planes) paste(t *planes, x0, y0 int) {
+	copyRows := func(dst, src []uint16, dstW, srcW, dstH, srcH, x, y int) {
+		for row := 0; row < srcH && y+row < dstH; row++ {
+			n := min(srcW, dstW-x)
+			if n <= 0 {
+				return
+			}
+			copy(dst[(y+row)*dstW+x:], src[row*srcW:row*srcW+n])
+		}
+	}
+	copyRows(p.y, t.y, p.width, t.width, p.height, t.height, x0, y0)
+	copyRows(p.cb, t.cb, p.cw, t.cw, p.ch, t.ch, x0>>p.sx, y0>>p.sy)
+	copyRows(p.cr, t.cr, p.cw, t.cw, p.ch, t.ch, x0>>p.sx, y0>>p.sy)
+}
+
+// decodeItem decodes a coded image or a grid of them
+func decodeItem(dec *libde265.Decoder, file *heif.File, item *heif.Item) (*planes, error) {
+	if item.Info == nil {
+		return nil, errors.New("no item info")
+	}
+	if item.Info.ItemType == "hvc1" {
+		return decodeTile(dec, file, item)
+	}
+	if item.Info.ItemType != "grid" {
+		return nil, fmt.Errorf("unsupported item type: %s", item.Info.ItemType)
+	}
+
+	width, height, ok := item.SpatialExtents()
+	if !ok {
+		return nil, errors.New("no image size")
+	}
+	data, err := file.GetItemData(item)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, errors.New("invalid grid")
+	}
+	rows, columns := int(data[2])+1, int(data[3])+1
+
+	dimg := item.Reference("dimg")
+	if dimg == nil || len(dimg.ToItemIDs) != rows*columns {
+		return nil, errors.New("grid tiles don't match")
+	}
+
+	var out *planes
+	for i, id := range dimg.ToItemIDs {
+		tileItem, err := file.ItemByID(id)
+		if err != nil {
+			return nil, err
+		}
+		tile, err := decodeTile(dec, file, tileItem)
+		if err != nil {
+			return nil, err
+		}
+		if out == nil {
+			out = newPlanes(width, height, tile.depth, tile.sx, tile.sy)
+		}
+		out.paste(tile, (i%columns)*tile.width, (i/columns)*tile.height)
+	}
+	return out, nil
+}
+
+func decodeTile(dec *libde265.Decoder, file *heif.File, item *heif.Item) (*planes, error) {
+	hvcc, ok := item.HevcConfig()
+	if !ok {
+		return nil, errors.New("no hvcC")
+	}
+	data, err := file.GetItemData(item)
+	if err != nil {
+		return nil, err
+	}
+
+	dec.Reset()
+	if err := dec.Push(hvcc.AsHeader()); err != nil {
+		return nil, err
+	}
+	img, err := dec.DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	ycc, ok := img.(*image.YCbCr)
+	if !ok {
+		return nil, errors.New("tile is not YCbCr")
+	}
+
+	depth := configDepth(hvcc)
+	w, h := ycc.Rect.Dx(), ycc.Rect.Dy()
+	var sx, sy uint
+	switch ycc.SubsampleRatio {
+	case image.YCbCrSubsampleRatio420:
+		sx, sy = 1, 1
+	case image.YCbCrSubsampleRatio422:
+		sx = 1
+	}
+	p := newPlanes(w, h, depth, sx, sy)
+
+	// Samples over 8 bits take two bytes, strides are in bytes
+	read := func(dst []uint16, src []byte, width, height, stride int) {
+		size := width
+		if depth > 8 {
+			size *= 2
+		}
+		for row := 0; row < height && row*stride+size <= len(src); row++ {
+			line := src[row*stride:]
+			for x := 0; x < width; x++ {
+				if depth > 8 {
+					dst[row*width+x] = uint16(line[2*x]) | uint16(line[2*x+1])<<8
+				} else {
+					dst[row*width+x] = uint16(line[x])
+				}
+			}
+		}
+	}
+	read(p.y, ycc.Y, w, h, ycc.YStride)
+	if len(ycc.Cb) == 0 {
+		// Monochrome, neutral chroma
+		for i := range p.cb {
+			p.cb[i] = 1 << (depth - 1)
+			p.cr[i] = 1 << (depth - 1)
+		}
+	} else {
+		read(p.cb, ycc.Cb, p.cw, p.ch, ycc.CStride)
+		read(p.cr, ycc.Cr, p.cw, p.ch, ycc.CStride)
+	}
+	return p, nil
+}
+
+// configDepth reads the luma bit depth from a raw hvcC box
+func configDepth(hvcc *bmff.ItemHevcConfigBox) int {
+	body, err := io.ReadAll(hvcc.Body())
+	if err != nil || len(body) < 18 {
+		return 8
+	}
+	return int(body[17]&0x07) + 8
+}
+
+// bitDepth returns the bit depth of an image, the one of the first tile for grids
+func bitDepth(file *heif.File, item *heif.Item) int {
+	if item.Info != nil && item.Info.ItemType == "grid" {
+		dimg := item.Reference("dimg")
+		if dimg == nil || len(dimg.ToItemIDs) == 0 {
+			return 8
+		}
+		tile, err := file.ItemByID(dimg.ToItemIDs[0])
+		if err != nil {
+			return 8
+		}
+		item = tile
+	}
+	hvcc, ok := item.HevcConfig()
+	if !ok {
+		return 8
+	}
+	return configDepth(hvcc)
+}
+
+// findGainMap returns the auxiliary HDR gain map image of the primary item
+func findGainMap(ra io.ReaderAt, file *heif.File, primary uint32) *heif.Item {
+	r := bmff.NewReader(io.NewSectionReader(ra, 0, math.MaxInt64))
+	if _, err := r.ReadAndParseBox(bmff.TypeFtyp); err != nil {
+		return nil
+	}
+	box, err := r.ReadAndParseBox(bmff.TypeMeta)
+	if err != nil {
+		return nil
+	}
+	meta, ok := box.(*bmff.MetaBox)
+	if !ok {
+		return nil
+	}
+
+	for _, child := range meta.Children {
+		parsed, err := child.Parse()
+		if err != nil {
+			continue
+		}
+		refs, ok := parsed.(*bmff.ItemReferenceBox)
+		if !ok {
+			continue
+		}
+		for _, ref := range refs.ItemRefs {
+			if ref.Type().String() != "auxl" || !containsID(ref.ToItemIDs, primary) {
+				continue
+			}
+			item, err := file.ItemByID(ref.FromItemID)
+			if err == nil && auxType(item) == gainMapType {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+func containsID(ids []uint32, id uint32) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// auxType reads the type of an auxiliary image from its auxC property
+func auxType(item *heif.Item) string {
+	for _, prop := range item.Properties {
+		if prop.Type().String() != "auxC" {
+			continue
+		}
+		body, err := io.ReadAll(prop.Body())
+		if err != nil || len(body) < 4 {
+			return ""
+		}
+		name, _, _ := bytes.Cut(body[4:], []byte{0})
+		return string(name)
+	}
+	return ""
+}
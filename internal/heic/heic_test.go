@@ -0,0 +1,79 @@
+package heic
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tgagor/frameo-miniatures/internal/icc"
+	"github.com/tgagor/frameo-miniatures/internal/tonemap"
+)
+
+// fill returns 4:2:0 planes with one colour per column
+func fill(depth int, columns ...[3]uint16) *planes {
+	p := newPlanes(2*len(columns), 2, depth, 1, 1)
+	for x := 0; x < p.width; x++ {
+		for y := 0; y < p.height; y++ {
+			p.y[y*p.width+x] = columns[x/2][0]
+		}
+	}
+	for i, c := range columns {
+		p.cb[i], p.cr[i] = c[1], c[2]
+	}
+	return p
+}
+
+func TestRender_LimitedRange(t *testing.T) {
+	nclx := &icc.NCLX{Primaries: 9, Transfer: 1, Matrix: 9}
+	p := fill(10, [3]uint16{940, 512, 512}, [3]uint16{64, 512, 512}, [3]uint16{502, 512, 512})
+
+	img := render(p, newConverter(nclx, 10))
+	assert.Equal(t, color.NRGBA64{0xffff, 0xffff, 0xffff, 0xffff}, img.NRGBA64At(0, 0))
+	assert.Equal(t, color.NRGBA64{0, 0, 0, 0xffff}, img.NRGBA64At(2, 1))
+	gray := img.NRGBA64At(4, 0)
+	assert.InDelta(t, 0x8000, int(gray.R), 0x100)
+	assert.Equal(t, gray.R, gray.G)
+	assert.Equal(t, gray.R, gray.B)
+}
+
+func TestRender_Color(t *testing.T) {
+	// Full range BT.601 red, as goheif would decode it
+	p := fill(8, [3]uint16{76, 85, 255})
+	c := render(p, newConverter(nil, 8)).NRGBA64At(0, 0)
+	assert.InDelta(t, 0xffff, int(c.R), 0x200)
+	assert.InDelta(t, 0, int(c.G), 0x200)
+	assert.InDelta(t, 0, int(c.B), 0x200)
+}
+
+func TestRenderHDR(t *testing.T) {
+	nclx := &icc.NCLX{Primaries: 9, Transfer: icc.TransferPQ, Matrix: 9, FullRange: true}
+	// Reference white at 58%, a highlight at 75% (1000 nits) and the 10000 nit peak
+	p := fill(10, [3]uint16{594, 512, 512}, [3]uint16{767, 512, 512}, [3]uint16{1023, 512, 512})
+
+	for _, op := range []tonemap.Operator{tonemap.Reinhard, tonemap.Hable} {
+		t.Run(string(op), func(t *testing.T) {
+			img := renderHDR(p, newConverter(nclx, 10), nclx, op)
+			white, highlight, peak := img.NRGBA64At(0, 0), img.NRGBA64At(2, 0), img.NRGBA64At(4, 0)
+
+			// Highlights keep their order instead of clipping together
+			assert.Less(t, white.R, highlight.R)
+			assert.Less(t, highlight.R, peak.R)
+			assert.Equal(t, uint16(0xffff), peak.R)
+			assert.Greater(t, white.R, uint16(0xc000), "SDR white must stay bright")
+		})
+	}
+
+	img := renderHDR(p, newConverter(nclx, 10), nclx, tonemap.Clip)
+	assert.Equal(t, img.NRGBA64At(2, 0), img.NRGBA64At(4, 0), "clip flattens highlights")
+}
+
+func TestRenderGainMap(t *testing.T) {
+	base := fill(8, [3]uint16{200, 128, 128}, [3]uint16{200, 128, 128})
+	gain := newPlanes(2, 1, 8, 1, 1)
+	gain.y[1] = 255 // Right half is a highlight
+
+	img := renderGainMap(base, gain, newConverter(nil, 8), tonemap.GainMap)
+	plain, boosted := img.NRGBA64At(0, 0), img.NRGBA64At(3, 1)
+	assert.Less(t, plain.R, boosted.R)
+	assert.InDelta(t, 200*0x101, int(plain.R), 0x200, "areas without gain stay as they are")
+}
@@ -0,0 +1,175 @@
+package heic
+
+import (
+	"image"
+	"math"
+
+	"github.com/tgagor/frameo-miniatures/internal/icc"
+	"github.com/tgagor/frameo-miniatures/internal/tonemap"
+)
+
+// converter turns YCbCr samples into non-linear RGB in 0-1
+type converter struct {
+	kr, kb     float64
+	yOff, yMul float64
+	cOff, cMul float64
+}
+
+// newConverter uses the matrix coefficients and range of the nclx colour
+// description. Without one, samples are full range BT.601 as in JPEG.
+func newConverter(nclx *icc.NCLX, depth int) converter {
+	c := converter{kr: 0.299, kb: 0.114}
+	full := true
+	if nclx != nil {
+		switch nclx.Matrix {
+		case 1:
+			c.kr, c.kb = 0.2126, 0.0722
+		case 9, 10:
+			c.kr, c.kb = 0.2627, 0.0593
+		}
+		full = nclx.FullRange
+	}
+
+	scale := float64(int(1) << (depth - 8))
+	c.cOff = 128 * scale
+	if full {
+		c.yMul = 1 / float64(int(1)<<depth-1)
+		c.cMul = c.yMul
+	} else {
+		c.yOff = 16 * scale
+		c.yMul = 1 / (219 * scale)
+		c.cMul = 1 / (224 * scale)
+	}
+	return c
+}
+
+func (c converter) rgb(y, cb, cr uint16) (float64, float64, float64) {
+	l := (float64(y) - c.yOff) * c.yMul
+	u := (float64(cb) - c.cOff) * c.cMul
+	v := (float64(cr) - c.cOff) * c.cMul
+	r := l + 2*(1-c.kr)*v
+	b := l + 2*(1-c.kb)*u
+	g := (l - c.kr*r - c.kb*b) / (1 - c.kr - c.kb)
+	return r, g, b
+}
+
+// to16 stores a 0-1 value as a 16-bit sample
+func to16(v float64) uint16 {
+	return uint16(math.Round(math.Max(0, math.Min(v, 1)) * 0xffff))
+}
+
+// lut caches a function over 0-1 in 16-bit steps
+func lut(f func(float64) float64) func(float64) float64 {
+	table := make([]float64, 1<<16)
+	for i := range table {
+		table[i] = f(float64(i) / 0xffff)
+	}
+	return func(v float64) float64 {
+		return table[to16(v)]
+	}
+}
+
+// render keeps the samples as they are, in the photo's own colour space
+func render(p *planes, conv converter) *image.NRGBA64 {
+	img := image.NewNRGBA64(image.Rect(0, 0, p.width, p.height))
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			r, g, b := conv.rgb(p.at(x, y))
+			i := img.PixOffset(x, y)
+			put(img.Pix[i:], r, g, b)
+		}
+	}
+	return img
+}
+
+func put(pix []uint8, r, g, b float64) {
+	for c, v := range [4]uint16{to16(r), to16(g), to16(b), 0xffff} {
+		pix[2*c] = uint8(v >> 8)
+		pix[2*c+1] = uint8(v)
+	}
+}
+
+// toneMap compresses linear light in 0-peak into 0-1, scaling all three
+// channels together so that bright colours keep their hue
+func toneMap(curve func(float64) float64, r, g, b float64) (float64, float64, float64) {
+	m := math.Max(r, math.Max(g, b))
+	if m <= 0 {
+		return 0, 0, 0
+	}
+	s := curve(m) / m
+	return r * s, g * s, b * s
+}
+
+// renderHDR tone maps PQ or HLG samples into sRGB
+func renderHDR(p *planes, conv converter, nclx *icc.NCLX, op tonemap.Operator) *image.NRGBA64 {
+	linear := func(r, g, b float64) (float64, float64, float64) {
+		return tonemap.HLG(r, g, b)
+	}
+	if nclx.Transfer == icc.TransferPQ {
+		pq := lut(tonemap.PQ)
+		linear = func(r, g, b float64) (float64, float64, float64) {
+			return pq(r), pq(g), pq(b)
+		}
+	}
+
+	// Tone mapping happens in sRGB primaries, so wide gamut colours clip
+	// at the end instead of shifting
+	profile, err := (&icc.NCLX{Primaries: nclx.Primaries, Transfer: 8}).Profile()
+	if err != nil {
+		// HDR video and photos are BT.2020 when they don't say
+		profile, _ = (&icc.NCLX{Primaries: 9, Transfer: 8}).Profile()
+	}
+	m := profile.SRGBMatrix()
+	pixel := func(x, y int) (float64, float64, float64) {
+		r, g, b := linear(conv.rgb(p.at(x, y)))
+		return m[0][0]*r + m[0][1]*g + m[0][2]*b,
+			m[1][0]*r + m[1][1]*g + m[1][2]*b,
+			m[2][0]*r + m[2][1]*g + m[2][2]*b
+	}
+
+	peak := 1.0
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			r, g, b := pixel(x, y)
+			peak = math.Max(peak, math.Max(r, math.Max(g, b)))
+		}
+	}
+
+	curve := op.Curve(peak)
+	encode := lut(icc.EncodeSRGB)
+	img := image.NewNRGBA64(image.Rect(0, 0, p.width, p.height))
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			r, g, b := pixel(x, y)
+			r, g, b = toneMap(curve, r, g, b)
+			i := img.PixOffset(x, y)
+			put(img.Pix[i:], encode(r), encode(g), encode(b))
+		}
+	}
+	return img
+}
+
+// renderGainMap brightens highlights with an Apple HDR gain map, then
+// brings them back into range with the operator's curve. The result stays
+// in the photo's own primaries.
+func renderGainMap(base, gain *planes, conv converter, op tonemap.Operator) *image.NRGBA64 {
+	decode := lut(icc.DecodeSRGB)
+	encode := lut(icc.EncodeSRGB)
+	curve := op.Curve(tonemap.DefaultHeadroom)
+	gainMax := float64(int(1)<<gain.depth - 1)
+
+	img := image.NewNRGBA64(image.Rect(0, 0, base.width, base.height))
+	for y := 0; y < base.height; y++ {
+		gy := min(y*gain.height/base.height, gain.height-1)
+		for x := 0; x < base.width; x++ {
+			gx := min(x*gain.width/base.width, gain.width-1)
+			boost := 1 + (tonemap.DefaultHeadroom-1)*decode(float64(gain.y[gy*gain.width+gx])/gainMax)
+
+			r, g, b := conv.rgb(base.at(x, y))
+			r, g, b = toneMap(curve, decode(r)*boost, decode(g)*boost, decode(b)*boost)
+			i := img.PixOffset(x, y)
+			put(img.Pix[i:], encode(r), encode(g), encode(b))
+		}
+	}
+	return img
+}
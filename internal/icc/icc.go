@@ -0,0 +1,303 @@
+package icc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/disintegration/imaging"
+)
+
+// ErrUnsupported is returned for valid profiles that can't be converted,
+// e.g. LUT based or CMYK profiles
+var ErrUnsupported = errors.New("unsupported colour profile")
+
+// Profile is an RGB matrix/TRC colour profile, the kind cameras and phones
+// embed (sRGB, Display P3, Adobe RGB, ProPhoto RGB)
+type Profile struct {
+	Description string
+	toXYZ       matrix // Linear RGB to the D50 profile connection space
+	trc         [3]curve
+}
+
+type matrix [3][3]float64
+
+// Parse reads the colorants and tone curves of an ICC profile
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, errors.New("not an ICC profile")
+	}
+	if space := string(data[16:20]); space != "RGB " {
+		return nil, fmt.Errorf("%w: %s colour space", ErrUnsupported, strings.TrimSpace(space))
+	}
+
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count; i++ {
+		entry := 132 + 12*i
+		if entry+12 > len(data) {
+			return nil, errors.New("truncated ICC tag table")
+		}
+		sig := string(data[entry : entry+4])
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, fmt.Errorf("ICC tag %q out of bounds", sig)
+		}
+		tags[sig] = data[offset : offset+size]
+	}
+
+	p := &Profile{Description: description(tags["desc"])}
+	for i, name := range []string{"r", "g", "b"} {
+		xyz, err := parseXYZ(tags[name+"XYZ"])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %sXYZ: %v", ErrUnsupported, name, err)
+		}
+		for row := 0; row < 3; row++ {
+			p.toXYZ[row][i] = xyz[row]
+		}
+		if p.trc[i], err = parseCurve(tags[name+"TRC"]); err != nil {
+			return nil, fmt.Errorf("%w: %sTRC: %v", ErrUnsupported, name, err)
+		}
+	}
+	return p, nil
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func parseXYZ(tag []byte) ([3]float64, error) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, errors.New("missing")
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, nil
+}
+
+// description returns the profile name from a v2 desc or v4 mluc tag
+func description(tag []byte) string {
+	switch {
+	case len(tag) >= 12 && string(tag[:4]) == "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if 12+n <= len(tag) {
+			return strings.TrimRight(string(tag[12:12+n]), "\x00")
+		}
+	case len(tag) >= 28 && string(tag[:4]) == "mluc":
+		length := int(binary.BigEndian.Uint32(tag[20:]))
+		offset := int(binary.BigEndian.Uint32(tag[24:]))
+		if offset+length <= len(tag) {
+			units := make([]uint16, length/2)
+			for i := range units {
+				units[i] = binary.BigEndian.Uint16(tag[offset+2*i:])
+			}
+			return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+		}
+	}
+	return ""
+}
+
+// curve decodes a stored channel value in 0-1 to linear light
+type curve func(v float64) float64
+
+func parseCurve(tag []byte) (curve, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("missing")
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case n == 0:
+			return func(v float64) float64 { return v }, nil
+		case n == 1 && len(tag) >= 14:
+			return gamma(float64(binary.BigEndian.Uint16(tag[12:])) / 256), nil
+		case len(tag) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+			}
+			return interpolate(table), nil
+		}
+	case "para":
+		kind := binary.BigEndian.Uint16(tag[8:])
+		counts := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}
+		n, ok := counts[kind]
+		if !ok || len(tag) < 12+4*n {
+			break
+		}
+		var a [7]float64
+		for i := 0; i < n; i++ {
+			a[i] = s15Fixed16(tag[12+4*i:])
+		}
+		return parametric(kind, a), nil
+	}
+	return nil, fmt.Errorf("invalid %q curve", string(tag[:4]))
+}
+
+func gamma(g float64) curve {
+	return func(v float64) float64 { return math.Pow(v, g) }
+}
+
+func interpolate(table []float64) curve {
+	return func(v float64) float64 {
+		pos := v * float64(len(table)-1)
+		i := int(pos)
+		if i >= len(table)-1 {
+			return table[len(table)-1]
+		}
+		frac := pos - float64(i)
+		return table[i]*(1-frac) + table[i+1]*frac
+	}
+}
+
+// parametric implements the ICC parametricCurveType functions
+func parametric(kind uint16, p [7]float64) curve {
+	g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	pow := func(v float64) float64 { return math.Pow(math.Max(v, 0), g) }
+	switch kind {
+	case 1:
+		return func(v float64) float64 {
+			if v >= -b/a {
+				return pow(a*v + b)
+			}
+			return 0
+		}
+	case 2:
+		return func(v float64) float64 {
+			if v >= -b/a {
+				return pow(a*v+b) + c
+			}
+			return c
+		}
+	case 3:
+		return func(v float64) float64 {
+			if v >= d {
+				return pow(a*v + b)
+			}
+			return c * v
+		}
+	case 4:
+		return func(v float64) float64 {
+			if v >= d {
+				return pow(a*v+b) + e
+			}
+			return c*v + f
+		}
+	}
+	return pow
+}
+
+// srgbCurve is the sRGB transfer function
+var srgbCurve = parametric(3, [7]float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045})
+
+// srgbToXYZ holds the D50 adapted sRGB colorants, as in the sRGB ICC profile
+var srgbToXYZ = matrix{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// IsSRGB reports whether the profile is close enough to sRGB to leave
+// pixels untouched
+func (p *Profile) IsSRGB() bool {
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			if math.Abs(p.toXYZ[row][col]-srgbToXYZ[row][col]) > 0.002 {
+				return false
+			}
+		}
+	}
+	for _, trc := range p.trc {
+		for i := 0; i <= 16; i++ {
+			v := float64(i) / 16
+			if math.Abs(trc(v)-srgbCurve(v)) > 0.003 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ToSRGB converts the image from the profile's colour space to sRGB
+func (p *Profile) ToSRGB(img image.Image) *image.NRGBA {
+	dst := imaging.Clone(img)
+
+	// Linear light of every stored 8-bit value, per channel
+	var decode [3][256]float64
+	for c := 0; c < 3; c++ {
+		for v := 0; v < 256; v++ {
+			decode[c][v] = p.trc[c](float64(v) / 255)
+		}
+	}
+	m := p.SRGBMatrix()
+
+	// Linear light back to sRGB values, fine enough for dark tones
+	const steps = 4096
+	var encode [steps + 1]uint8
+	for i := range encode {
+		encode[i] = uint8(math.Round(255 * encodeSRGB(float64(i)/steps)))
+	}
+	toByte := func(v float64) uint8 {
+		return encode[int(math.Max(0, math.Min(v, 1))*steps+0.5)]
+	}
+
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		r := decode[0][dst.Pix[i]]
+		g := decode[1][dst.Pix[i+1]]
+		b := decode[2][dst.Pix[i+2]]
+		dst.Pix[i] = toByte(m[0][0]*r + m[0][1]*g + m[0][2]*b)
+		dst.Pix[i+1] = toByte(m[1][0]*r + m[1][1]*g + m[1][2]*b)
+		dst.Pix[i+2] = toByte(m[2][0]*r + m[2][1]*g + m[2][2]*b)
+	}
+	return dst
+}
+
+// SRGBMatrix returns the matrix converting linear light in the profile's
+// colour space to linear sRGB
+func (p *Profile) SRGBMatrix() [3][3]float64 {
+	return srgbToXYZ.inverse().mul(p.toXYZ)
+}
+
+// DecodeSRGB converts an sRGB value in 0-1 to linear light
+func DecodeSRGB(v float64) float64 {
+	return srgbCurve(v)
+}
+
+// EncodeSRGB converts linear light in 0-1 to an sRGB value
+func EncodeSRGB(v float64) float64 {
+	return encodeSRGB(v)
+}
+
+func encodeSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func (a matrix) mul(b matrix) matrix {
+	var m matrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func (a matrix) inverse() matrix {
+	det := a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+		a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+		a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+	return matrix{
+		{(a[1][1]*a[2][2] - a[1][2]*a[2][1]) / det, (a[0][2]*a[2][1] - a[0][1]*a[2][2]) / det, (a[0][1]*a[1][2] - a[0][2]*a[1][1]) / det},
+		{(a[1][2]*a[2][0] - a[1][0]*a[2][2]) / det, (a[0][0]*a[2][2] - a[0][2]*a[2][0]) / det, (a[0][2]*a[1][0] - a[0][0]*a[1][2]) / det},
+		{(a[1][0]*a[2][1] - a[1][1]*a[2][0]) / det, (a[0][1]*a[2][0] - a[0][0]*a[2][1]) / det, (a[0][0]*a[1][1] - a[0][1]*a[1][0]) / det},
+	}
+}
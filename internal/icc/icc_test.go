@@ -0,0 +1,152 @@
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildProfile writes a v2 matrix/TRC profile with sRGB tone curves
+func buildProfile(name, space string, toXYZ matrix) []byte {
+	fixed := func(v float64) []byte {
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(v*65536+0.5)))
+	}
+
+	desc := append([]byte("desc\x00\x00\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(name)+1))...)
+	desc = append(append(desc, name...), 0)
+	trc := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+	for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		trc = append(trc, fixed(v)...)
+	}
+	tags := []struct {
+		sig  string
+		data []byte
+	}{{"desc", desc}, {"rTRC", trc}, {"gTRC", trc}, {"bTRC", trc}}
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz := []byte("XYZ \x00\x00\x00\x00")
+		for row := 0; row < 3; row++ {
+			xyz = append(xyz, fixed(toXYZ[row][i])...)
+		}
+		tags = append(tags, struct {
+			sig  string
+			data []byte
+		}{sig, xyz})
+	}
+
+	header := make([]byte, 128)
+	copy(header[16:], space)
+	copy(header[20:], "XYZ ")
+	copy(header[36:], "acsp")
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var body []byte
+	offset := 128 + 4 + 12*len(tags)
+	for _, tag := range tags {
+		table = append(table, tag.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(body)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+		body = append(body, tag.data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	data := append(append(header, table...), body...)
+	binary.BigEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+func TestParse(t *testing.T) {
+	data, err := os.ReadFile("testdata/display-p3.icc")
+	require.NoError(t, err)
+	p, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, "Display P3", p.Description)
+	assert.False(t, p.IsSRGB())
+
+	p, err = Parse(buildProfile("sRGB IEC61966-2.1", "RGB ", srgbToXYZ))
+	require.NoError(t, err)
+	assert.True(t, p.IsSRGB())
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, err := Parse([]byte("not a profile"))
+	assert.Error(t, err)
+
+	_, err = Parse(buildProfile("Coated FOGRA39", "CMYK", srgbToXYZ))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	// A LUT based profile has no colorants
+	data := buildProfile("LUT", "RGB ", srgbToXYZ)
+	copy(data[bytes.Index(data, []byte("rXYZ")):], "A2B0")
+	_, err = Parse(data)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestProfile_ToSRGB(t *testing.T) {
+	p3, err := Parse(buildProfile("Display P3", "RGB ", rgbToXYZ(primaries[12])))
+	require.NoError(t, err)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{234, 51, 35, 255}) // sRGB red in Display P3
+	img.SetNRGBA(1, 0, color.NRGBA{255, 0, 0, 255})   // Outside of sRGB
+	img.SetNRGBA(2, 0, color.NRGBA{128, 128, 128, 128})
+	img.SetNRGBA(3, 0, color.NRGBA{0, 0, 0, 255})
+
+	out := p3.ToSRGB(img)
+	assertNear := func(want, got color.NRGBA) {
+		t.Helper()
+		assert.InDelta(t, want.R, got.R, 2, "%v", got)
+		assert.InDelta(t, want.G, got.G, 2, "%v", got)
+		assert.InDelta(t, want.B, got.B, 2, "%v", got)
+		assert.Equal(t, want.A, got.A)
+	}
+	assertNear(color.NRGBA{255, 0, 0, 255}, out.NRGBAAt(0, 0))
+	assertNear(color.NRGBA{255, 0, 0, 255}, out.NRGBAAt(1, 0))
+	assertNear(color.NRGBA{128, 128, 128, 128}, out.NRGBAAt(2, 0))
+	assertNear(color.NRGBA{0, 0, 0, 255}, out.NRGBAAt(3, 0))
+	assert.Equal(t, color.NRGBA{234, 51, 35, 255}, img.NRGBAAt(0, 0), "source image must not change")
+}
+
+func TestNCLX_Profile(t *testing.T) {
+	p3, err := (&NCLX{Primaries: 12, Transfer: 13}).Profile()
+	require.NoError(t, err)
+	assert.False(t, p3.IsSRGB())
+
+	srgb, err := (&NCLX{Primaries: 1, Transfer: 13}).Profile()
+	require.NoError(t, err)
+	assert.True(t, srgb.IsSRGB(), "BT.709 primaries with the sRGB curve are sRGB")
+
+	// HDR transfer functions need tone mapping
+	_, err = (&NCLX{Primaries: 9, Transfer: 16}).Profile()
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestJPEG_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 16)), nil))
+
+	src, err := ReadJPEG(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.True(t, src.Empty())
+
+	// Big enough to need two segments
+	profile := buildProfile("Display P3", "RGB ", rgbToXYZ(primaries[12]))
+	profile = append(profile, make([]byte, 70000)...)
+
+	data, err := EmbedJPEG(buf.Bytes(), profile)
+	require.NoError(t, err)
+
+	src, err = ReadJPEG(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, profile, src.ICC)
+
+	_, err = jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err, "output must stay a valid JPEG")
+}
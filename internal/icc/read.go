@@ -0,0 +1,312 @@
+package icc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/adrium/goheif/heif"
+)
+
+// Source is the colour description found in an image file
+type Source struct {
+	ICC  []byte // Embedded ICC profile
+	NCLX *NCLX  // HEIC colour parameters, used when there is no ICC profile
+}
+
+// Empty reports whether the file carries no colour description, which
+// means sRGB
+func (s Source) Empty() bool {
+	return len(s.ICC) == 0 && s.NCLX == nil
+}
+
+// Profile parses the colour description, nil when there is none
+func (s Source) Profile() (*Profile, error) {
+	switch {
+	case len(s.ICC) > 0:
+		return Parse(s.ICC)
+	case s.NCLX != nil:
+		return s.NCLX.Profile()
+	}
+	return nil, nil
+}
+
+// NCLX holds colour parameters coded as in ISO/IEC 23091-2
+type NCLX struct {
+	Primaries uint16
+	Transfer  uint16
+	Matrix    uint16
+	FullRange bool
+}
+
+// HDR reports whether the values use an HDR transfer function, PQ or HLG,
+// which needs tone mapping rather than a profile conversion
+func (n *NCLX) HDR() bool {
+	return n.Transfer == TransferPQ || n.Transfer == TransferHLG
+}
+
+// HDR transfer characteristics
+const (
+	TransferPQ  = 16
+	TransferHLG = 18
+)
+
+type chromaticity struct{ x, y float64 }
+
+// primaries of the supported colour spaces: red, green, blue and white
+var primaries = map[uint16][4]chromaticity{
+	1:  {{0.64, 0.33}, {0.30, 0.60}, {0.15, 0.06}, {0.3127, 0.3290}},       // BT.709, sRGB
+	9:  {{0.708, 0.292}, {0.170, 0.797}, {0.131, 0.046}, {0.3127, 0.3290}}, // BT.2020
+	12: {{0.680, 0.320}, {0.265, 0.690}, {0.150, 0.060}, {0.3127, 0.3290}}, // Display P3
+}
+
+// bt709 is the inverse of the BT.709 camera transfer function
+func bt709(v float64) float64 {
+	if v < 0.081 {
+		return v / 4.5
+	}
+	return math.Pow((v+0.099)/1.099, 1/0.45)
+}
+
+var transfers = map[uint16]curve{
+	1:  bt709,
+	2:  srgbCurve, // Unspecified
+	4:  gamma(2.2),
+	6:  bt709,
+	8:  func(v float64) float64 { return v },
+	13: srgbCurve,
+	14: bt709,
+	15: bt709,
+}
+
+// Profile builds the equivalent matrix/TRC profile
+func (n *NCLX) Profile() (*Profile, error) {
+	prim, ok := primaries[n.Primaries]
+	if !ok {
+		return nil, fmt.Errorf("%w: colour primaries %d", ErrUnsupported, n.Primaries)
+	}
+	trc, ok := transfers[n.Transfer]
+	if !ok {
+		return nil, fmt.Errorf("%w: transfer characteristics %d", ErrUnsupported, n.Transfer)
+	}
+	return &Profile{
+		Description: fmt.Sprintf("nclx %d/%d", n.Primaries, n.Transfer),
+		toXYZ:       rgbToXYZ(prim),
+		trc:         [3]curve{trc, trc, trc},
+	}, nil
+}
+
+// rgbToXYZ derives the D50 adapted colorants from chromaticities,
+// the way ICC profiles store them
+func rgbToXYZ(c [4]chromaticity) matrix {
+	xyz := func(c chromaticity) [3]float64 { return [3]float64{c.x / c.y, 1, (1 - c.x - c.y) / c.y} }
+	var p matrix
+	for i := 0; i < 3; i++ {
+		v := xyz(c[i])
+		for row := 0; row < 3; row++ {
+			p[row][i] = v[row]
+		}
+	}
+
+	// Scale the primaries so that RGB 1,1,1 is the white point
+	white := xyz(c[3])
+	inv := p.inverse()
+	for i := 0; i < 3; i++ {
+		s := inv[i][0]*white[0] + inv[i][1]*white[1] + inv[i][2]*white[2]
+		for row := 0; row < 3; row++ {
+			p[row][i] *= s
+		}
+	}
+
+	// Bradford chromatic adaptation to the D50 connection space
+	bradford := matrix{
+		{0.8951, 0.2664, -0.1614},
+		{-0.7502, 1.7135, 0.0367},
+		{0.0389, -0.0685, 1.0296},
+	}
+	d50 := [3]float64{0.96422, 1, 0.82521}
+	var scale matrix
+	for i := 0; i < 3; i++ {
+		src := bradford[i][0]*white[0] + bradford[i][1]*white[1] + bradford[i][2]*white[2]
+		dst := bradford[i][0]*d50[0] + bradford[i][1]*d50[1] + bradford[i][2]*d50[2]
+		scale[i][i] = dst / src
+	}
+	return bradford.inverse().mul(scale).mul(bradford).mul(p)
+}
+
+const (
+	jpegICCHeader = "ICC_PROFILE\x00"
+	// jpegICCChunk is the most profile data that fits in one APP2 segment
+	jpegICCChunk = 0xFFFF - 2 - len(jpegICCHeader) - 2
+)
+
+// ReadJPEG extracts the ICC profile stored in APP2 segments of a JPEG file
+func ReadJPEG(r io.Reader) (Source, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return Source{}, errors.New("not a JPEG file")
+	}
+
+	chunks := make(map[int][]byte)
+	total := 0
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return Source{}, err
+		}
+		if b != 0xFF {
+			return Source{}, errors.New("invalid JPEG marker")
+		}
+		marker, err := br.ReadByte()
+		for err == nil && marker == 0xFF { // Fill bytes
+			marker, err = br.ReadByte()
+		}
+		if err != nil {
+			return Source{}, err
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break // Profiles precede the image data
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue // No payload
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(br, length[:]); err != nil {
+			return Source{}, err
+		}
+		size := int(binary.BigEndian.Uint16(length[:])) - 2
+		if size < 0 {
+			return Source{}, errors.New("invalid JPEG segment")
+		}
+		if marker != 0xE2 {
+			if _, err := br.Discard(size); err != nil {
+				return Source{}, err
+			}
+			continue
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return Source{}, err
+		}
+		if len(payload) > len(jpegICCHeader)+2 && string(payload[:len(jpegICCHeader)]) == jpegICCHeader {
+			seq := int(payload[len(jpegICCHeader)])
+			total = int(payload[len(jpegICCHeader)+1])
+			chunks[seq] = payload[len(jpegICCHeader)+2:]
+		}
+	}
+
+	if len(chunks) == 0 {
+		return Source{}, nil
+	}
+	if len(chunks) != total {
+		return Source{}, fmt.Errorf("incomplete ICC profile: %d of %d segments", len(chunks), total)
+	}
+	seqs := make([]int, 0, len(chunks))
+	for seq := range chunks {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	var profile []byte
+	for _, seq := range seqs {
+		profile = append(profile, chunks[seq]...)
+	}
+	return Source{ICC: profile}, nil
+}
+
+// ReadHEIC extracts the colour description from the colr boxes of the
+// primary image of a HEIC file
+func ReadHEIC(ra io.ReaderAt) (Source, error) {
+	file := heif.Open(ra)
+	item, err := file.PrimaryItem()
+	if err != nil {
+		return Source{}, err
+	}
+
+	src, err := readColr(item)
+	if err != nil || !src.Empty() {
+		return src, err
+	}
+
+	// Grid images, as taken by phones, describe the colours of their tiles
+	if dimg := item.Reference("dimg"); dimg != nil && len(dimg.ToItemIDs) > 0 {
+		tile, err := file.ItemByID(dimg.ToItemIDs[0])
+		if err != nil {
+			return Source{}, err
+		}
+		return readColr(tile)
+	}
+	return src, nil
+}
+
+func readColr(item *heif.Item) (Source, error) {
+	var src Source
+	for _, prop := range item.Properties {
+		if prop.Type().String() != "colr" {
+			continue
+		}
+		body, err := io.ReadAll(prop.Body())
+		if err != nil {
+			return Source{}, err
+		}
+		if len(body) < 4 {
+			continue
+		}
+		switch string(body[:4]) {
+		case "prof", "rICC":
+			src.ICC = body[4:]
+		case "nclx":
+			if len(body) >= 11 {
+				src.NCLX = &NCLX{
+					Primaries: binary.BigEndian.Uint16(body[4:]),
+					Transfer:  binary.BigEndian.Uint16(body[6:]),
+					Matrix:    binary.BigEndian.Uint16(body[8:]),
+					FullRange: body[10]&0x80 != 0,
+				}
+			}
+		}
+	}
+	return src, nil
+}
+
+// EmbedJPEG stores an ICC profile in APP2 segments, after the JFIF and
+// EXIF segments of the JPEG data
+func EmbedJPEG(data, profile []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+	count := (len(profile) + jpegICCChunk - 1) / jpegICCChunk
+	if count == 0 || count > 255 {
+		return nil, fmt.Errorf("ICC profile of %d bytes doesn't fit in a JPEG file", len(profile))
+	}
+
+	// Skip APP0 and APP1, readers expect them first
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF && (data[pos+1] == 0xE0 || data[pos+1] == 0xE1) {
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+	}
+	if pos > len(data) {
+		return nil, errors.New("truncated JPEG segment")
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(profile) + count*18)
+	buf.Write(data[:pos])
+	for i := 0; i < count; i++ {
+		chunk := profile[i*jpegICCChunk : min((i+1)*jpegICCChunk, len(profile))]
+		buf.Write([]byte{0xFF, 0xE2})
+		binary.Write(&buf, binary.BigEndian, uint16(2+len(jpegICCHeader)+2+len(chunk)))
+		buf.WriteString(jpegICCHeader)
+		buf.Write([]byte{byte(i + 1), byte(count)})
+		buf.Write(chunk)
+	}
+	buf.Write(data[pos:])
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,195 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileName is the name of the manifest inside the output directory
+const FileName = ".frameo-manifest.json"
+
+// BadFileName is where a manifest that can't be parsed is moved to
+const BadFileName = FileName + ".bad"
+
+// Source describes the state of a source photo when its output was written
+type Source struct {
+	Path           string    `json:"path"`
+	Size           int64     `json:"size"`
+	ModTime        time.Time `json:"mod_time"`
+	SidecarModTime time.Time `json:"sidecar_mod_time"`
+
+	// Params fingerprints the settings the output was written with. It is
+	// empty for outputs recorded before settings were.
+	Params string `json:"params,omitempty"`
+}
+
+// Stat returns the current state of a source photo and its optional sidecar
+func Stat(path, sidecar string) (Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Source{}, err
+	}
+	s := Source{Path: path, Size: info.Size(), ModTime: info.ModTime().UTC()}
+	if sidecar != "" {
+		if info, err := os.Stat(sidecar); err == nil {
+			s.SidecarModTime = info.ModTime().UTC()
+		}
+	}
+	return s, nil
+}
+
+// Equal reports whether two states describe the same, unchanged source.
+// The output they are recorded for already identifies the source, so the
+// path is not compared: it changes with how the input is spelled or where
+// it is mounted. Output settings are not compared either.
+func (s Source) Equal(other Source) bool {
+	return s.Size == other.Size &&
+		s.ModTime.Equal(other.ModTime) &&
+		s.SidecarModTime.Equal(other.SidecarModTime)
+}
+
+// Manifest records which source every output was generated from, so
+// incremental runs can tell changed sources apart. It is safe for concurrent use.
+type Manifest struct {
+	dir string
+
+	mu      sync.Mutex
+	outputs map[string]Source // Keyed by path relative to dir
+	dirty   bool
+}
+
+type manifestFile struct {
+	Version int               `json:"version"`
+	Outputs map[string]Source `json:"outputs"`
+}
+
+// Load reads the manifest of an output directory. A missing manifest
+// results in an empty one.
+//
+// A manifest that can't be parsed is moved to BadFileName rather than
+// overwritten by the next Save, and an empty manifest is returned along with
+// the error. Callers must not prune anything then, the outputs it recorded
+// are unknown. When the manifest can't be read or moved, no manifest is
+// returned.
+func Load(dir string) (*Manifest, error) {
+	m := &Manifest{dir: dir, outputs: make(map[string]Source)}
+
+	path := filepath.Join(dir, FileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var f manifestFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		bad := filepath.Join(dir, BadFileName)
+		if moveErr := os.Rename(path, bad); moveErr != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w, and to move it aside: %v", err, moveErr)
+		}
+		return m, fmt.Errorf("failed to parse manifest, moved it to %s: %w", bad, err)
+	}
+	if f.Outputs != nil {
+		m.outputs = f.Outputs
+	}
+	return m, nil
+}
+
+// Get returns the recorded source of an output file
+func (m *Manifest) Get(output string) (Source, bool) {
+	key, err := m.key(output)
+	if err != nil {
+		return Source{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.outputs[key]
+	return s, ok
+}
+
+// Put records the source of an output file
+func (m *Manifest) Put(output string, source Source) {
+	key, err := m.key(output)
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outputs[key] = source
+	m.dirty = true
+}
+
+// Delete forgets an output file
+func (m *Manifest) Delete(output string) {
+	key, err := m.key(output)
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.outputs[key]; ok {
+		delete(m.outputs, key)
+		m.dirty = true
+	}
+}
+
+// Outputs returns the recorded output files, relative to the output
+// directory and sorted
+func (m *Manifest) Outputs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	outputs := make([]string, 0, len(m.outputs))
+	for key := range m.outputs {
+		outputs = append(outputs, key)
+	}
+	sort.Strings(outputs)
+	return outputs
+}
+
+// Save writes the manifest if it changed
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(manifestFile{Version: 1, Outputs: m.outputs}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write atomically, an interrupted run must not lose the whole manifest
+	path := filepath.Join(m.dir, FileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	m.dirty = false
+	return nil
+}
+
+func (m *Manifest) key(output string) (string, error) {
+	absDir, err := filepath.Abs(m.dir)
+	if err != nil {
+		return "", err
+	}
+	absOut, err := filepath.Abs(output)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absDir, absOut)
+}
@@ -0,0 +1,111 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest_SaveLoad(t *testing.T) {
+	outDir := t.TempDir()
+	srcDir := t.TempDir()
+
+	src := filepath.Join(srcDir, "IMG_0001.jpg")
+	require.NoError(t, os.WriteFile(src, []byte("photo"), 0644))
+
+	m, err := Load(outDir)
+	require.NoError(t, err)
+
+	source, err := Stat(src, "")
+	require.NoError(t, err)
+	output := filepath.Join(outDir, "2020", "IMG_0001.webp")
+	m.Put(output, source)
+	require.NoError(t, m.Save())
+	assert.FileExists(t, filepath.Join(outDir, FileName))
+
+	loaded, err := Load(outDir)
+	require.NoError(t, err)
+	recorded, ok := loaded.Get(output)
+	require.True(t, ok)
+	assert.True(t, recorded.Equal(source))
+
+	_, ok = loaded.Get(filepath.Join(outDir, "other.webp"))
+	assert.False(t, ok)
+}
+
+func TestStat_Sidecar(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "IMG_0001.jpg")
+	sidecar := src + ".xmp"
+	require.NoError(t, os.WriteFile(src, []byte("photo"), 0644))
+	require.NoError(t, os.WriteFile(sidecar, []byte("<x:xmpmeta/>"), 0644))
+
+	before, err := Stat(src, sidecar)
+	require.NoError(t, err)
+	assert.False(t, before.SidecarModTime.IsZero())
+
+	// Rating a photo only touches the sidecar
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(sidecar, later, later))
+	after, err := Stat(src, sidecar)
+	require.NoError(t, err)
+	assert.False(t, before.Equal(after))
+}
+
+func TestSource_Equal_Moved(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "IMG_0001.jpg")
+	require.NoError(t, os.WriteFile(src, []byte("photo"), 0644))
+	absolute, err := Stat(src, "")
+	require.NoError(t, err)
+
+	// The same input given relative to the working directory
+	t.Chdir(dir)
+	relative, err := Stat("IMG_0001.jpg", "")
+	require.NoError(t, err)
+	assert.True(t, absolute.Equal(relative))
+}
+
+func TestLoad_Missing(t *testing.T) {
+	m, err := Load(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	require.NoError(t, m.Save(), "saving an unchanged manifest is a no-op")
+}
+
+func TestLoad_Corrupt(t *testing.T) {
+	outDir := t.TempDir()
+	corrupt := []byte(`{"version": 1, "outputs": {`)
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, FileName), corrupt, 0644))
+
+	m, err := Load(outDir)
+	require.Error(t, err)
+	require.NotNil(t, m)
+	assert.Empty(t, m.Outputs())
+	assert.NoFileExists(t, filepath.Join(outDir, FileName))
+
+	// The new manifest doesn't overwrite the corrupt one
+	m.Put(filepath.Join(outDir, "a.webp"), Source{Path: "a.jpg"})
+	require.NoError(t, m.Save())
+	data, err := os.ReadFile(filepath.Join(outDir, BadFileName))
+	require.NoError(t, err)
+	assert.Equal(t, corrupt, data)
+}
+
+func TestManifest_OutputsDelete(t *testing.T) {
+	outDir := t.TempDir()
+	m, err := Load(outDir)
+	require.NoError(t, err)
+
+	m.Put(filepath.Join(outDir, "b.webp"), Source{Path: "b.jpg"})
+	m.Put(filepath.Join(outDir, "2020", "a.webp"), Source{Path: "a.jpg"})
+	assert.Equal(t, []string{filepath.Join("2020", "a.webp"), "b.webp"}, m.Outputs())
+
+	m.Delete(filepath.Join(outDir, "b.webp"))
+	assert.Equal(t, []string{filepath.Join("2020", "a.webp")}, m.Outputs())
+	_, ok := m.Get(filepath.Join(outDir, "b.webp"))
+	assert.False(t, ok)
+}
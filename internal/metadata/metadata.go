@@ -0,0 +1,174 @@
+package metadata
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // Register JPEG for DecodeConfig
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adrium/goheif"
+	"github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/xmp"
+)
+
+// Metadata holds the per-file information used for filtering and ordering
+type Metadata struct {
+	Taken       time.Time // EXIF DateTimeOriginal, zero if unknown
+	Make        string
+	Model       string
+	Width       int // Displayed dimensions, after applying Orientation and crop
+	Height      int
+	Orientation int // EXIF orientation, 1 if unknown
+	HasGPS      bool
+	Latitude    float64
+	Longitude   float64
+
+	// From XMP sidecars or embedded packets
+	Rating      int    // 1-5 stars, 0 unrated, -1 rejected
+	Label       string // Lowercase colour label
+	Keywords    []string
+	Pick        int // 1 picked, -1 rejected, 0 undecided
+	Title       string
+	Description string
+	Sidecar     string // Path of the XMP sidecar, empty if there is none
+}
+
+// Landscape reports whether the photo is wider than tall as displayed
+func (m *Metadata) Landscape() bool {
+	return m.Width > m.Height
+}
+
+// Portrait reports whether the photo is taller than wide as displayed
+func (m *Metadata) Portrait() bool {
+	return m.Height > m.Width
+}
+
+// Read extracts metadata from the file header without decoding pixels
+func Read(path string) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &Metadata{Orientation: 1}
+
+	// Dimensions
+	var cfg image.Config
+	if strings.ToLower(filepath.Ext(path)) == ".heic" {
+		cfg, err = goheif.DecodeConfig(f)
+	} else {
+		cfg, _, err = image.DecodeConfig(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dimensions: %w", err)
+	}
+	m.Width, m.Height = cfg.Width, cfg.Height
+
+	// XMP is optional, a broken sidecar shouldn't hide the rest
+	packet, sidecar, err := xmp.Load(path)
+	if err != nil {
+		log.Warn().Err(err).Str("file", path).Msg("Failed to read XMP")
+	}
+	m.Sidecar = sidecar
+	if packet != nil {
+		m.Rating = packet.Rating()
+		m.Label = packet.Label()
+		m.Keywords = packet.Keywords()
+		m.Pick = packet.Pick()
+		m.Title, _ = packet.Get(xmp.NSDC, "title")
+		m.Description, _ = packet.Get(xmp.NSDC, "description")
+	}
+
+	// EXIF is optional
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if rawExif, err := exif.SearchAndExtractExifWithReader(f); err == nil {
+		if entries, _, err := exif.GetFlatExifData(rawExif, nil); err == nil {
+			m.applyExif(entries)
+		}
+	}
+
+	// Crops and rotations made in a photo manager change what is displayed
+	if side, _, err := xmp.LoadSidecar(path); err == nil && side != nil {
+		if crop, ok := side.Crop(); ok {
+			m.Width = int(math.Round(float64(m.Width) * (crop.Right - crop.Left)))
+			m.Height = int(math.Round(float64(m.Height) * (crop.Bottom - crop.Top)))
+		}
+		if o, ok := side.Orientation(); ok {
+			m.Orientation = o
+		}
+	}
+
+	// Orientations 5-8 rotate by 90 degrees
+	if m.Orientation >= 5 && m.Orientation <= 8 {
+		m.Width, m.Height = m.Height, m.Width
+	}
+	return m, nil
+}
+
+func (m *Metadata) applyExif(entries []exif.ExifTag) {
+	var latRef, lonRef string
+	var lat, lon []exifcommon.Rational
+
+	for _, tag := range entries {
+		switch tag.TagName {
+		case "DateTimeOriginal", "CreateDate":
+			if m.Taken.IsZero() {
+				if t, err := time.Parse("2006:01:02 15:04:05", tag.FormattedFirst); err == nil {
+					m.Taken = t
+				}
+			}
+		case "Make":
+			m.Make = strings.TrimSpace(strings.Trim(tag.FormattedFirst, "\x00"))
+		case "Model":
+			m.Model = strings.TrimSpace(strings.Trim(tag.FormattedFirst, "\x00"))
+		case "Orientation":
+			if val, ok := tag.Value.([]uint16); ok && len(val) > 0 {
+				m.Orientation = int(val[0])
+			} else if val, ok := tag.Value.([]uint8); ok && len(val) > 0 {
+				m.Orientation = int(val[0])
+			}
+		case "GPSLatitudeRef":
+			latRef = tag.FormattedFirst
+		case "GPSLongitudeRef":
+			lonRef = tag.FormattedFirst
+		case "GPSLatitude":
+			lat, _ = tag.Value.([]exifcommon.Rational)
+		case "GPSLongitude":
+			lon, _ = tag.Value.([]exifcommon.Rational)
+		}
+	}
+
+	if len(lat) == 3 && len(lon) == 3 {
+		m.HasGPS = true
+		m.Latitude = degrees(lat)
+		m.Longitude = degrees(lon)
+		if latRef == "S" {
+			m.Latitude = -m.Latitude
+		}
+		if lonRef == "W" {
+			m.Longitude = -m.Longitude
+		}
+	}
+}
+
+// degrees converts an EXIF degrees/minutes/seconds triple to decimal degrees
+func degrees(dms []exifcommon.Rational) float64 {
+	var result float64
+	for i, scale := range []float64{1, 60, 3600} {
+		if dms[i].Denominator == 0 {
+			continue
+		}
+		result += float64(dms[i].Numerator) / float64(dms[i].Denominator) / scale
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+package metadata
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+	jpegstructure "github.com/dsoprea/go-jpeg-image-structure/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeJPEG writes a JPEG with the given EXIF tags, keyed by IFD path and tag name
+func writeJPEG(t *testing.T, path string, w, h int, tags map[string]map[string]interface{}) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil))
+
+	if len(tags) > 0 {
+		im, err := exifcommon.NewIfdMappingWithStandard()
+		require.NoError(t, err)
+		ib := exif.NewIfdBuilder(im, exif.NewTagIndex(), exifcommon.IfdStandardIfdIdentity, exifcommon.EncodeDefaultByteOrder)
+		for ifdPath, values := range tags {
+			child, err := exif.GetOrCreateIbFromRootIb(ib, ifdPath)
+			require.NoError(t, err)
+			for name, value := range values {
+				require.NoError(t, child.SetStandardWithName(name, value))
+			}
+		}
+
+		intfc, err := jpegstructure.NewJpegMediaParser().ParseBytes(buf.Bytes())
+		require.NoError(t, err)
+		sl := intfc.(*jpegstructure.SegmentList)
+		require.NoError(t, sl.SetExif(ib))
+		buf.Reset()
+		require.NoError(t, sl.Write(&buf))
+	}
+
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestRead(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "metadata-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "photo.jpg")
+	writeJPEG(t, path, 300, 200, map[string]map[string]interface{}{
+		"IFD": {
+			"Make":        "Canon",
+			"Model":       "Canon EOS 5D",
+			"Orientation": []uint16{6},
+		},
+		"IFD/Exif": {
+			"DateTimeOriginal": "2020:05:17 14:30:00",
+		},
+		"IFD/GPSInfo": {
+			"GPSLatitudeRef":  "N",
+			"GPSLatitude":     []exifcommon.Rational{{Numerator: 41, Denominator: 1}, {Numerator: 54, Denominator: 1}, {Numerator: 0, Denominator: 1}},
+			"GPSLongitudeRef": "W",
+			"GPSLongitude":    []exifcommon.Rational{{Numerator: 12, Denominator: 1}, {Numerator: 30, Denominator: 1}, {Numerator: 0, Denominator: 1}},
+		},
+	})
+
+	m, err := Read(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Date(2020, 5, 17, 14, 30, 0, 0, time.UTC), m.Taken)
+	assert.Equal(t, "Canon", m.Make)
+	assert.Equal(t, "Canon EOS 5D", m.Model)
+	assert.Equal(t, 6, m.Orientation)
+
+	// Rotated by 90 degrees, so displayed as portrait
+	assert.Equal(t, 200, m.Width)
+	assert.Equal(t, 300, m.Height)
+	assert.True(t, m.Portrait())
+
+	assert.True(t, m.HasGPS)
+	assert.InDelta(t, 41.9, m.Latitude, 0.001)
+	assert.InDelta(t, -12.5, m.Longitude, 0.001)
+}
+
+func TestRead_NoExif(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "metadata-noexif-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "plain.jpg")
+	writeJPEG(t, path, 300, 200, nil)
+
+	m, err := Read(path)
+	require.NoError(t, err)
+	assert.True(t, m.Taken.IsZero())
+	assert.False(t, m.HasGPS)
+	assert.True(t, m.Landscape())
+
+	_, err = Read(filepath.Join(tmpDir, "missing.jpg"))
+	assert.Error(t, err)
+}
+
+func TestRead_Sidecar(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "metadata-xmp-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "rated.jpg")
+	writeJPEG(t, path, 300, 200, nil)
+	sidecar := path + ".xmp"
+	require.NoError(t, os.WriteFile(sidecar, []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmp:Rating="3">
+   <dc:subject><rdf:Bag><rdf:li>private</rdf:li></rdf:Bag></dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`), 0644))
+
+	m, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, sidecar, m.Sidecar)
+	assert.Equal(t, 3, m.Rating)
+	assert.Equal(t, []string{"private"}, m.Keywords)
+}
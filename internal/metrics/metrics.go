@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const namespace = "frameo"
+
+// Metrics collects Prometheus metrics of a run. All methods are safe to
+// call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	files    *prometheus.CounterVec
+	steps    *prometheus.HistogramVec
+	bytesIn  prometheus.Counter
+	bytesOut prometheus.Counter
+	pruned   prometheus.Counter
+}
+
+// New creates the metrics, including the Go runtime and process ones
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		files: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_total",
+			Help:      "Files finished, by outcome and the reason for skips and failures.",
+		}, []string{"outcome", "reason"}),
+		steps: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "step_duration_seconds",
+			Help:      "Time taken by each processing step of a file.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2.5, 12),
+		}, []string{"step"}),
+		bytesIn: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "read_bytes_total",
+			Help:      "Bytes of source photos read.",
+		}),
+		bytesOut: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "written_bytes_total",
+			Help:      "Bytes of miniatures written.",
+		}),
+		pruned: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "pruned_files_total",
+			Help:      "Orphaned miniatures removed from the output.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.files, m.steps, m.bytesIn, m.bytesOut, m.pruned,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// FileDone counts a finished file. Outcome is "processed", "skipped" or
+// "failed".
+func (m *Metrics) FileDone(outcome, reason string) {
+	if m == nil {
+		return
+	}
+	m.files.WithLabelValues(outcome, reason).Inc()
+}
+
+// ObserveStep records how long a processing step took
+func (m *Metrics) ObserveStep(step string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.steps.WithLabelValues(step).Observe(d.Seconds())
+}
+
+// AddBytes counts source bytes read and output bytes written
+func (m *Metrics) AddBytes(in, out int64) {
+	if m == nil {
+		return
+	}
+	m.bytesIn.Add(float64(in))
+	m.bytesOut.Add(float64(out))
+}
+
+// AddPruned counts removed miniatures
+func (m *Metrics) AddPruned(n int) {
+	if m == nil {
+		return
+	}
+	m.pruned.Add(float64(n))
+}
+
+// QueueDepth exposes the length of a work queue, read on every scrape
+func (m *Metrics) QueueDepth(queue string, depth func() int) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "queue_depth",
+		Help:        "Files waiting in a queue between processing stages.",
+		ConstLabels: prometheus.Labels{"queue": queue},
+	}, func() float64 { return float64(depth()) }))
+}
+
+// Serve exposes the metrics on /metrics at addr, and the Go profiler on
+// /debug/pprof/ when withPprof is set. The server runs until the process
+// exits.
+func (m *Metrics) Serve(addr string, withPprof bool) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	if withPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+	log.Info().Str("addr", listener.Addr().String()).Bool("pprof", withPprof).Msg("Serving metrics")
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Metrics server failed")
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.FileDone("processed", "")
+	m.FileDone("processed", "")
+	m.FileDone("skipped", "duplicate")
+	m.ObserveStep("decode", 20*time.Millisecond)
+	m.AddBytes(1000, 0)
+	m.AddBytes(0, 100)
+	m.AddPruned(3)
+
+	queue := make(chan int, 10)
+	queue <- 1
+	queue <- 2
+	m.QueueDepth("files", func() int { return len(queue) })
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.files.WithLabelValues("processed", "")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.files.WithLabelValues("skipped", "duplicate")))
+	assert.Equal(t, 1000.0, testutil.ToFloat64(m.bytesIn))
+	assert.Equal(t, 100.0, testutil.ToFloat64(m.bytesOut))
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.pruned))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.steps))
+
+	families, err := m.registry.Gather()
+	require.NoError(t, err)
+	var depth float64
+	for _, f := range families {
+		if f.GetName() == "frameo_queue_depth" {
+			depth = f.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, 2.0, depth)
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.FileDone("failed", "decode")
+		m.ObserveStep("resize", time.Second)
+		m.AddBytes(1, 1)
+		m.AddPruned(1)
+		m.QueueDepth("files", func() int { return 0 })
+	})
+}
@@ -0,0 +1,202 @@
+package ordering
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+)
+
+// Mode is the order in which files are processed
+type Mode string
+
+const (
+	// ModeNone streams files in walk order
+	ModeNone Mode = ""
+	// ModeNewest processes the most recently modified files first
+	ModeNewest Mode = "newest"
+	// ModeTaken processes the most recently taken photos first, by EXIF
+	// date with the modification time as fallback
+	ModeTaken Mode = "taken"
+	// ModeSmallest processes the smallest files first, for quick progress
+	ModeSmallest Mode = "smallest"
+	// ModeRoundRobin takes one file from each directory in turn
+	ModeRoundRobin Mode = "round-robin"
+)
+
+// DefaultWindow is the default number of files looked at before the
+// first one is sent on
+const DefaultWindow = 10000
+
+// ParseMode validates an ordering mode name
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(name); m {
+	case ModeNone, ModeNewest, ModeTaken, ModeSmallest, ModeRoundRobin:
+		return m, nil
+	}
+	if name == "walk" {
+		return ModeNone, nil
+	}
+	return ModeNone, fmt.Errorf("invalid processing order: %s (expected newest, taken, smallest or round-robin)", name)
+}
+
+// Stream reorders files from in to out and closes out when in is done.
+//
+// Up to window files are buffered; once the buffer is full, the first file
+// in order is sent on for every new one that comes in. A window at least
+// as large as the library gives a complete ordering, a smaller one bounds
+// memory and the delay before work starts.
+func Stream(in <-chan discovery.File, out chan<- discovery.File, mode Mode, window int) {
+	defer close(out)
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	buf := newBuffer(mode)
+	for file := range in {
+		buf.push(file)
+		if buf.len() > window {
+			out <- buf.pop()
+		}
+	}
+	for buf.len() > 0 {
+		out <- buf.pop()
+	}
+}
+
+type buffer interface {
+	push(discovery.File)
+	pop() discovery.File
+	len() int
+}
+
+func newBuffer(mode Mode) buffer {
+	switch mode {
+	case ModeNewest:
+		return &sorted{key: func(f *discovery.File) float64 { return -float64(modTime(f).UnixNano()) }}
+	case ModeTaken:
+		return &sorted{key: func(f *discovery.File) float64 {
+			if taken := f.Metadata().Taken; !taken.IsZero() {
+				return -float64(taken.UnixNano())
+			}
+			return -float64(modTime(f).UnixNano())
+		}}
+	case ModeSmallest:
+		return &sorted{key: func(f *discovery.File) float64 {
+			info, err := os.Stat(f.Path)
+			if err != nil {
+				return 0
+			}
+			return float64(info.Size())
+		}}
+	case ModeRoundRobin:
+		return &roundRobin{queues: make(map[string][]discovery.File)}
+	}
+	return &fifo{}
+}
+
+func modTime(f *discovery.File) time.Time {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// sorted pops the file with the lowest key. Ties keep the walk order.
+type sorted struct {
+	key   func(*discovery.File) float64
+	items []item
+	seq   int
+}
+
+type item struct {
+	file discovery.File
+	key  float64
+	seq  int
+}
+
+func (s *sorted) push(f discovery.File) {
+	s.seq++
+	heap.Push((*itemHeap)(&s.items), item{file: f, key: s.key(&f), seq: s.seq})
+}
+
+func (s *sorted) pop() discovery.File {
+	return heap.Pop((*itemHeap)(&s.items)).(item).file
+}
+
+func (s *sorted) len() int { return len(s.items) }
+
+type itemHeap []item
+
+func (h itemHeap) Len() int { return len(h) }
+func (h itemHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	return h[i].seq < h[j].seq
+}
+func (h itemHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *itemHeap) Push(x any)   { *h = append(*h, x.(item)) }
+func (h *itemHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// roundRobin pops one file from each directory in turn, directories in the
+// order they were first seen
+type roundRobin struct {
+	queues map[string][]discovery.File
+	dirs   []string
+	next   int
+	n      int
+}
+
+func (r *roundRobin) push(f discovery.File) {
+	dir := filepath.Dir(f.RelativePath)
+	if _, ok := r.queues[dir]; !ok {
+		r.dirs = append(r.dirs, dir)
+	}
+	r.queues[dir] = append(r.queues[dir], f)
+	r.n++
+}
+
+func (r *roundRobin) pop() discovery.File {
+	if r.next >= len(r.dirs) {
+		r.next = 0
+	}
+	dir := r.dirs[r.next]
+	queue := r.queues[dir]
+	f := queue[0]
+	r.n--
+	if len(queue) == 1 {
+		delete(r.queues, dir)
+		r.dirs = append(r.dirs[:r.next], r.dirs[r.next+1:]...)
+	} else {
+		r.queues[dir] = queue[1:]
+		r.next++
+	}
+	return f
+}
+
+func (r *roundRobin) len() int { return r.n }
+
+// fifo keeps the walk order
+type fifo struct {
+	files []discovery.File
+}
+
+func (q *fifo) push(f discovery.File) { q.files = append(q.files, f) }
+
+func (q *fifo) pop() discovery.File {
+	f := q.files[0]
+	q.files = q.files[1:]
+	return f
+}
+
+func (q *fifo) len() int { return len(q.files) }
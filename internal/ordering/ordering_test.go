@@ -0,0 +1,96 @@
+package ordering
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+)
+
+func TestParseMode(t *testing.T) {
+	for _, name := range []string{"", "newest", "taken", "smallest", "round-robin"} {
+		mode, err := ParseMode(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, Mode(name), mode)
+	}
+	mode, err := ParseMode("walk")
+	require.NoError(t, err)
+	assert.Equal(t, ModeNone, mode)
+
+	_, err = ParseMode("oldest")
+	assert.Error(t, err)
+}
+
+// library creates files with the given sizes, each an hour newer than the
+// one before
+func library(t *testing.T, names []string, sizes []int) []discovery.File {
+	root := t.TempDir()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var files []discovery.File
+	for i, name := range names {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", sizes[i])), 0644))
+		mtime := start.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+		files = append(files, discovery.File{Path: path, RelativePath: name})
+	}
+	return files
+}
+
+func run(files []discovery.File, mode Mode, window int) []string {
+	in := make(chan discovery.File)
+	out := make(chan discovery.File)
+	go func() {
+		defer close(in)
+		for _, f := range files {
+			in <- f
+		}
+	}()
+	go Stream(in, out, mode, window)
+
+	var names []string
+	for f := range out {
+		names = append(names, f.RelativePath)
+	}
+	return names
+}
+
+func TestStream_Newest(t *testing.T) {
+	files := library(t, []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}, []int{1, 1, 1, 1})
+
+	assert.Equal(t, []string{"d.jpg", "c.jpg", "b.jpg", "a.jpg"}, run(files, ModeNewest, 10))
+	// Taken falls back to the modification time without EXIF
+	assert.Equal(t, []string{"d.jpg", "c.jpg", "b.jpg", "a.jpg"}, run(files, ModeTaken, 10))
+}
+
+func TestStream_Smallest(t *testing.T) {
+	files := library(t, []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}, []int{30, 10, 40, 10})
+
+	// Equal sizes keep the walk order
+	assert.Equal(t, []string{"b.jpg", "d.jpg", "a.jpg", "c.jpg"}, run(files, ModeSmallest, 10))
+}
+
+func TestStream_RoundRobin(t *testing.T) {
+	files := library(t,
+		[]string{"x/1.jpg", "x/2.jpg", "x/3.jpg", "y/1.jpg", "z/1.jpg", "z/2.jpg"},
+		[]int{1, 1, 1, 1, 1, 1})
+
+	assert.Equal(t,
+		[]string{"x/1.jpg", "y/1.jpg", "z/1.jpg", "x/2.jpg", "z/2.jpg", "x/3.jpg"},
+		run(files, ModeRoundRobin, 10))
+}
+
+func TestStream_Window(t *testing.T) {
+	files := library(t, []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}, []int{4, 3, 2, 1})
+
+	// With room for two files, the smallest of the first three goes first
+	assert.Equal(t, []string{"c.jpg", "d.jpg", "b.jpg", "a.jpg"}, run(files, ModeSmallest, 2))
+	assert.Equal(t, []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}, run(files, ModeNone, 2))
+}
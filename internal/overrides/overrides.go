@@ -0,0 +1,131 @@
+package overrides
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the settings file of a folder in the input
+const FileName = ".frameo.yaml"
+
+// Settings are the settings a folder overrides for itself and its
+// subfolders. Unset settings are nil.
+type Settings struct {
+	Resolution   *string  `yaml:"resolution"`
+	Quality      *int     `yaml:"quality"`
+	Crop         *string  `yaml:"crop"`
+	Lossless     *bool    `yaml:"lossless"`
+	NearLossless *int     `yaml:"near-lossless"`
+	Resample     *string  `yaml:"resample"`
+	Enhance      []string `yaml:"enhance"`
+}
+
+// IsZero reports whether no setting is overridden
+func (s Settings) IsZero() bool {
+	return s.Resolution == nil && s.Quality == nil && s.Crop == nil && s.Lossless == nil &&
+		s.NearLossless == nil && s.Resample == nil && s.Enhance == nil
+}
+
+// merge returns s with the settings of a deeper folder on top
+func (s Settings) merge(deeper Settings) Settings {
+	if deeper.Resolution != nil {
+		s.Resolution = deeper.Resolution
+	}
+	if deeper.Quality != nil {
+		s.Quality = deeper.Quality
+	}
+	if deeper.Crop != nil {
+		s.Crop = deeper.Crop
+	}
+	if deeper.Lossless != nil {
+		s.Lossless = deeper.Lossless
+	}
+	if deeper.NearLossless != nil {
+		s.NearLossless = deeper.NearLossless
+	}
+	if deeper.Resample != nil {
+		s.Resample = deeper.Resample
+	}
+	if deeper.Enhance != nil {
+		s.Enhance = deeper.Enhance
+	}
+	return s
+}
+
+// Tree finds the settings files of an input directory as files are
+// looked up. It is safe for concurrent use.
+type Tree struct {
+	root string
+
+	mu   sync.Mutex
+	dirs map[string]folder // Keyed by directory relative to root
+}
+
+// folder holds the merged settings of a directory and its parents
+type folder struct {
+	settings Settings
+	err      error
+}
+
+// NewTree creates a tree for an input directory
+func NewTree(root string) *Tree {
+	return &Tree{root: root, dirs: make(map[string]folder)}
+}
+
+// For returns the settings of a file, given relative to the input
+// directory, merged from the settings files of its folder and all folders
+// above it, the nearest one winning
+func (t *Tree) For(relPath string) (Settings, error) {
+	f := t.folder(filepath.Dir(relPath))
+	return f.settings, f.err
+}
+
+func (t *Tree) folder(dir string) folder {
+	t.mu.Lock()
+	f, ok := t.dirs[dir]
+	t.mu.Unlock()
+	if ok {
+		return f
+	}
+
+	if dir != "." {
+		f = t.folder(filepath.Dir(dir))
+	}
+	if f.err == nil {
+		settings, err := load(filepath.Join(t.root, dir, FileName))
+		f = folder{settings: f.settings.merge(settings), err: err}
+	}
+
+	t.mu.Lock()
+	t.dirs[dir] = f
+	t.mu.Unlock()
+	return f
+}
+
+// load reads a settings file, a missing file overrides nothing
+func load(path string) (Settings, error) {
+	var s Settings
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to read folder settings: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return s, fmt.Errorf("failed to parse folder settings %s: %w", path, err)
+	}
+	log.Debug().Str("file", path).Msg("Loaded folder settings")
+	return s, nil
+}
@@ -0,0 +1,59 @@
+package overrides
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTree_For(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		FileName:                             "quality: 70\ncrop: center\n",
+		filepath.Join("portraits", FileName): "crop: faces\nenhance: [sharpen]\n",
+		filepath.Join("portraits", "kids", FileName): "quality: 90\n",
+		filepath.Join("empty", FileName):             "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	tree := NewTree(root)
+
+	s, err := tree.For("photo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 70, *s.Quality)
+	assert.Equal(t, "center", *s.Crop)
+	assert.Nil(t, s.Enhance)
+
+	// The nearest folder wins, everything else is inherited
+	s, err = tree.For("portraits/kids/2020/photo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 90, *s.Quality)
+	assert.Equal(t, "faces", *s.Crop)
+	assert.Equal(t, []string{"sharpen"}, s.Enhance)
+	assert.Nil(t, s.Resolution)
+
+	s, err = tree.For("empty/photo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 70, *s.Quality)
+}
+
+func TestTree_Invalid(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "typo"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "typo", FileName), []byte("qualty: 90\n"), 0644))
+	tree := NewTree(root)
+
+	s, err := tree.For("photo.jpg")
+	require.NoError(t, err)
+	assert.True(t, s.IsZero())
+
+	// Unknown settings fail the whole subtree
+	_, err = tree.For("typo/sub/photo.jpg")
+	assert.ErrorContains(t, err, "qualty")
+}
@@ -0,0 +1,36 @@
+package phash
+
+import (
+	"image"
+	"math/bits"
+
+	"github.com/disintegration/imaging"
+)
+
+// Hash is a 64-bit perceptual hash
+type Hash uint64
+
+// DHash computes a difference hash: the image is reduced to 9x8 grayscale
+// and each bit records whether a pixel is brighter than its right neighbour.
+// Resized, recompressed or slightly retouched copies produce (nearly) the same hash.
+func DHash(img image.Image) Hash {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+
+	var h Hash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := small.Pix[y*small.Stride+x*4]
+			right := small.Pix[y*small.Stride+(x+1)*4]
+			h <<= 1
+			if left > right {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// Distance returns the Hamming distance between two hashes (0 = identical)
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
@@ -0,0 +1,47 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func gradient(w, h int, invert bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x*255/w + y*64/h) % 256)
+			if (x/(w/4))%2 == 1 {
+				v = 255 - v
+			}
+			if invert {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return img
+}
+
+func TestDHash_ResizedCopyMatches(t *testing.T) {
+	original := gradient(800, 600, false)
+	resized := imaging.Resize(original, 320, 240, imaging.Lanczos)
+
+	assert.LessOrEqual(t, Distance(DHash(original), DHash(resized)), 2)
+}
+
+func TestDHash_DifferentImagesDiffer(t *testing.T) {
+	a := DHash(gradient(800, 600, false))
+	b := DHash(gradient(800, 600, true))
+
+	assert.Greater(t, Distance(a, b), 20)
+}
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, Distance(0xff, 0xff))
+	assert.Equal(t, 8, Distance(0xff, 0x00))
+	assert.Equal(t, 64, Distance(0, ^Hash(0)))
+}
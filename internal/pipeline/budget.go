@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Budget limits the memory held by images in flight. Requests are served
+// in order, so a large image waits for room instead of being overtaken by
+// small ones forever.
+type Budget struct {
+	limit int64
+
+	mu      sync.Mutex
+	used    int64
+	waiting []*request
+}
+
+type request struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewBudget creates a budget of limit bytes, 0 means unlimited
+func NewBudget(limit int64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Acquire blocks until n bytes fit into the budget. A request larger than
+// the whole budget runs once nothing else is held.
+func (b *Budget) Acquire(n int64) {
+	if b.limit <= 0 {
+		return
+	}
+	b.mu.Lock()
+	if len(b.waiting) == 0 && b.fits(n) {
+		b.used += n
+		b.mu.Unlock()
+		return
+	}
+	r := &request{n: n, ready: make(chan struct{})}
+	b.waiting = append(b.waiting, r)
+	b.mu.Unlock()
+	<-r.ready
+}
+
+// Release returns n bytes to the budget
+func (b *Budget) Release(n int64) {
+	if b.limit <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	for len(b.waiting) > 0 && b.fits(b.waiting[0].n) {
+		r := b.waiting[0]
+		b.waiting = b.waiting[1:]
+		b.used += r.n
+		close(r.ready)
+	}
+}
+
+// Used returns the bytes currently held
+func (b *Budget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+func (b *Budget) fits(n int64) bool {
+	return b.used == 0 || b.used+n <= b.limit
+}
+
+// ParseSize reads a size such as "2GB", "512MiB" or "1500000". Decimal
+// and binary units are both taken as powers of 1024, like most tools do
+// for memory.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	if value == "" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
+	}
+	scale := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			value, scale = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s (expected e.g. 512MB or 2GB)", s)
+	}
+	return int64(n * float64(scale)), nil
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"1500", 1500},
+		{"2GB", 2 << 30},
+		{"2 gb", 2 << 30},
+		{"512MiB", 512 << 20},
+		{"1.5G", 3 << 29},
+		{"64k", 64 << 10},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, in := range []string{"lots", "-1GB", "GB"} {
+		_, err := ParseSize(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(100)
+	b.Acquire(60)
+
+	acquired := make(chan int64, 2)
+	go func() {
+		b.Acquire(50)
+		acquired <- 50
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("must wait for room")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	b.Release(60)
+	assert.Equal(t, int64(50), <-acquired)
+	assert.Equal(t, int64(50), b.Used())
+	b.Release(50)
+	assert.Equal(t, int64(0), b.Used())
+}
+
+func TestBudget_Oversized(t *testing.T) {
+	b := NewBudget(100)
+
+	// Larger than the budget, but alone
+	done := make(chan struct{})
+	go func() {
+		b.Acquire(500)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("an oversized request must run alone")
+	}
+	b.Release(500)
+}
+
+func TestBudget_InOrder(t *testing.T) {
+	b := NewBudget(100)
+	b.Acquire(95)
+
+	// A small request that would fit waits behind a large one queued first
+	acquired := make(chan int64, 2)
+	go func() {
+		b.Acquire(80)
+		acquired <- 80
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		b.Acquire(5)
+		acquired <- 5
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, acquired)
+
+	b.Release(95)
+	assert.ElementsMatch(t, []int64{80, 5}, []int64{<-acquired, <-acquired})
+	assert.Equal(t, int64(85), b.Used())
+}
+
+func TestBudget_Unlimited(t *testing.T) {
+	b := NewBudget(0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Acquire(1 << 40)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(0), b.Used())
+}
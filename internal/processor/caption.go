@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tgagor/frameo-miniatures/internal/caption"
+	"github.com/tgagor/frameo-miniatures/internal/geo"
+	"github.com/tgagor/frameo-miniatures/internal/metadata"
+)
+
+// captionVars collects the values available to caption templates
+func captionVars(srcPath string, captureTime time.Time) caption.Vars {
+	vars := caption.Vars{
+		Taken: captureTime,
+		Values: map[string]string{
+			"folder": filepath.Base(filepath.Dir(srcPath)),
+			"name":   strings.TrimSuffix(filepath.Base(srcPath), filepath.Ext(srcPath)),
+		},
+	}
+
+	m, err := metadata.Read(srcPath)
+	if err != nil {
+		return vars
+	}
+	if vars.Taken.IsZero() {
+		vars.Taken = m.Taken
+	}
+	vars.Values["make"] = m.Make
+	vars.Values["model"] = m.Model
+	vars.Values["camera"] = m.Model
+	if !strings.HasPrefix(strings.ToLower(m.Model), strings.ToLower(m.Make)) {
+		// "Canon EOS 5D" already names the maker, "iPhone 15" doesn't
+		vars.Values["camera"] = strings.TrimSpace(m.Make + " " + m.Model)
+	}
+	vars.Values["title"] = m.Title
+	vars.Values["description"] = m.Description
+	vars.Values["keywords"] = strings.Join(m.Keywords, ", ")
+	if m.HasGPS {
+		if place, ok := geo.Lookup(m.Latitude, m.Longitude); ok {
+			vars.Values["city"] = place.City
+			vars.Values["country"] = place.Country
+			vars.Values["place"] = place.String()
+		}
+	}
+	if m.Rating > 0 {
+		vars.Values["rating"] = strconv.Itoa(m.Rating)
+	}
+	return vars
+}
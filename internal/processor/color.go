@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/icc"
+)
+
+// readColors returns the colour description of a source file. Files
+// without one are sRGB.
+func readColors(f *os.File, srcPath string) icc.Source {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return icc.Source{}
+	}
+
+	var colors icc.Source
+	var err error
+	if strings.ToLower(filepath.Ext(srcPath)) == ".heic" {
+		colors, err = icc.ReadHEIC(f)
+	} else {
+		colors, err = icc.ReadJPEG(f)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("file", srcPath).Str("stage", StageDecode).Msg("Failed to read colour profile")
+	}
+	return colors
+}
+
+// toSRGB converts the pixels to sRGB, unless the profile is ignored or
+// embedded in the output as it is
+func (p *Processor) toSRGB(img image.Image, colors icc.Source, srcPath string) image.Image {
+	if p.ColorProfile == "ignore" || colors.Empty() || (p.ColorProfile == "embed" && len(colors.ICC) > 0) {
+		return img
+	}
+	if len(colors.ICC) == 0 && colors.NCLX != nil && colors.NCLX.HDR() {
+		// Tone mapping already produced sRGB
+		return img
+	}
+
+	profile, err := colors.Profile()
+	if err != nil {
+		log.Warn().Err(err).Str("file", srcPath).Str("stage", StageTransform).Msg("Cannot convert colour profile, keeping colours as they are")
+		return img
+	}
+	if profile.IsSRGB() {
+		return img
+	}
+	log.Debug().Str("file", srcPath).Str("stage", StageTransform).Str("profile", profile.Description).Msg("Converting to sRGB")
+	return profile.ToSRGB(img)
+}
+
+// embedProfile stores an ICC profile in encoded output
+func embedProfile(data []byte, container string, profile []byte) ([]byte, error) {
+	switch container {
+	case "webp":
+		return webp.SetMetadata(data, profile, "ICCP")
+	case "jpg":
+		return icc.EmbedJPEG(data, profile)
+	}
+	return data, fmt.Errorf("unsupported container: %s", container)
+}
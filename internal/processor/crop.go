@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/faces"
+)
+
+// needsFaces reports whether faces are detected in every photo
+func (p *Processor) needsFaces() bool {
+	return p.Crop == "faces" || p.FaceFilter != nil
+}
+
+// detectFaces finds the faces in a photo and reports them to FacesFound
+func (p *Processor) detectFaces(img image.Image, srcPath string) []faces.Face {
+	found := faces.Detect(img)
+	log.Debug().Str("file", srcPath).Int("faces", len(found)).Msg("Detected faces")
+	if p.FacesFound != nil {
+		p.FacesFound(srcPath, len(found))
+	}
+	return found
+}
+
+// frameImage resizes the image for the frame according to the crop mode.
+// The "faces" crop keeps the given faces inside the frame.
+func (p *Processor) frameImage(img image.Image, found []faces.Face) image.Image {
+	switch p.Crop {
+	case "center":
+		return p.fillFrame(img, nil)
+	case "faces":
+		return p.fillFrame(img, found)
+	}
+	return p.fitToFrame(img)
+}
+
+// fillFrame cuts the image to the frame's aspect ratio, keeping the faces
+// inside, and resizes it to cover the frame. Small images are not enlarged.
+func (p *Processor) fillFrame(img image.Image, found []faces.Face) image.Image {
+	targetW, targetH := p.frameSize(img)
+	if targetW <= 0 || targetH <= 0 {
+		return img
+	}
+
+	window := faces.Window(img.Bounds(), float64(targetW)/float64(targetH), found)
+	img = imaging.Crop(img, window)
+	if window.Dx() <= targetW {
+		return img
+	}
+	return p.resize(img, targetW, targetH)
+}
+
+// CountFaces returns the number of faces in a photo, as seen after its
+// orientation and crop are applied
+func (p *Processor) CountFaces(srcPath string) (int, error) {
+	img, err := p.LoadImage(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	return len(faces.Detect(img)), nil
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/xmp"
+)
+
+// applyEdits crops the image as recorded in its XMP sidecar and rotates it
+// upright. A tiff:Orientation in the sidecar overrides the EXIF orientation,
+// photo managers store rotations there without touching the original.
+func (p *Processor) applyEdits(img image.Image, srcPath string) image.Image {
+	orientation := exifOrientation(srcPath)
+
+	if p.ApplyEdits {
+		packet, _, err := xmp.LoadSidecar(srcPath)
+		if err != nil {
+			log.Warn().Err(err).Str("file", srcPath).Msg("Failed to read XMP sidecar")
+		}
+		if packet != nil {
+			// Crops are relative to the stored image, so they go first
+			if crop, ok := packet.Crop(); ok {
+				img = cropImage(img, crop)
+			}
+			if o, ok := packet.Orientation(); ok {
+				orientation = o
+			}
+		}
+	}
+
+	return applyOrientation(img, orientation)
+}
+
+// cropImage straightens the image around its centre and cuts out the crop rectangle
+func cropImage(img image.Image, crop xmp.Crop) image.Image {
+	if crop.Angle != 0 {
+		bounds := img.Bounds()
+		rotated := imaging.Rotate(img, crop.Angle, color.Black)
+		img = imaging.CropCenter(rotated, bounds.Dx(), bounds.Dy())
+	}
+
+	bounds := img.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	rect := image.Rect(
+		bounds.Min.X+int(math.Round(crop.Left*w)),
+		bounds.Min.Y+int(math.Round(crop.Top*h)),
+		bounds.Min.X+int(math.Round(crop.Right*w)),
+		bounds.Min.Y+int(math.Round(crop.Bottom*h)),
+	)
+	if rect.Empty() {
+		return img
+	}
+	return imaging.Crop(img, rect)
+}
@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+
+	"github.com/chai2010/webp"
+)
+
+// DefaultAutoMaxColors is the colour count up to which the "auto" format
+// treats an image as graphics (screenshot, scan, drawing) and encodes it losslessly
+const DefaultAutoMaxColors = 4096
+
+// EncoderOptions holds format specific encoder settings.
+// Only options supported by the underlying encoders are exposed:
+// chai2010/webp offers lossless and exact modes, while the standard
+// image/jpeg encoder only takes a quality setting.
+type EncoderOptions struct {
+	// Lossless enables lossless WebP encoding (Quality is ignored)
+	Lossless bool
+	// NearLossless (0-100) pre-quantizes pixels before lossless encoding,
+	// trading a little precision for size. 100 disables it, like cwebp.
+	NearLossless int
+	// Exact preserves RGB values under fully transparent pixels
+	Exact bool
+	// AutoMaxColors is the colour count threshold used by the "auto" format
+	AutoMaxColors int
+}
+
+// DefaultEncoderOptions returns the encoder settings used when nothing is configured
+func DefaultEncoderOptions() EncoderOptions {
+	return EncoderOptions{
+		NearLossless:  100,
+		AutoMaxColors: DefaultAutoMaxColors,
+	}
+}
+
+// encode encodes the image and returns the data together with the
+// container format that was actually written ("webp" or "jpg")
+func (p *Processor) encode(img image.Image, lossless bool) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if p.Format == "jpg" || p.Format == "jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.Quality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+		return buf.Bytes(), "jpg", nil
+	}
+
+	// Default to WebP
+	opts := &webp.Options{
+		Quality: float32(p.Quality),
+		Exact:   p.Encoder.Exact,
+	}
+	if lossless {
+		opts.Lossless = true
+		if p.Encoder.NearLossless < 100 {
+			img = nearLossless(img, p.Encoder.NearLossless)
+		}
+	}
+	if err := webp.Encode(&buf, img, opts); err != nil {
+		return nil, "", fmt.Errorf("failed to encode webp: %w", err)
+	}
+	return buf.Bytes(), "webp", nil
+}
+
+// wantsLossless decides whether the image should be encoded losslessly.
+// It must be called on the source image, before resampling introduces new colours.
+func (p *Processor) wantsLossless(img image.Image) bool {
+	switch p.Format {
+	case "auto":
+		maxColors := p.Encoder.AutoMaxColors
+		if maxColors <= 0 {
+			maxColors = DefaultAutoMaxColors
+		}
+		return countColors(img, maxColors) <= maxColors
+	case "jpg", "jpeg":
+		return false
+	default:
+		return p.Encoder.Lossless
+	}
+}
+
+// countColors counts distinct colours in the image, giving up once limit is exceeded
+func countColors(img image.Image, limit int) int {
+	seen := make(map[uint32]struct{}, limit+1)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			key := (r>>8)<<24 | (g>>8)<<16 | (b>>8)<<8 | a>>8
+			seen[key] = struct{}{}
+			if len(seen) > limit {
+				return len(seen)
+			}
+		}
+	}
+	return len(seen)
+}
+
+// nearLossless rounds channel values to a coarser grid, which lets the lossless
+// encoder find more repetitions. Level 100 keeps all bits, level 0 drops 5 bits.
+func nearLossless(img image.Image, level int) image.Image {
+	if level < 0 {
+		level = 0
+	}
+	shift := uint(5 - level/20)
+	if shift == 0 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+
+	half := 1 << (shift - 1)
+	quantize := func(v uint8) uint8 {
+		q := ((int(v) + half) >> shift) << shift
+		if q > 255 {
+			q = 255
+		}
+		return uint8(q)
+	}
+
+	for i := 0; i < len(out.Pix); i += 4 {
+		out.Pix[i] = quantize(out.Pix[i])
+		out.Pix[i+1] = quantize(out.Pix[i+1])
+		out.Pix[i+2] = quantize(out.Pix[i+2])
+	}
+	return out
+}
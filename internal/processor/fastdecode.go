@@ -0,0 +1,239 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// decodeFast decodes a file for the frame, cheaply if FastDecode is set.
+// It returns how many times smaller than the source the image is, so that
+// resolution checks still see the source size.
+//
+// Go's JPEG decoder can't decode at a reduced DCT scale, so the fast path
+// uses an embedded preview when one covers the frame, and otherwise
+// shrinks the decoded image by 2, 4 or 8 before anything else touches it.
+func (p *Processor) decodeFast(f *os.File, srcPath string) (image.Image, float64, error) {
+	if p.FastDecode && isJPEG(srcPath) {
+		if img, reduction := p.decodePreview(f); img != nil {
+			log.Debug().Str("file", srcPath).Str("stage", StageDecode).Float64("reduction", reduction).Msg("Using embedded preview")
+			return img, reduction, nil
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	img, _, err := p.decode(f, srcPath)
+	if err != nil || !p.FastDecode {
+		return img, 1, err
+	}
+
+	ycc, ok := img.(*image.YCbCr)
+	if !ok {
+		return img, 1, nil
+	}
+	factor := p.shrinkFactor(ycc.Rect.Dx(), ycc.Rect.Dy())
+	if factor == 1 {
+		return img, 1, nil
+	}
+	return shrinkYCbCr(ycc, factor), float64(factor), nil
+}
+
+func isJPEG(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// shrinkFactor returns the largest power of two, up to 8, by which an
+// image can shrink while staying twice the frame size. The final resize
+// then still has enough pixels for a sharp result.
+func (p *Processor) shrinkFactor(width, height int) int {
+	long, short := max(width, height), min(width, height)
+	frameLong, frameShort := max(p.Width, p.Height), min(p.Width, p.Height)
+	if frameShort <= 0 {
+		return 1
+	}
+	factor := 1
+	for factor < 8 && long/(factor*2) >= 2*frameLong && short/(factor*2) >= 2*frameShort {
+		factor *= 2
+	}
+	return factor
+}
+
+// shrinkYCbCr averages blocks of factor x factor samples in every plane
+func shrinkYCbCr(src *image.YCbCr, factor int) *image.YCbCr {
+	w, h := src.Rect.Dx()/factor, src.Rect.Dy()/factor
+	dst := image.NewYCbCr(image.Rect(0, 0, w, h), src.SubsampleRatio)
+
+	shrink := func(dstPlane []uint8, dstStride, dstW, dstH int, srcPlane []uint8, srcStride, srcW, srcH int) {
+		n := factor * factor
+		for y := 0; y < dstH; y++ {
+			for x := 0; x < dstW; x++ {
+				sum := 0
+				for dy := 0; dy < factor; dy++ {
+					row := srcPlane[min(y*factor+dy, srcH-1)*srcStride:]
+					for dx := 0; dx < factor; dx++ {
+						sum += int(row[min(x*factor+dx, srcW-1)])
+					}
+				}
+				dstPlane[y*dstStride+x] = uint8((sum + n/2) / n)
+			}
+		}
+	}
+
+	yOff := src.YOffset(src.Rect.Min.X, src.Rect.Min.Y)
+	shrink(dst.Y, dst.YStride, w, h, src.Y[yOff:], src.YStride, src.Rect.Dx(), src.Rect.Dy())
+
+	// Chroma planes span whole rows of their stride
+	cOff := src.COffset(src.Rect.Min.X, src.Rect.Min.Y)
+	srcCH := len(src.Cb[cOff:]) / src.CStride
+	dstCH := len(dst.Cb) / dst.CStride
+	shrink(dst.Cb, dst.CStride, dst.CStride, dstCH, src.Cb[cOff:], src.CStride, src.CStride, srcCH)
+	shrink(dst.Cr, dst.CStride, dst.CStride, dstCH, src.Cr[cOff:], src.CStride, src.CStride, srcCH)
+	return dst
+}
+
+// decodePreview decodes the smallest MPF preview of a JPEG that covers the
+// frame and has the aspect ratio of the photo. Cameras store these next to
+// the full image; phones rarely do.
+func (p *Processor) decodePreview(f *os.File) (image.Image, float64) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0
+	}
+	main, err := jpeg.DecodeConfig(f)
+	if err != nil || main.Width == 0 || main.Height == 0 {
+		return nil, 0
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0
+	}
+	previews := readMPF(f)
+
+	frameLong, frameShort := max(p.Width, p.Height), min(p.Width, p.Height)
+	var best *io.SectionReader
+	bestWidth := 0
+	for _, preview := range previews {
+		cfg, err := jpeg.DecodeConfig(io.NewSectionReader(f, preview.offset, preview.size))
+		if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+			continue
+		}
+		if max(cfg.Width, cfg.Height) < frameLong || min(cfg.Width, cfg.Height) < frameShort {
+			continue
+		}
+		// Depth maps and other auxiliary images don't match the photo
+		aspect := float64(cfg.Width) / float64(cfg.Height)
+		if math.Abs(aspect/(float64(main.Width)/float64(main.Height))-1) > 0.01 {
+			continue
+		}
+		if cfg.Width >= main.Width || (best != nil && cfg.Width >= bestWidth) {
+			continue
+		}
+		best, bestWidth = io.NewSectionReader(f, preview.offset, preview.size), cfg.Width
+	}
+	if best == nil {
+		return nil, 0
+	}
+
+	img, err := jpeg.Decode(best)
+	if err != nil {
+		return nil, 0
+	}
+	return img, float64(main.Width) / float64(bestWidth)
+}
+
+type mpfImage struct {
+	offset, size int64 // In the file
+}
+
+// readMPF lists the images of a CIPA DC-007 Multi-Picture Format index,
+// except the first, which is the JPEG itself
+func readMPF(r io.Reader) []mpfImage {
+	br := bufio.NewReader(r)
+	var pos int64
+	read := func(n int) []byte {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil
+		}
+		pos += int64(n)
+		return buf
+	}
+
+	if soi := read(2); soi == nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil
+	}
+	for {
+		marker := read(4)
+		if marker == nil || marker[0] != 0xFF || marker[1] == 0xDA {
+			return nil
+		}
+		// The length includes its own two bytes, less is a broken file
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil
+		}
+		start := pos
+		segment := read(length)
+		if segment == nil {
+			return nil
+		}
+		if marker[1] == 0xE2 && len(segment) > 8 && string(segment[:4]) == "MPF\x00" {
+			return parseMPF(segment[4:], start+4)
+		}
+	}
+}
+
+// parseMPF reads the MP entries of an index IFD. Offsets in it are
+// relative to the TIFF header at base.
+func parseMPF(tiff []byte, base int64) []mpfImage {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return nil
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			return nil
+		}
+		if order.Uint16(tiff[entry:]) != 0xB002 {
+			continue
+		}
+		size := int(order.Uint32(tiff[entry+4:]))
+		offset := int(order.Uint32(tiff[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(tiff) {
+			return nil
+		}
+
+		var images []mpfImage
+		for e := offset + 16; e+16 <= offset+size; e += 16 {
+			images = append(images, mpfImage{
+				offset: base + int64(order.Uint32(tiff[e+8:])),
+				size:   int64(order.Uint32(tiff[e+4:])),
+			})
+		}
+		return images
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrium/goheif"
+)
+
+// Rough peak memory per source pixel while a photo is decoded, rotated and
+// resized: the decoded planes, an RGBA copy for rotation and the resampling
+// buffers. High bit depth HEICs keep 16-bit samples on top.
+const (
+	bytesPerPixel     = 10
+	bytesPerPixelHEIC = 18
+)
+
+// EstimateMemory guesses the memory needed to process a file from its
+// dimensions, without decoding it
+func EstimateMemory(srcPath string) int64 {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	perPixel := int64(bytesPerPixel)
+	var cfg image.Config
+	if strings.ToLower(filepath.Ext(srcPath)) == ".heic" {
+		perPixel = bytesPerPixelHEIC
+		cfg, err = goheif.DecodeConfig(f)
+	} else {
+		cfg, _, err = image.DecodeConfig(f)
+	}
+	if err != nil {
+		// Compressed photos are around a tenth of their decoded size
+		if info, err := f.Stat(); err == nil {
+			return info.Size() * 10 * perPixel / 4
+		}
+		return 0
+	}
+	return int64(cfg.Width) * int64(cfg.Height) * perPixel
+}
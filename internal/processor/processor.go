@@ -2,23 +2,35 @@ package processor
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"image"
-	"image/jpeg"
-	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/adrium/goheif"
 	"github.com/chai2010/webp"
 	"github.com/disintegration/imaging"
 	"github.com/dsoprea/go-exif/v3"
 	exifcommon "github.com/dsoprea/go-exif/v3/common"
 	jpegstructure "github.com/dsoprea/go-jpeg-image-structure/v2"
 	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/caption"
+	"github.com/tgagor/frameo-miniatures/internal/dedup"
+	"github.com/tgagor/frameo-miniatures/internal/enhance"
+	"github.com/tgagor/frameo-miniatures/internal/faces"
 	"github.com/tgagor/frameo-miniatures/internal/fileutil"
+	"github.com/tgagor/frameo-miniatures/internal/heic"
+	"github.com/tgagor/frameo-miniatures/internal/icc"
+	"github.com/tgagor/frameo-miniatures/internal/manifest"
+	"github.com/tgagor/frameo-miniatures/internal/phash"
+	"github.com/tgagor/frameo-miniatures/internal/quality"
+	"github.com/tgagor/frameo-miniatures/internal/tonemap"
+	"github.com/tgagor/frameo-miniatures/internal/xmp"
 )
 
 // Processor handles image processing
@@ -26,8 +38,39 @@ type Processor struct {
 	Width        int
 	Height       int
 	Quality      int
-	Format       string // "webp" or "jpg"
+	Format       string // "webp", "jpg" or "auto"
 	SkipExisting bool
+	Encoder      EncoderOptions
+	Dedup        *dedup.Index // Optional duplicate detection
+	Burst        *dedup.Index // Optional burst thinning
+	BurstKeep    string       // Burst selection: "sharpest", "exposure" or "resolution"
+	Gates        quality.Gates
+	Manifest     *manifest.Manifest                   // Optional record of the source of every output
+	ApplyEdits   bool                                 // Honour crops and rotations from XMP sidecars
+	Caption      *caption.Renderer                    // Optional text overlay
+	Crop         string                               // Framing: "none" fits the whole photo, "center" or "faces" fill the frame
+	FacesFound   func(srcPath string, faces int)      // Optional, called with the faces found by the "faces" crop or FaceFilter
+	FaceFilter   func(srcPath string, faces int) bool // Optional, photos it rejects are skipped with reason "filter"
+	ColorProfile string                               // "convert" to sRGB, "embed" the source profile or "ignore" it
+	ToneMap      tonemap.Operator                     // How HDR highlights are brought into SDR range
+	Enhance      enhance.Pipeline                     // Optional adjustments after resizing
+	Filter       string                               // Resampling filter, one of Filters
+	LinearLight  bool                                 // Resize in linear light instead of gamma encoded sRGB
+	FastDecode   bool                                 // Use embedded previews or shrink huge photos right after decoding
+	StepTimed    func(step string, d time.Duration)   // Optional, called with the time each step of a file took
+}
+
+// SkipError reports that a file was deliberately not processed
+type SkipError struct {
+	Reason string // Short machine friendly reason, e.g. "duplicate"
+	Detail string
+}
+
+func (e *SkipError) Error() string {
+	if e.Detail == "" {
+		return "skipped: " + e.Reason
+	}
+	return fmt.Sprintf("skipped: %s (%s)", e.Reason, e.Detail)
 }
 
 // NewProcessor creates a new processor
@@ -38,31 +81,96 @@ func NewProcessor(width, height, quality int, format string, skipExisting bool)
 		Quality:      quality,
 		Format:       format,
 		SkipExisting: skipExisting,
+		Encoder:      DefaultEncoderOptions(),
+		ApplyEdits:   true,
+		ColorProfile: "convert",
+		ToneMap:      tonemap.Reinhard,
+		Filter:       "catmullrom",
 	}
 }
 
+// Stages of processing, as named in logs
+const (
+	StageDecode    = "decode"
+	StageTransform = "transform"
+	StageEncode    = "encode"
+)
+
+// Steps within the stages, as reported to StepTimed
+const (
+	StepDecode = "decode"
+	StepExif   = "exif"
+	StepResize = "resize"
+	StepEncode = "encode"
+	StepWrite  = "write"
+)
+
+// Job carries a photo through the stages of ProcessFile. Between Read and
+// Transform it holds the full size image, afterwards only the small one.
+type Job struct {
+	Src     string
+	DestDir string
+
+	img         image.Image
+	shrunk      float64 // How many times smaller than the source img was decoded
+	captureTime time.Time
+	rawExif     []byte
+	colors      icc.Source
+
+	destPath string
+	lossless bool
+	done     bool // Output already up to date, nothing to write
+}
+
+// Output returns the path the miniature is written to, known after Transform
+func (j *Job) Output() string {
+	return j.destPath
+}
+
+// UpToDate reports whether the existing output is kept and Write does
+// nothing
+func (j *Job) UpToDate() bool {
+	return j.done
+}
+
 // ProcessFile processes a single file
 func (p *Processor) ProcessFile(srcPath, destDir string) error {
+	job, err := p.Read(srcPath, destDir)
+	if err != nil {
+		return err
+	}
+	if err := p.Transform(job); err != nil {
+		return err
+	}
+	return p.Write(job)
+}
+
+// Read decodes a file and collects the metadata needed by later stages
+func (p *Processor) Read(srcPath, destDir string) (*Job, error) {
 	// 1. Open file
 	f, err := os.Open(srcPath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer f.Close()
 
 	// 2. Decode image
-	img, _, err := p.decode(f, srcPath)
+	start := time.Now()
+	img, shrunk, err := p.decodeFast(f, srcPath)
 	if err != nil {
-		return fmt.Errorf("failed to decode image: %w", err)
+		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
+	p.timed(StepDecode, start)
+	job := &Job{Src: srcPath, DestDir: destDir, img: img, shrunk: shrunk}
 
 	// 3. Handle EXIF (Rotation & Date)
-	var captureTime time.Time
 
 	// Reset file pointer for EXIF search
+	start = time.Now()
 	f.Seek(0, 0)
 	rawExif, err := exif.SearchAndExtractExifWithReader(f)
 	if err == nil {
+		job.rawExif = rawExif
 		// Parse EXIF
 		entries, _, err := exif.GetFlatExifData(rawExif, nil)
 		if err == nil {
@@ -71,7 +179,7 @@ func (p *Processor) ProcessFile(srcPath, destDir string) error {
 					// Format: "2006:01:02 15:04:05"
 					t, err := time.Parse("2006:01:02 15:04:05", tag.FormattedFirst)
 					if err == nil {
-						captureTime = t
+						job.captureTime = t
 						break
 					}
 				}
@@ -79,6 +187,19 @@ func (p *Processor) ProcessFile(srcPath, destDir string) error {
 		}
 	}
 
+	p.timed(StepExif, start)
+
+	job.colors = readColors(f, srcPath)
+	return job, nil
+}
+
+// Transform turns the decoded image into the one for the frame and decides
+// whether it is written at all. Rejected photos return a *SkipError.
+func (p *Processor) Transform(job *Job) error {
+	srcPath, img := job.Src, job.img
+	// The full size image is not needed past this stage
+	job.img = nil
+
 	// Re-open file for imaging library (it needs path or reader, but let's use the decoded image if possible,
 	// but imaging.Resize takes image.Image, so we are good).
 	// However, we need to apply orientation.
@@ -91,116 +212,185 @@ func (p *Processor) ProcessFile(srcPath, destDir string) error {
 	// Wait, `imaging.Open` supports many formats but maybe not HEIC by default?
 	// Let's stick to manual decoding and then use `imaging` for resizing.
 
-	// Auto-rotate
-	img = p.fixOrientation(img, srcPath)
+	// Auto-rotate, honouring crops and rotations made in photo managers
+	img = p.applyEdits(img, srcPath)
 
-	// 4. Resize
-	// Determine target dimensions based on orientation
-	// We want to optimize for the frame's resolution regardless of its current orientation.
-	// So we define the frame's "Long" and "Short" dimensions.
-	frameLong := p.Width
-	if p.Height > frameLong {
-		frameLong = p.Height
-	}
-	frameShort := p.Width
-	if p.Height < frameShort {
-		frameShort = p.Height
+	// Faces are detected once, on the photo as displayed, for both filtering
+	// and cropping
+	var found []faces.Face
+	if p.needsFaces() {
+		found = p.detectFaces(img, srcPath)
+		if p.FaceFilter != nil && !p.FaceFilter(srcPath, len(found)) {
+			return &SkipError{Reason: "filter", Detail: fmt.Sprintf("%d faces", len(found))}
+		}
 	}
 
-	// Check image orientation
+	// Wide gamut photos look washed out unless converted to sRGB. Resizing
+	// assumes sRGB values, in linear light too, so this comes first.
+	img = p.toSRGB(img, job.colors, srcPath)
+
+	// 4. Resize, judging resolution by the source even if decoded smaller
 	bounds := img.Bounds()
-	imgW, imgH := bounds.Dx(), bounds.Dy()
+	imgW, imgH := int(math.Round(float64(bounds.Dx())*job.shrunk)), int(math.Round(float64(bounds.Dy())*job.shrunk))
 
-	var targetW, targetH int
-	if imgW >= imgH {
-		// Landscape image: Fit into Frame Landscape (Long x Short)
-		targetW = frameLong
-		targetH = frameShort
-	} else {
-		// Portrait image: Fit into Frame Portrait (Short x Long)
-		targetW = frameShort
-		targetH = frameLong
-	}
+	// Colour analysis for the "auto" format has to see the source pixels,
+	// resampling blends edges into many new colours
+	job.lossless = p.wantsLossless(img)
+
+	start := time.Now()
+	img = p.frameImage(img, found)
+	p.timed(StepResize, start)
 
-	// "Fit Within" - imaging.Fit keeps aspect ratio
-	img = imaging.Fit(img, targetW, targetH, imaging.CatmullRom)
+	// Quality gates reject blurry, badly exposed or tiny photos
+	if p.Gates.Enabled() {
+		scores := quality.Measure(img, imgW, imgH)
+		if reason, detail := p.Gates.Check(scores); reason != "" {
+			return &SkipError{Reason: reason, Detail: detail}
+		}
+	}
 
 	// 5. Normalize Filename
 	destFilename := p.normalizeFilename(filepath.Base(srcPath))
-	destPath := filepath.Join(destDir, destFilename)
+	destPath := filepath.Join(job.DestDir, destFilename)
+	job.destPath = destPath
+
+	// Duplicate detection works on the resized image, which hashes the same
+	// as the full one but is much cheaper to reduce
+	var hash phash.Hash
+	if p.Dedup != nil || p.Burst != nil {
+		hash = phash.DHash(img)
+	}
+	if p.Dedup != nil {
+		decision := p.Dedup.Add(dedup.Entry{
+			Path:   srcPath,
+			Output: destPath,
+			Hash:   hash,
+			Width:  imgW,
+			Height: imgH,
+		})
+		if decision.Skip {
+			return &SkipError{Reason: "duplicate", Detail: decision.DuplicateOf}
+		}
+	}
+
+	// Burst thinning keeps only the best of similar shots taken close together
+	if p.Burst != nil && !job.captureTime.IsZero() {
+		decision := p.Burst.Add(dedup.Entry{
+			Path:   srcPath,
+			Output: destPath,
+			Hash:   hash,
+			Width:  imgW,
+			Height: imgH,
+			Taken:  job.captureTime,
+			Score:  p.burstScore(img),
+		})
+		if decision.Skip {
+			return &SkipError{Reason: "burst", Detail: decision.DuplicateOf}
+		}
+	}
 
 	// Check if file exists if SkipExisting is enabled
 	if p.SkipExisting {
-		if _, err := os.Stat(destPath); err == nil {
+		if _, err := os.Stat(destPath); err == nil && p.upToDate(srcPath, destPath) {
 			// File exists, skip
+			p.markWritten(srcPath)
+			job.done = true
 			return nil
 		}
 	}
 
+	// Compensate for the frame's screen and the softening of the resize
+	if len(p.Enhance) > 0 {
+		out := img.Bounds()
+		reduction := math.Min(float64(imgW)/float64(out.Dx()), float64(imgH)/float64(out.Dy()))
+		img = p.Enhance.Apply(img, reduction)
+	}
+
+	// Captions go on last, so hashes and quality scores only see the photo
+	if p.Caption != nil {
+		img = p.Caption.Render(img, p.Caption.Text(captionVars(srcPath, job.captureTime)))
+	}
+
+	job.img = img
+	return nil
+}
+
+// Write encodes the transformed image and writes it with its metadata
+func (p *Processor) Write(job *Job) error {
+	if job.done {
+		return nil
+	}
+	srcPath, destPath := job.Src, job.destPath
+
 	// Ensure dest dir exists
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+	if err := os.MkdirAll(job.DestDir, 0755); err != nil {
 		return fmt.Errorf("failed to create dest dir: %w", err)
 	}
 
 	// 6. Encode to memory buffer first
-	var buf bytes.Buffer
-
-	// Encode based on format
-	if p.Format == "jpg" || p.Format == "jpeg" {
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.Quality})
-		if err != nil {
-			return fmt.Errorf("failed to encode jpeg: %w", err)
-		}
-	} else {
-		// Default to WebP
-		err = webp.Encode(&buf, img, &webp.Options{Quality: float32(p.Quality)})
-		if err != nil {
-			return fmt.Errorf("failed to encode webp: %w", err)
-		}
+	start := time.Now()
+	encodedData, container, err := p.encode(job.img, job.lossless)
+	if err != nil {
+		return err
 	}
+	p.timed(StepEncode, start)
 
 	// 7. Add EXIF metadata to encoded data (before writing to disk)
-	encodedData := buf.Bytes()
-
-	// Reset file pointer for EXIF extraction
-	f.Seek(0, 0)
-	rawExif, err = exif.SearchAndExtractExifWithReader(f)
-	if err == nil {
+	start = time.Now()
+	if job.rawExif != nil {
 		// Rebuild EXIF with only allowed tags
-		rebuiltExif, err := p.rebuildExif(rawExif)
+		rebuiltExif, err := p.rebuildExif(job.rawExif)
 		if err != nil {
-			log.Warn().Err(err).Str("src", srcPath).Msg("Failed to rebuild EXIF, skipping metadata")
+			log.Warn().Err(err).Str("file", srcPath).Str("stage", StageEncode).Msg("Failed to rebuild EXIF, skipping metadata")
 			// If rebuild fails, we skip EXIF entirely to avoid embedding broken/large data
 		} else {
-			rawExif = rebuiltExif
-
 			// We have EXIF data, embed it
-			switch p.Format {
+			switch container {
 			case "webp":
 				// For WebP, use SetMetadata
-				encodedData, err = webp.SetMetadata(encodedData, rawExif, "EXIF")
+				encodedData, err = webp.SetMetadata(encodedData, rebuiltExif, "EXIF")
 				if err != nil {
-					log.Warn().Err(err).Str("src", srcPath).Msg("Failed to embed EXIF in WebP")
+					log.Warn().Err(err).Str("file", srcPath).Str("stage", StageEncode).Msg("Failed to embed EXIF in WebP")
 				}
-			case "jpg", "jpeg":
+			case "jpg":
 				// For JPEG, use go-jpeg-image-structure
-				encodedData, err = p.embedExifInJPEG(encodedData, rawExif)
+				encodedData, err = p.embedExifInJPEG(encodedData, rebuiltExif)
 				if err != nil {
-					log.Warn().Err(err).Str("src", srcPath).Msg("Failed to embed EXIF in JPEG")
+					log.Warn().Err(err).Str("file", srcPath).Str("stage", StageEncode).Msg("Failed to embed EXIF in JPEG")
 				}
 			}
 		}
 	}
 
+	p.timed(StepExif, start)
+
+	if p.ColorProfile == "embed" && len(job.colors.ICC) > 0 {
+		if withProfile, err := embedProfile(encodedData, container, job.colors.ICC); err != nil {
+			log.Warn().Err(err).Str("file", srcPath).Str("stage", StageEncode).Msg("Failed to embed colour profile")
+		} else {
+			encodedData = withProfile
+		}
+	}
+
 	// 8. Write final data to disk (single write operation)
+	start = time.Now()
 	if err := os.WriteFile(destPath, encodedData, 0644); err != nil {
 		return fmt.Errorf("failed to write output file: %w", err)
 	}
+	p.timed(StepWrite, start)
+
+	p.markWritten(srcPath)
+	if p.Manifest != nil {
+		if source, err := manifest.Stat(srcPath, xmp.FindSidecar(srcPath)); err == nil {
+			source.Params = p.Params()
+			p.Manifest.Put(destPath, source)
+		}
+	}
 
 	// 9. Set file modification time
-	if !captureTime.IsZero() {
-		if err := os.Chtimes(destPath, time.Now(), captureTime); err != nil {
-			log.Warn().Err(err).Str("path", destPath).Msg("Failed to set file time")
+	if !job.captureTime.IsZero() {
+		if err := os.Chtimes(destPath, time.Now(), job.captureTime); err != nil {
+			log.Warn().Err(err).Str("file", destPath).Str("stage", StageEncode).Msg("Failed to set file time")
 		}
 	} else {
 		// Fallback to source file mod time
@@ -213,58 +403,240 @@ func (p *Processor) ProcessFile(srcPath, destDir string) error {
 	return nil
 }
 
-func (p *Processor) decode(r io.Reader, path string) (image.Image, string, error) {
+// timed reports the time since start to StepTimed
+func (p *Processor) timed(step string, start time.Time) {
+	if p.StepTimed != nil {
+		p.StepTimed(step, time.Since(start))
+	}
+}
+
+// fitToFrame resizes the image to fit the frame, keeping its aspect ratio
+func (p *Processor) fitToFrame(img image.Image) image.Image {
+	targetW, targetH := p.frameSize(img)
+
+	// "Fit Within" keeps aspect ratio
+	return p.fit(img, targetW, targetH)
+}
+
+// frameSize returns the frame resolution turned to match the image orientation
+func (p *Processor) frameSize(img image.Image) (int, int) {
+	// Determine target dimensions based on orientation
+	// We want to optimize for the frame's resolution regardless of its current orientation.
+	// So we define the frame's "Long" and "Short" dimensions.
+	frameLong := p.Width
+	if p.Height > frameLong {
+		frameLong = p.Height
+	}
+	frameShort := p.Width
+	if p.Height < frameShort {
+		frameShort = p.Height
+	}
+
+	// Check image orientation
+	bounds := img.Bounds()
+	imgW, imgH := bounds.Dx(), bounds.Dy()
+
+	if imgW >= imgH {
+		// Landscape image: Fit into Frame Landscape (Long x Short)
+		return frameLong, frameShort
+	}
+	// Portrait image: Fit into Frame Portrait (Short x Long)
+	return frameShort, frameLong
+}
+
+// Analyze computes the quality scores of a file the same way ProcessFile does for its gates
+func (p *Processor) Analyze(srcPath string) (quality.Scores, error) {
+	img, err := p.LoadImage(srcPath)
+	if err != nil {
+		return quality.Scores{}, err
+	}
+	var found []faces.Face
+	if p.Crop == "faces" {
+		found = p.detectFaces(img, srcPath)
+	}
+	bounds := img.Bounds()
+	return quality.Measure(p.frameImage(img, found), bounds.Dx(), bounds.Dy()), nil
+}
+
+// LoadImage decodes a file and applies its orientation and crop
+func (p *Processor) LoadImage(srcPath string) (image.Image, error) {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	img, _, err := p.decode(f, srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return p.applyEdits(img, srcPath), nil
+}
+
+// upToDate reports whether an existing output still matches its source
+// and the current settings. Without a manifest every existing output
+// counts as current. Outputs missing from the manifest, or recorded
+// without settings, are adopted as they are.
+func (p *Processor) upToDate(srcPath, destPath string) bool {
+	if p.Manifest == nil {
+		return true
+	}
+	current, err := manifest.Stat(srcPath, xmp.FindSidecar(srcPath))
+	if err != nil {
+		return true
+	}
+	current.Params = p.Params()
+	recorded, ok := p.Manifest.Get(destPath)
+	if !ok {
+		p.Manifest.Put(destPath, current)
+		return true
+	}
+	if !recorded.Equal(current) {
+		log.Debug().Str("file", srcPath).Msg("Source or sidecar changed, rebuilding output")
+		return false
+	}
+	if recorded.Params == "" {
+		p.Manifest.Put(destPath, current)
+		return true
+	}
+	if recorded.Params != current.Params {
+		log.Debug().Str("file", srcPath).Msg("Output settings changed, rebuilding output")
+		return false
+	}
+	return true
+}
+
+// Params fingerprints the settings that shape the output, so outputs
+// written with other settings can be told apart
+func (p *Processor) Params() string {
+	settings := struct {
+		Width, Height int
+		Quality       int
+		Format        string
+		Encoder       EncoderOptions
+		ApplyEdits    bool
+		Crop          string
+		ColorProfile  string
+		ToneMap       tonemap.Operator
+		Enhance       enhance.Pipeline
+		Filter        string
+		LinearLight   bool
+		FastDecode    bool
+		Caption       *caption.Options
+	}{
+		Width:        p.Width,
+		Height:       p.Height,
+		Quality:      p.Quality,
+		Format:       p.Format,
+		Encoder:      p.Encoder,
+		ApplyEdits:   p.ApplyEdits,
+		Crop:         p.Crop,
+		ColorProfile: p.ColorProfile,
+		ToneMap:      p.ToneMap,
+		Enhance:      p.Enhance,
+		Filter:       p.Filter,
+		LinearLight:  p.LinearLight,
+		FastDecode:   p.FastDecode,
+	}
+	if p.Caption != nil {
+		opts := p.Caption.Options()
+		settings.Caption = &opts
+	}
+
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// markWritten tells the duplicate indexes that the output of srcPath is on disk
+func (p *Processor) markWritten(srcPath string) {
+	if p.Dedup != nil {
+		p.Dedup.Written(srcPath)
+	}
+	if p.Burst != nil {
+		p.Burst.Written(srcPath)
+	}
+}
+
+// burstScore rates a shot for burst thinning, higher is better.
+// Resolution is the index's tie breaker, so it needs no score of its own.
+func (p *Processor) burstScore(img image.Image) float64 {
+	switch p.BurstKeep {
+	case "exposure":
+		return quality.MeasureExposure(img).Score()
+	case "resolution":
+		return 0
+	default:
+		return quality.Sharpness(img)
+	}
+}
+
+func (p *Processor) decode(f *os.File, path string) (image.Image, string, error) {
 	ext := strings.ToLower(filepath.Ext(path))
 	if ext == ".heic" {
-		img, err := goheif.Decode(r)
+		img, err := heic.Decode(f, p.ToneMap)
 		return img, "heic", err
 	}
-	return image.Decode(r)
+	return image.Decode(f)
 }
 
-func (p *Processor) fixOrientation(img image.Image, path string) image.Image {
-	// Read EXIF orientation
+// exifOrientation reads the EXIF orientation of a file, 1 if unknown
+func exifOrientation(path string) int {
 	f, err := os.Open(path)
 	if err != nil {
-		return img
+		return 1
 	}
 	defer f.Close()
 
 	rawExif, err := exif.SearchAndExtractExifWithReader(f)
 	if err != nil {
-		return img
+		return 1
 	}
 
 	entries, _, err := exif.GetFlatExifData(rawExif, nil)
 	if err != nil {
-		return img
+		return 1
 	}
 
-	var orientation int
 	for _, tag := range entries {
 		if tag.TagName == "Orientation" {
 			if val, ok := tag.Value.([]uint16); ok && len(val) > 0 {
-				orientation = int(val[0])
+				return int(val[0])
 			} else if val, ok := tag.Value.([]uint8); ok && len(val) > 0 { // Sometimes it's byte
-				orientation = int(val[0])
+				return int(val[0])
 			}
 			break
 		}
 	}
+	return 1
+}
 
-	// Apply rotation based on orientation
+// applyOrientation rotates and flips the image so it displays upright
+func applyOrientation(img image.Image, orientation int) image.Image {
 	// 1: Normal
+	// 2: Mirrored horizontally
 	// 3: 180 rotate
+	// 4: Mirrored vertically
+	// 5: Mirrored along the top-left to bottom-right diagonal
 	// 6: 90 CW
+	// 7: Mirrored along the top-right to bottom-left diagonal
 	// 8: 90 CCW
 	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
 	case 3:
 		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
 	case 6:
-		return imaging.Rotate270(img) // 90 CW is 270 CCW? No, Rotate270 is counter-clockwise?
 		// imaging.Rotate270 rotates image 270 degrees counter-clockwise.
 		// Orientation 6 is "The 0th row is at the visual right-hand side, and the 0th column is at the visual top." -> 90 CW.
 		// 90 CW = 270 CCW. So yes.
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
 	case 8:
 		return imaging.Rotate90(img) // 90 CCW
 	}
@@ -379,7 +751,7 @@ func (p *Processor) rebuildExif(rawExif []byte) ([]byte, error) {
 
 		targetIb, err := exif.GetOrCreateIbFromRootIb(ib, tag.IfdPath)
 		if err != nil {
-			log.Debug().Err(err).Str("path", tag.IfdPath).Msg("Failed to get/create IFD builder")
+			log.Debug().Err(err).Str("ifd", tag.IfdPath).Msg("Failed to get/create IFD builder")
 			continue
 		}
 
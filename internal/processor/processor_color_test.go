@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tgagor/frameo-miniatures/internal/icc"
+)
+
+func TestProcessor_ProcessFile_ColorProfile(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "p3.jpg")
+
+	profile, err := os.ReadFile("../icc/testdata/display-p3.icc")
+	require.NoError(t, err)
+
+	// sRGB red, as stored in a Display P3 photo
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, imaging.New(64, 48, color.NRGBA{234, 51, 35, 255}), &jpeg.Options{Quality: 100}))
+	data, err := icc.EmbedJPEG(buf.Bytes(), profile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(srcPath, data, 0644))
+
+	tests := []struct {
+		mode        string
+		want        color.NRGBA
+		keepProfile bool
+	}{
+		{"convert", color.NRGBA{255, 0, 0, 255}, false},
+		{"embed", color.NRGBA{234, 51, 35, 255}, true},
+		{"ignore", color.NRGBA{234, 51, 35, 255}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			destDir := filepath.Join(tmpDir, tt.mode)
+			proc := NewProcessor(100, 100, 100, "jpg", false)
+			proc.ColorProfile = tt.mode
+			require.NoError(t, proc.ProcessFile(srcPath, destDir))
+
+			out, err := os.ReadFile(filepath.Join(destDir, "p3.jpg"))
+			require.NoError(t, err)
+			img, err := jpeg.Decode(bytes.NewReader(out))
+			require.NoError(t, err)
+
+			got := color.NRGBAModel.Convert(img.At(10, 10)).(color.NRGBA)
+			assert.InDelta(t, tt.want.R, got.R, 6, "%v", got)
+			assert.InDelta(t, tt.want.G, got.G, 6, "%v", got)
+			assert.InDelta(t, tt.want.B, got.B, 6, "%v", got)
+
+			colors, err := icc.ReadJPEG(bytes.NewReader(out))
+			require.NoError(t, err)
+			if tt.keepProfile {
+				assert.Equal(t, profile, colors.ICC)
+			} else {
+				assert.True(t, colors.Empty())
+			}
+		})
+	}
+}
+
+func TestProcessor_ToSRGB_Untagged(t *testing.T) {
+	proc := NewProcessor(100, 100, 80, "webp", false)
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	assert.Same(t, img, proc.toSRGB(img, icc.Source{}, "plain.jpg"))
+}
+
+func TestProcessor_Transform_ColorBeforeResize(t *testing.T) {
+	// Fine black and white detail in a space with a linear transfer curve
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(255 * ((x + y) % 2))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	proc := NewProcessor(32, 32, 100, "webp", false)
+	proc.Filter = "box"
+	proc.LinearLight = true
+	job := &Job{
+		Src:     "linear.png",
+		DestDir: t.TempDir(),
+		img:     img,
+		shrunk:  1,
+		colors:  icc.Source{NCLX: &icc.NCLX{Primaries: 1, Transfer: 8, FullRange: true}},
+	}
+	require.NoError(t, proc.Transform(job))
+
+	// Averaging the sRGB values gives half the light. Converting after
+	// resizing would average the source values as if they were sRGB.
+	got := imaging.Clone(job.img).NRGBAAt(16, 16)
+	assert.InDelta(t, 188, int(got.R), 2, "%v", got)
+}
@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tgagor/frameo-miniatures/internal/faces"
+)
+
+func TestProcessor_FrameImage(t *testing.T) {
+	portrait, err := imaging.Open("../faces/testdata/face.jpg")
+	require.NoError(t, err)
+
+	// A panorama with someone standing at the right edge
+	img := imaging.New(3000, 1000, color.NRGBA{230, 230, 230, 255})
+	img = imaging.Paste(img, imaging.Resize(portrait, 0, 900, imaging.Lanczos), image.Pt(2250, 50))
+
+	proc := NewProcessor(800, 600, 80, "webp", false)
+
+	fit := proc.frameImage(img, nil)
+	assert.Equal(t, image.Rect(0, 0, 800, 266), fit.Bounds())
+
+	proc.Crop = "center"
+	center := proc.frameImage(img, nil)
+	assert.Equal(t, image.Rect(0, 0, 800, 600), center.Bounds())
+	assert.Empty(t, faces.Detect(center), "a centre crop cuts the person off")
+
+	proc.Crop = "faces"
+	var counted int
+	proc.FacesFound = func(_ string, n int) { counted = n }
+	framed := proc.frameImage(img, proc.detectFaces(img, "panorama.jpg"))
+	assert.Equal(t, image.Rect(0, 0, 800, 600), framed.Bounds())
+	assert.Len(t, faces.Detect(framed), 1)
+	assert.Equal(t, 1, counted)
+}
+
+func TestProcessor_ProcessFile_FaceFilter(t *testing.T) {
+	src := "../faces/testdata/face.jpg"
+	destDir := t.TempDir()
+
+	// Faces are detected once, shared by the filter and the crop
+	proc := NewProcessor(400, 300, 80, "webp", false)
+	proc.Crop = "faces"
+	detected := 0
+	proc.FacesFound = func(_ string, n int) { detected++ }
+	var filtered []int
+	proc.FaceFilter = func(_ string, n int) bool {
+		filtered = append(filtered, n)
+		return n == 0
+	}
+
+	err := proc.ProcessFile(src, destDir)
+	var skip *SkipError
+	require.True(t, errors.As(err, &skip))
+	assert.Equal(t, "filter", skip.Reason)
+	assert.Equal(t, []int{1}, filtered)
+	assert.Equal(t, 1, detected)
+	assert.NoFileExists(t, filepath.Join(destDir, "face.webp"))
+
+	proc.FaceFilter = func(_ string, n int) bool { return n > 0 }
+	require.NoError(t, proc.ProcessFile(src, destDir))
+	assert.FileExists(t, filepath.Join(destDir, "face.webp"))
+}
+
+func TestProcessor_FillFrame_NoUpscale(t *testing.T) {
+	proc := NewProcessor(800, 600, 80, "webp", false)
+	out := proc.fillFrame(image.NewRGBA(image.Rect(0, 0, 400, 100)), nil)
+	assert.Equal(t, image.Rect(0, 0, 133, 100), out.Bounds())
+}
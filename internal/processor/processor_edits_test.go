@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+)
+
+const cropSidecar = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:crs="http://ns.adobe.com/camera-raw-settings/1.0/" xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+   crs:HasCrop="True" crs:CropLeft="0" crs:CropTop="0" crs:CropRight="0.5" crs:CropBottom="1"
+   tiff:Orientation="8"/>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestProcessor_ProcessFile_XMPEdits(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "edited.jpg")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	f, err := os.Create(srcPath)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, 400, 100)), nil))
+	f.Close()
+	require.NoError(t, os.WriteFile(srcPath+".xmp", []byte(cropSidecar), 0644))
+
+	outputSize := func(proc *Processor) (int, int) {
+		require.NoError(t, proc.ProcessFile(srcPath, destDir))
+		out, err := os.Open(filepath.Join(destDir, "edited.webp"))
+		require.NoError(t, err)
+		defer out.Close()
+		cfg, err := webp.DecodeConfig(out)
+		require.NoError(t, err)
+		return cfg.Width, cfg.Height
+	}
+
+	// The left half (200x100) rotated by 90 degrees
+	w, h := outputSize(NewProcessor(1000, 1000, 80, "webp", false))
+	assert.Equal(t, 100, w)
+	assert.Equal(t, 200, h)
+
+	proc := NewProcessor(1000, 1000, 80, "webp", false)
+	proc.ApplyEdits = false
+	w, h = outputSize(proc)
+	assert.Equal(t, 400, w)
+	assert.Equal(t, 100, h)
+}
+
+func TestApplyOrientation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for o := 1; o <= 8; o++ {
+		b := applyOrientation(img, o).Bounds()
+		if o >= 5 {
+			assert.Equal(t, image.Pt(2, 4), b.Size(), "orientation %d", o)
+		} else {
+			assert.Equal(t, image.Pt(4, 2), b.Size(), "orientation %d", o)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package processor
+
+import (
+	"bytes"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tgagor/frameo-miniatures/internal/enhance"
+)
+
+func TestProcessor_ProcessFile_Enhance(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "dull.jpg")
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, imaging.New(400, 300, color.NRGBA{160, 120, 110, 255}), &jpeg.Options{Quality: 100}))
+	require.NoError(t, os.WriteFile(srcPath, buf.Bytes(), 0644))
+
+	pixel := func(steps ...string) color.NRGBA {
+		destDir := filepath.Join(tmpDir, "out")
+		proc := NewProcessor(100, 100, 100, "jpg", false)
+		var err error
+		proc.Enhance, err = enhance.Parse(steps)
+		require.NoError(t, err)
+		require.NoError(t, proc.ProcessFile(srcPath, destDir))
+
+		img, err := imaging.Open(filepath.Join(destDir, "dull.jpg"))
+		require.NoError(t, err)
+		return color.NRGBAModel.Convert(img.At(50, 30)).(color.NRGBA)
+	}
+
+	plain := pixel()
+	enhanced := pixel("saturation=50", "gamma=1.5")
+	assert.Greater(t, int(enhanced.R)-int(enhanced.B), int(plain.R)-int(plain.B), "saturation must increase")
+	assert.Greater(t, enhanced.G, plain.G, "gamma must brighten midtones")
+}
@@ -1,15 +1,18 @@
 package processor
 
 import (
+	"bytes"
 	"image"
 	"image/color"
 	"image/jpeg"
+	"image/png"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	xwebp "golang.org/x/image/webp"
 )
 
 func TestProcessor_ProcessFile_JPEG_Output(t *testing.T) {
@@ -93,3 +96,103 @@ func TestProcessor_ProcessFile_WebP_Output(t *testing.T) {
 	destPath := filepath.Join(destDir, "test.webp")
 	assert.FileExists(t, destPath)
 }
+
+func TestProcessor_ProcessFile_WebP_Lossless(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "frameo-lossless-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// PNG source so the pixels we compare against are exact
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	srcPath := filepath.Join(tmpDir, "gradient.png")
+	f, err := os.Create(srcPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	f.Close()
+
+	// Target larger than the source, so no resampling happens
+	proc := NewProcessor(400, 200, 10, "webp", false)
+	proc.Encoder.Lossless = true
+
+	destDir := filepath.Join(tmpDir, "dest")
+	require.NoError(t, proc.ProcessFile(srcPath, destDir))
+
+	data, err := os.ReadFile(filepath.Join(destDir, "gradient.webp"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Contains(data[:64], []byte("VP8L")), "expected lossless bitstream")
+
+	out, err := xwebp.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	for _, pt := range []image.Point{{0, 0}, {199, 99}, {57, 33}} {
+		r1, g1, b1, _ := img.At(pt.X, pt.Y).RGBA()
+		r2, g2, b2, _ := out.At(pt.X, pt.Y).RGBA()
+		assert.Equal(t, []uint32{r1, g1, b1}, []uint32{r2, g2, b2}, "pixel %v", pt)
+	}
+}
+
+func TestProcessor_ProcessFile_AutoFormat(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "frameo-auto-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Flat "screenshot" with two colours
+	flat := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			c := color.RGBA{255, 255, 255, 255}
+			if (x/20+y/20)%2 == 0 {
+				c = color.RGBA{0, 0, 0, 255}
+			}
+			flat.Set(x, y, c)
+		}
+	}
+	// Noisy "photo"
+	noisy := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			noisy.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 13), uint8(x * y), 255})
+		}
+	}
+
+	for name, img := range map[string]image.Image{"flat": flat, "noisy": noisy} {
+		f, err := os.Create(filepath.Join(tmpDir, name+".png"))
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(f, img))
+		f.Close()
+	}
+
+	proc := NewProcessor(150, 100, 75, "auto", false)
+	destDir := filepath.Join(tmpDir, "dest")
+	require.NoError(t, proc.ProcessFile(filepath.Join(tmpDir, "flat.png"), destDir))
+	require.NoError(t, proc.ProcessFile(filepath.Join(tmpDir, "noisy.png"), destDir))
+
+	flatData, err := os.ReadFile(filepath.Join(destDir, "flat.webp"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Contains(flatData[:64], []byte("VP8L")), "few colours should be lossless")
+
+	noisyData, err := os.ReadFile(filepath.Join(destDir, "noisy.webp"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Contains(noisyData[:64], []byte("VP8 ")), "many colours should be lossy")
+}
+
+func TestNearLossless(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.RGBA{13, 250, 7, 255})
+
+	// Level 100 is a no-op
+	assert.Equal(t, image.Image(img), nearLossless(img, 100))
+
+	// Level 60 drops 2 bits
+	out := nearLossless(img, 60).(*image.RGBA)
+	assert.Equal(t, []uint8{12, 252, 8, 255}, out.Pix)
+
+	// Rounding never overflows
+	img.Set(0, 0, color.RGBA{255, 255, 255, 255})
+	out = nearLossless(img, 0).(*image.RGBA)
+	assert.Equal(t, []uint8{255, 255, 255, 255}, out.Pix)
+}
@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tgagor/frameo-miniatures/internal/dedup"
+)
+
+// writeJPEGWithDate writes a JPEG carrying only a DateTimeOriginal EXIF tag
+func writeJPEGWithDate(t *testing.T, path string, img image.Image, taken time.Time) {
+	t.Helper()
+
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	require.NoError(t, err)
+	ib := exif.NewIfdBuilder(im, exif.NewTagIndex(), exifcommon.IfdStandardIfdIdentity, exifcommon.EncodeDefaultByteOrder)
+	exifIb, err := exif.GetOrCreateIbFromRootIb(ib, "IFD/Exif")
+	require.NoError(t, err)
+	require.NoError(t, exifIb.SetStandardWithName("DateTimeOriginal", taken.Format("2006:01:02 15:04:05")))
+	rawExif, err := exif.NewIfdByteEncoder().EncodeToExif(ib)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	data, err := (&Processor{}).embedExifInJPEG(buf.Bytes(), rawExif)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func TestProcessor_ProcessFile_BurstThinning(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "frameo-burst-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	sharp := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 600; x++ {
+			v := uint8(x * 255 / 600)
+			if (x/25+y/25)%2 == 0 {
+				v /= 3
+			}
+			sharp.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	blurry := imaging.Blur(sharp, 5)
+
+	taken := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	writeJPEGWithDate(t, filepath.Join(tmpDir, "a.jpg"), blurry, taken)
+	writeJPEGWithDate(t, filepath.Join(tmpDir, "b.jpg"), sharp, taken.Add(time.Second))
+
+	proc := NewProcessor(300, 200, 80, "webp", false)
+	proc.Burst = dedup.NewIndex(dedup.PolicyKeepBest, 12)
+	proc.Burst.Window = 3 * time.Second
+	proc.BurstKeep = "sharpest"
+
+	destDir := filepath.Join(tmpDir, "dest")
+	require.NoError(t, proc.ProcessFile(filepath.Join(tmpDir, "a.jpg"), destDir))
+	assert.FileExists(t, filepath.Join(destDir, "a.webp"))
+
+	// The sharper shot replaces the blurry one, whose output is left for
+	// the caller to remove
+	require.NoError(t, proc.ProcessFile(filepath.Join(tmpDir, "b.jpg"), destDir))
+	assert.FileExists(t, filepath.Join(destDir, "b.webp"))
+	assert.Equal(t, []string{filepath.Join(destDir, "a.webp")}, proc.Burst.Replaced())
+
+	// Processing the blurry one again is skipped with a reason
+	err = proc.ProcessFile(filepath.Join(tmpDir, "a.jpg"), destDir)
+	var skip *SkipError
+	require.True(t, errors.As(err, &skip))
+	assert.Equal(t, "burst", skip.Reason)
+}
+
+func TestProcessor_ProcessFile_QualityGates(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "frameo-gates-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Nearly black pocket shot
+	dark := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for i := range dark.Pix {
+		dark.Pix[i] = 4
+		if i%4 == 3 {
+			dark.Pix[i] = 255
+		}
+	}
+	srcPath := filepath.Join(tmpDir, "pocket.jpg")
+	f, err := os.Create(srcPath)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, dark, nil))
+	f.Close()
+
+	proc := NewProcessor(200, 150, 80, "webp", false)
+	proc.Gates.MinBrightness = 0.1
+
+	destDir := filepath.Join(tmpDir, "dest")
+	err = proc.ProcessFile(srcPath, destDir)
+	var skip *SkipError
+	require.True(t, errors.As(err, &skip))
+	assert.Equal(t, "dark", skip.Reason)
+	assert.NoFileExists(t, filepath.Join(destDir, "pocket.webp"))
+
+	// Analyze reports the same measurements
+	scores, err := proc.Analyze(srcPath)
+	require.NoError(t, err)
+	assert.Equal(t, 400, scores.Width)
+	assert.Less(t, scores.Exposure.Mean, 0.1)
+}
@@ -0,0 +1,190 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tgagor/frameo-miniatures/internal/quality"
+)
+
+func TestProcessor_Resize_LinearLight(t *testing.T) {
+	// Fine black and white detail, like foliage against the sky
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(255 * ((x + y) % 2))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	proc := NewProcessor(32, 32, 100, "jpg", false)
+	proc.Filter = "box"
+	gamma := imaging.Clone(proc.fitToFrame(img)).NRGBAAt(16, 16)
+	assert.InDelta(t, 128, int(gamma.R), 2, "averaging encoded values darkens")
+
+	proc.LinearLight = true
+	out := proc.fitToFrame(img)
+	assert.Equal(t, image.Rect(0, 0, 32, 32), out.Bounds())
+	linear := imaging.Clone(out).NRGBAAt(16, 16)
+	assert.InDelta(t, 188, int(linear.R), 2, "half the light is sRGB 188")
+	assert.Equal(t, uint8(255), linear.A)
+}
+
+func TestProcessor_Resize_Filters(t *testing.T) {
+	img := imaging.New(300, 200, color.NRGBA{200, 100, 50, 255})
+	for _, filter := range Filters {
+		for _, linear := range []bool{false, true} {
+			proc := NewProcessor(150, 150, 100, "jpg", false)
+			proc.Filter = filter
+			proc.LinearLight = linear
+			out := imaging.Clone(proc.fitToFrame(img))
+			assert.Equal(t, image.Rect(0, 0, 150, 100), out.Bounds(), "%s linear=%v", filter, linear)
+			c := out.NRGBAAt(75, 50)
+			assert.InDelta(t, 200, int(c.R), 1, "%s linear=%v", filter, linear)
+			assert.InDelta(t, 100, int(c.G), 1, "%s linear=%v", filter, linear)
+			assert.InDelta(t, 50, int(c.B), 1, "%s linear=%v", filter, linear)
+		}
+	}
+	assert.Error(t, ValidateFilter("bicubic"))
+	assert.NoError(t, ValidateFilter("lanczos"))
+}
+
+func TestProcessor_ShrinkFactor(t *testing.T) {
+	proc := NewProcessor(1280, 800, 100, "jpg", false)
+	assert.Equal(t, 1, proc.shrinkFactor(4032, 3024))
+	assert.Equal(t, 2, proc.shrinkFactor(8064, 6048), "48 MP")
+	assert.Equal(t, 2, proc.shrinkFactor(6048, 8064), "portrait")
+	assert.Equal(t, 8, proc.shrinkFactor(50000, 40000))
+	assert.Equal(t, 1, NewProcessor(0, 0, 100, "jpg", false).shrinkFactor(8064, 6048))
+}
+
+func TestShrinkYCbCr(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, imaging.New(403, 301, color.NRGBA{30, 160, 220, 255}), &jpeg.Options{Quality: 100}))
+	src, err := jpeg.Decode(&buf)
+	require.NoError(t, err)
+
+	out := shrinkYCbCr(src.(*image.YCbCr), 4)
+	assert.Equal(t, image.Rect(0, 0, 100, 75), out.Bounds())
+	c := color.NRGBAModel.Convert(out.At(99, 74)).(color.NRGBA)
+	assert.InDelta(t, 30, int(c.R), 4, "%v", c)
+	assert.InDelta(t, 160, int(c.G), 4, "%v", c)
+	assert.InDelta(t, 220, int(c.B), 4, "%v", c)
+}
+
+// withMPFPreview appends a preview to a JPEG and indexes it in an MPF segment
+func withMPFPreview(t *testing.T, main, preview []byte) []byte {
+	t.Helper()
+
+	// Index IFD with a single MP entry tag holding two entries
+	order := binary.BigEndian
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, 0xB002)
+	tiff = order.AppendUint16(tiff, 7) // UNDEFINED
+	tiff = order.AppendUint32(tiff, 32)
+	tiff = order.AppendUint32(tiff, 8+2+12+4) // Entries follow the IFD
+	tiff = order.AppendUint32(tiff, 0)        // Next IFD
+	entries := len(tiff)
+	tiff = append(tiff, make([]byte, 32)...)
+
+	segment := append([]byte("MPF\x00"), tiff...)
+	header := []byte{0xFF, 0xE2, 0, 0}
+	order.PutUint16(header[2:], uint16(len(segment)+2))
+
+	out := append([]byte{}, main[:2]...)
+	tiffStart := len(out) + len(header) + 4
+	out = append(append(out, header...), segment...)
+	out = append(out, main[2:]...)
+
+	order.PutUint32(out[tiffStart+entries+4:], uint32(len(main)+len(header)+len(segment)))
+	order.PutUint32(out[tiffStart+entries+16+4:], uint32(len(preview)))
+	order.PutUint32(out[tiffStart+entries+16+8:], uint32(len(out)-tiffStart))
+	return append(out, preview...)
+}
+
+func TestProcessor_FastDecode_Preview(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "camera.jpg")
+
+	encode := func(w, h int, c color.NRGBA) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, imaging.New(w, h, c), &jpeg.Options{Quality: 95}))
+		return buf.Bytes()
+	}
+	// The preview is told apart by its colour
+	data := withMPFPreview(t, encode(1200, 900, color.NRGBA{255, 0, 0, 255}), encode(400, 300, color.NRGBA{0, 0, 255, 255}))
+	require.NoError(t, os.WriteFile(srcPath, data, 0644))
+	_, err := jpeg.Decode(bytes.NewReader(data))
+	require.NoError(t, err, "source must stay a valid JPEG")
+
+	output := func(fast bool, w, h int) (color.NRGBA, image.Rectangle) {
+		destDir := t.TempDir()
+		proc := NewProcessor(w, h, 95, "jpg", false)
+		proc.FastDecode = fast
+		// The resolution gate must see the full size
+		proc.Gates = quality.Gates{MinLong: 1200, MinShort: 900}
+		require.NoError(t, proc.ProcessFile(srcPath, destDir))
+		img, err := imaging.Open(filepath.Join(destDir, "camera.jpg"))
+		require.NoError(t, err)
+		return color.NRGBAModel.Convert(img.At(10, 10)).(color.NRGBA), img.Bounds()
+	}
+
+	c, bounds := output(true, 320, 240)
+	assert.Greater(t, c.B, uint8(200), "preview covering the frame is used")
+	assert.Equal(t, image.Rect(0, 0, 320, 240), bounds)
+
+	c, _ = output(true, 800, 600)
+	assert.Greater(t, c.R, uint8(200), "preview smaller than the frame is not used")
+
+	c, _ = output(false, 320, 240)
+	assert.Greater(t, c.R, uint8(200), "previews are only used in fast mode")
+}
+
+func TestReadMPF_BrokenSegments(t *testing.T) {
+	soi := []byte{0xFF, 0xD8}
+	for name, data := range map[string][]byte{
+		"zero length": append(soi, 0xFF, 0xE5, 0x00, 0x00, 0xFF, 0xDA),
+		"one byte":    append(soi, 0xFF, 0xE5, 0x00, 0x01),
+		"truncated":   append(soi, 0xFF, 0xE2, 0x00, 0x40, 'M', 'P', 'F', 0x00),
+	} {
+		assert.NotPanics(t, func() {
+			assert.Nil(t, readMPF(bytes.NewReader(data)), name)
+		}, name)
+	}
+}
+
+func TestProcessor_FastDecode_Shrink(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "large.jpg")
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, imaging.New(1600, 1200, color.NRGBA{90, 120, 60, 255}), nil))
+	require.NoError(t, os.WriteFile(srcPath, buf.Bytes(), 0644))
+
+	f, err := os.Open(srcPath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	proc := NewProcessor(200, 150, 95, "jpg", false)
+	proc.FastDecode = true
+	img, shrunk, err := proc.decodeFast(f, srcPath)
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, shrunk)
+	assert.Equal(t, image.Rect(0, 0, 400, 300), img.Bounds())
+
+	destDir := filepath.Join(tmpDir, "out")
+	proc.Gates = quality.Gates{MinLong: 1600}
+	require.NoError(t, proc.ProcessFile(srcPath, destDir))
+	out, err := imaging.Open(filepath.Join(destDir, "large.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 200, 150), out.Bounds())
+}
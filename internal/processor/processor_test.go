@@ -5,11 +5,14 @@ import (
 	"image/jpeg"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tgagor/frameo-miniatures/internal/manifest"
 	"golang.org/x/image/webp"
 )
 
@@ -178,3 +181,115 @@ func TestProcessor_ProcessFile_PortraitOptimization(t *testing.T) {
 	assert.LessOrEqual(t, config.Height, 1280)
 	assert.LessOrEqual(t, config.Width, 800)
 }
+
+func TestProcessor_ProcessFile_SkipExistingSidecarChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "photo.jpg")
+	destDir := filepath.Join(tmpDir, "dest")
+	destPath := filepath.Join(destDir, "photo.webp")
+
+	f, err := os.Create(srcPath)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, 64, 48)), nil))
+	f.Close()
+
+	m, err := manifest.Load(destDir)
+	require.NoError(t, err)
+	proc := NewProcessor(32, 32, 80, "webp", true)
+	proc.Manifest = m
+
+	require.NoError(t, proc.ProcessFile(srcPath, destDir))
+
+	// An unchanged source keeps the existing output
+	require.NoError(t, os.WriteFile(destPath, []byte("stale"), 0644))
+	require.NoError(t, proc.ProcessFile(srcPath, destDir))
+	data, err := os.ReadFile(destPath)
+	require.NoError(t, err)
+	assert.Equal(t, "stale", string(data))
+
+	// Rating the photo in a photo manager writes a sidecar, which counts as a change
+	require.NoError(t, os.WriteFile(srcPath+".xmp", []byte("<x:xmpmeta/>"), 0644))
+	require.NoError(t, proc.ProcessFile(srcPath, destDir))
+	data, err = os.ReadFile(destPath)
+	require.NoError(t, err)
+	assert.NotEqual(t, "stale", string(data))
+}
+
+func TestProcessor_ProcessFile_SkipExistingParamsChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "photo.jpg")
+	destDir := filepath.Join(tmpDir, "dest")
+	destPath := filepath.Join(destDir, "photo.webp")
+
+	f, err := os.Create(srcPath)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, 64, 48)), nil))
+	f.Close()
+
+	m, err := manifest.Load(destDir)
+	require.NoError(t, err)
+	proc := NewProcessor(32, 32, 80, "webp", true)
+	proc.Manifest = m
+
+	require.NoError(t, proc.ProcessFile(srcPath, destDir))
+	recorded, ok := m.Get(destPath)
+	require.True(t, ok)
+	assert.Equal(t, proc.Params(), recorded.Params)
+
+	// The same settings keep the existing output
+	require.NoError(t, os.WriteFile(destPath, []byte("stale"), 0644))
+	require.NoError(t, proc.ProcessFile(srcPath, destDir))
+	data, err := os.ReadFile(destPath)
+	require.NoError(t, err)
+	assert.Equal(t, "stale", string(data))
+
+	// A new quality rebuilds it
+	proc.Quality = 60
+	require.NoError(t, proc.ProcessFile(srcPath, destDir))
+	data, err = os.ReadFile(destPath)
+	require.NoError(t, err)
+	assert.NotEqual(t, "stale", string(data))
+	recorded, _ = m.Get(destPath)
+	assert.Equal(t, proc.Params(), recorded.Params)
+}
+
+func TestProcessor_Params(t *testing.T) {
+	proc := NewProcessor(1280, 800, 75, "webp", false)
+	params := proc.Params()
+	assert.Equal(t, params, NewProcessor(1280, 800, 75, "webp", false).Params())
+
+	for name, change := range map[string]func(p *Processor){
+		"resolution": func(p *Processor) { p.Width = 1024 },
+		"quality":    func(p *Processor) { p.Quality = 90 },
+		"format":     func(p *Processor) { p.Format = "jpg" },
+		"crop":       func(p *Processor) { p.Crop = "center" },
+		"lossless":   func(p *Processor) { p.Encoder.Lossless = true },
+	} {
+		other := NewProcessor(1280, 800, 75, "webp", false)
+		change(other)
+		assert.NotEqual(t, params, other.Params(), name)
+	}
+}
+
+func TestProcessor_StepTimed(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "photo.jpg")
+
+	f, err := os.Create(srcPath)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, 64, 48)), nil))
+	f.Close()
+
+	var mu sync.Mutex
+	var steps []string
+	proc := NewProcessor(32, 32, 80, "webp", false)
+	proc.StepTimed = func(step string, d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		steps = append(steps, step)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+	}
+
+	require.NoError(t, proc.ProcessFile(srcPath, filepath.Join(tmpDir, "dest")))
+	assert.Equal(t, []string{StepDecode, StepExif, StepResize, StepEncode, StepExif, StepWrite}, steps)
+}
@@ -0,0 +1,190 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/draw"
+)
+
+// Filters lists the supported resampling filters
+var Filters = []string{"lanczos", "catmullrom", "box", "linear", "nearest"}
+
+// ValidateFilter checks a resampling filter name
+func ValidateFilter(name string) error {
+	for _, f := range Filters {
+		if name == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid resampling filter: %s (expected lanczos, catmullrom, box, linear or nearest)", name)
+}
+
+func imagingFilter(name string) imaging.ResampleFilter {
+	switch name {
+	case "lanczos":
+		return imaging.Lanczos
+	case "box":
+		return imaging.Box
+	case "linear":
+		return imaging.Linear
+	case "nearest":
+		return imaging.NearestNeighbor
+	}
+	return imaging.CatmullRom
+}
+
+// lanczos3 and box match the imaging filters of the same name
+var (
+	lanczos3 = &draw.Kernel{Support: 3, At: func(t float64) float64 {
+		if t == 0 {
+			return 1
+		}
+		if t <= -3 || t >= 3 {
+			return 0
+		}
+		return 3 * math.Sin(math.Pi*t) * math.Sin(math.Pi*t/3) / (math.Pi * math.Pi * t * t)
+	}}
+	box = &draw.Kernel{Support: 0.5, At: func(t float64) float64 {
+		if t >= -0.5 && t < 0.5 {
+			return 1
+		}
+		return 0
+	}}
+)
+
+func drawScaler(name string) draw.Scaler {
+	switch name {
+	case "lanczos":
+		return lanczos3
+	case "box":
+		return box
+	case "linear":
+		return draw.BiLinear
+	case "nearest":
+		return draw.NearestNeighbor
+	}
+	return draw.CatmullRom
+}
+
+// resize scales the image to exactly width x height with the configured
+// filter, in linear light if enabled
+func (p *Processor) resize(img image.Image, width, height int) image.Image {
+	if !p.LinearLight {
+		return imaging.Resize(img, width, height, imagingFilter(p.Filter))
+	}
+	src := toLinear(img)
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	drawScaler(p.Filter).Scale(dst, dst.Rect, src, src.Rect, draw.Src, nil)
+	return fromLinear(dst)
+}
+
+// fit scales the image down to fit within width x height, keeping its
+// aspect ratio. Smaller images are returned as they are.
+func (p *Processor) fit(img image.Image, width, height int) image.Image {
+	if width <= 0 || height <= 0 {
+		return &image.NRGBA{}
+	}
+	b := img.Bounds()
+	if b.Dx() <= width && b.Dy() <= height {
+		return imaging.Clone(img)
+	}
+	// Same rounding as imaging.Fit
+	ratio := float64(b.Dx()) / float64(b.Dy())
+	if ratio > float64(width)/float64(height) {
+		height = max(int(float64(width)/ratio), 1)
+	} else {
+		width = max(int(float64(height)*ratio), 1)
+	}
+	return p.resize(img, width, height)
+}
+
+// linearLUT converts 16-bit sRGB values to linear light
+var linearLUT = func() []uint16 {
+	lut := make([]uint16, 1<<16)
+	for i := range lut {
+		v := float64(i) / 0xffff
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		lut[i] = uint16(math.Round(v * 0xffff))
+	}
+	return lut
+}()
+
+// srgbLUT converts linear light back, in 4x finer steps for the shadows
+var srgbLUT = func() []uint16 {
+	lut := make([]uint16, 1<<18)
+	for i := range lut {
+		v := float64(i) / float64(len(lut)-1)
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		lut[i] = uint16(math.Round(v * 0xffff))
+	}
+	return lut
+}()
+
+// toLinear returns the image in linear light with premultiplied alpha, at
+// 16 bits so the shadows keep their detail
+func toLinear(img image.Image) *image.RGBA64 {
+	b := img.Bounds()
+	dst := image.NewRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	var nrgba64 *image.NRGBA64
+	var nrgba *image.NRGBA
+	if src, ok := img.(*image.NRGBA64); ok {
+		nrgba64 = src
+	} else {
+		nrgba = imaging.Clone(img)
+	}
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			var r, g, bl, a uint32
+			if nrgba64 != nil {
+				c := nrgba64.NRGBA64At(b.Min.X+x, b.Min.Y+y)
+				r, g, bl, a = uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+			} else {
+				i := nrgba.PixOffset(x, y)
+				r, g, bl, a = uint32(nrgba.Pix[i])*0x101, uint32(nrgba.Pix[i+1])*0x101, uint32(nrgba.Pix[i+2])*0x101, uint32(nrgba.Pix[i+3])*0x101
+			}
+			i := dst.PixOffset(x, y)
+			for c, v := range [4]uint32{
+				uint32(linearLUT[r]) * a / 0xffff,
+				uint32(linearLUT[g]) * a / 0xffff,
+				uint32(linearLUT[bl]) * a / 0xffff,
+				a,
+			} {
+				dst.Pix[i+2*c] = uint8(v >> 8)
+				dst.Pix[i+2*c+1] = uint8(v)
+			}
+		}
+	}
+	return dst
+}
+
+// fromLinear converts premultiplied linear light back to sRGB
+func fromLinear(img *image.RGBA64) *image.NRGBA64 {
+	dst := image.NewNRGBA64(img.Rect)
+	scale := uint64(len(srgbLUT) - 1)
+	for i := 0; i+7 < len(img.Pix); i += 8 {
+		a := uint64(img.Pix[i+6])<<8 | uint64(img.Pix[i+7])
+		for c := 0; c < 3; c++ {
+			var v uint16
+			if a > 0 {
+				lin := uint64(img.Pix[i+2*c])<<8 | uint64(img.Pix[i+2*c+1])
+				v = srgbLUT[min(lin*scale/a, scale)]
+			}
+			dst.Pix[i+2*c] = uint8(v >> 8)
+			dst.Pix[i+2*c+1] = uint8(v)
+		}
+		dst.Pix[i+6], dst.Pix[i+7] = img.Pix[i+6], img.Pix[i+7]
+	}
+	return dst
+}
@@ -0,0 +1,242 @@
+package progress
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+// Outcome is what happened to a single file
+type Outcome int
+
+const (
+	Processed Outcome = iota
+	Skipped
+	Failed
+)
+
+// Tracker counts the work of a run. The total grows while files are still
+// being counted and is final once Counted is called. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu         sync.Mutex
+	start      time.Time
+	total      int
+	totalBytes int64
+	counted    bool
+	processed  int
+	skipped    int
+	failed     int
+	doneBytes  int64
+}
+
+// Snapshot is the state of a tracker at one point in time
+type Snapshot struct {
+	Total      int
+	TotalBytes int64
+	Counted    bool // Total is final
+
+	Processed int
+	Skipped   int
+	Failed    int
+	DoneBytes int64
+	Elapsed   time.Duration
+}
+
+// NewTracker creates a tracker with nothing counted yet
+func NewTracker() *Tracker {
+	return &Tracker{start: time.Now()}
+}
+
+// AddTotal adds files to the total, negative values remove them again
+func (t *Tracker) AddTotal(files int, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total += files
+	t.totalBytes += bytes
+}
+
+// Counted marks the total as final
+func (t *Tracker) Counted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counted = true
+}
+
+// Done records a finished file of the given size
+func (t *Tracker) Done(outcome Outcome, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch outcome {
+	case Processed:
+		t.processed++
+	case Skipped:
+		t.skipped++
+	default:
+		t.failed++
+	}
+	t.doneBytes += bytes
+}
+
+// Snapshot returns the current state
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Snapshot{
+		Total:      t.total,
+		TotalBytes: t.totalBytes,
+		Counted:    t.counted,
+		Processed:  t.processed,
+		Skipped:    t.skipped,
+		Failed:     t.failed,
+		DoneBytes:  t.doneBytes,
+		Elapsed:    time.Since(t.start),
+	}
+}
+
+// Done returns the number of finished files
+func (s Snapshot) Done() int {
+	return s.Processed + s.Skipped + s.Failed
+}
+
+// Fraction returns the finished share of the source data, 0 while the
+// total is unknown
+func (s Snapshot) Fraction() float64 {
+	if s.TotalBytes <= 0 {
+		return 0
+	}
+	return min(float64(s.DoneBytes)/float64(s.TotalBytes), 1)
+}
+
+// ETA estimates the time remaining from the bytes of source data finished
+// so far. Photos take time roughly in proportion to their size, which
+// makes bytes a better measure than file counts for mixed libraries.
+func (s Snapshot) ETA() (time.Duration, bool) {
+	if !s.Counted || s.DoneBytes <= 0 || s.TotalBytes <= 0 {
+		return 0, false
+	}
+	remaining := max(s.TotalBytes-s.DoneBytes, 0)
+	eta := time.Duration(float64(s.Elapsed) * float64(remaining) / float64(s.DoneBytes))
+	return eta.Round(time.Second), true
+}
+
+// Display shows the progress of a tracker: as a bar on a terminal or as
+// periodic log lines otherwise, e.g. under cron or systemd
+type Display struct {
+	tracker *Tracker
+	bar     *progressbar.ProgressBar
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// Start shows the tracker's progress on stderr. Log lines are written
+// every interval when stderr isn't a terminal.
+func Start(tracker *Tracker, interval time.Duration) *Display {
+	d := &Display{tracker: tracker, stop: make(chan struct{})}
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		d.bar = progressbar.NewOptions64(-1,
+			progressbar.OptionSetDescription("Processing"),
+			progressbar.OptionSetWriter(os.Stderr),
+			progressbar.OptionShowBytes(true),
+			progressbar.OptionSetWidth(10),
+			progressbar.OptionThrottle(65*time.Millisecond),
+			progressbar.OptionShowCount(),
+			progressbar.OptionOnCompletion(func() {
+				fmt.Fprint(os.Stderr, "\n")
+			}),
+			progressbar.OptionSpinnerType(14),
+			progressbar.OptionFullWidth(),
+		)
+		return d
+	}
+
+	d.stopped.Add(1)
+	go func() {
+		defer d.stopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				logSnapshot(tracker.Snapshot())
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return d
+}
+
+// Hidden returns a display that shows nothing, for quiet runs
+func Hidden(tracker *Tracker) *Display {
+	return &Display{tracker: tracker, stop: make(chan struct{})}
+}
+
+// Refresh redraws the bar after the tracker changed
+func (d *Display) Refresh() {
+	if d.bar == nil {
+		return
+	}
+	s := d.tracker.Snapshot()
+	d.bar.Describe(describe(s))
+
+	// The bar stops counting once it reaches its maximum, which must stay
+	// ahead of the finished bytes until the total is final
+	limit := s.TotalBytes
+	if !s.Counted {
+		limit = max(limit, s.DoneBytes) + 1
+	}
+	limit = max(limit, 1)
+	if limit != d.bar.GetMax64() {
+		d.bar.ChangeMax64(limit)
+	}
+	d.bar.Set64(min(s.DoneBytes, limit))
+}
+
+// Finish completes the bar or stops the log lines
+func (d *Display) Finish() {
+	if d.bar != nil {
+		if !d.bar.IsFinished() {
+			d.bar.Describe(describe(d.tracker.Snapshot()))
+			d.bar.Finish()
+		}
+		return
+	}
+	close(d.stop)
+	d.stopped.Wait()
+}
+
+func describe(s Snapshot) string {
+	total := "?"
+	if s.Counted {
+		total = fmt.Sprint(s.Total)
+	} else if s.Total > 0 {
+		total = fmt.Sprintf("%d+", s.Total)
+	}
+	desc := fmt.Sprintf("Processing %d/%s", s.Done(), total)
+	if s.Skipped > 0 || s.Failed > 0 {
+		desc += fmt.Sprintf(" (%d skipped, %d failed)", s.Skipped, s.Failed)
+	}
+	return desc
+}
+
+func logSnapshot(s Snapshot) {
+	event := log.Info().
+		Int("done", s.Done()).
+		Int("processed", s.Processed).
+		Int("skipped", s.Skipped).
+		Int("failed", s.Failed).
+		Str("elapsed", s.Elapsed.Round(time.Second).String())
+	if s.Counted {
+		event = event.Int("total", s.Total).Str("percent", fmt.Sprintf("%.1f", s.Fraction()*100))
+	}
+	if eta, ok := s.ETA(); ok {
+		event = event.Str("eta", eta.String())
+	}
+	event.Msg("Progress")
+}
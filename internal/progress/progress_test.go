@@ -0,0 +1,56 @@
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker()
+	tr.AddTotal(3, 300)
+	tr.AddTotal(1, 100)
+	tr.AddTotal(-1, -100) // Filtered out later
+	tr.Done(Processed, 100)
+	tr.Done(Skipped, 50)
+	tr.Done(Failed, 10)
+
+	s := tr.Snapshot()
+	assert.Equal(t, 3, s.Total)
+	assert.Equal(t, int64(300), s.TotalBytes)
+	assert.False(t, s.Counted)
+	assert.Equal(t, 1, s.Processed)
+	assert.Equal(t, 1, s.Skipped)
+	assert.Equal(t, 1, s.Failed)
+	assert.Equal(t, 3, s.Done())
+	assert.Equal(t, int64(160), s.DoneBytes)
+
+	tr.Counted()
+	assert.True(t, tr.Snapshot().Counted)
+}
+
+func TestSnapshot_ETA(t *testing.T) {
+	s := Snapshot{TotalBytes: 1000, DoneBytes: 250, Elapsed: 10 * time.Second}
+
+	// No estimate while the total is still growing
+	_, ok := s.ETA()
+	assert.False(t, ok)
+
+	s.Counted = true
+	eta, ok := s.ETA()
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, eta)
+	assert.InDelta(t, 0.25, s.Fraction(), 1e-9)
+
+	s.DoneBytes = 0
+	_, ok = s.ETA()
+	assert.False(t, ok)
+}
+
+func TestDescribe(t *testing.T) {
+	assert.Equal(t, "Processing 0/?", describe(Snapshot{}))
+	assert.Equal(t, "Processing 2/40+", describe(Snapshot{Total: 40, Processed: 2}))
+	assert.Equal(t, "Processing 5/50 (2 skipped, 1 failed)",
+		describe(Snapshot{Total: 50, Counted: true, Processed: 2, Skipped: 2, Failed: 1}))
+}
@@ -0,0 +1,70 @@
+package pruner
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+	"github.com/tgagor/frameo-miniatures/internal/fileutil"
+)
+
+// Expected is the set of outputs the input produces, collected during the
+// processing walk so pruning doesn't have to walk the input again. It is
+// safe for concurrent use.
+type Expected struct {
+	format string
+
+	mu      sync.Mutex
+	sources map[string][]string // Output relative path -> source paths
+	params  map[string]string   // Output relative path -> settings
+}
+
+// NewExpected creates an empty set for outputs in the given format
+func NewExpected(format string) *Expected {
+	return &Expected{format: format, sources: make(map[string][]string), params: make(map[string]string)}
+}
+
+// Add records the output of a source file. params are the settings the
+// output should have been written with, see processor.Params, empty when
+// unknown.
+func (e *Expected) Add(file discovery.File, params string) {
+	relPath := outputPath(file.RelativePath, e.format)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sources[relPath] = append(e.sources[relPath], file.Path)
+	if params != "" {
+		e.params[relPath] = params
+	}
+}
+
+// Params returns the settings an output should have, empty when unknown
+func (e *Expected) Params(relPath string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.params[relPath]
+}
+
+// Keeps reports whether an output, relative to the output directory, has
+// a source that isn't excluded
+func (e *Expected) Keeps(relPath string, exclude map[string]bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, source := range e.sources[relPath] {
+		if !exclude[source] {
+			return true
+		}
+	}
+	return false
+}
+
+// outputPath converts input relative path to expected output relative path
+func outputPath(inputRelPath, format string) string {
+	// Get the directory and filename
+	dir := filepath.Dir(inputRelPath)
+	filename := filepath.Base(inputRelPath)
+
+	// Use shared utility to get normalized output filename
+	outputFilename := fileutil.GetOutputFilename(filename, format)
+	return filepath.Join(dir, outputFilename)
+}
@@ -1,14 +1,23 @@
 package pruner
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/rs/zerolog/log"
 	"github.com/tgagor/frameo-miniatures/internal/discovery"
-	"github.com/tgagor/frameo-miniatures/internal/fileutil"
+	"github.com/tgagor/frameo-miniatures/internal/manifest"
+	"github.com/tgagor/frameo-miniatures/internal/trash"
 )
 
+// ProtectFile lists output files the pruner must not touch, in the output
+// directory and in .frameoignore syntax
+const ProtectFile = ".frameoprotect"
+
 // Pruner handles cleanup of output directory
 type Pruner struct {
 	InputDir  string
@@ -16,6 +25,28 @@ type Pruner struct {
 	Format    string
 	Matcher   *discovery.IgnoreMatcher
 	DryRun    bool
+	Exclude   map[string]bool // Source paths deliberately left out of the output (e.g. duplicates)
+	Filters   []discovery.Filter
+	Trash     *trash.Trash // Optional, pruned files are moved there instead of deleted
+
+	// Manifest records the outputs written by the processor. When set, only
+	// those are pruned and anything else in the output is left alone.
+	Manifest *manifest.Manifest
+	// Protect matches output files that are never pruned, see ProtectFile
+	Protect *discovery.IgnoreMatcher
+
+	// MaxPercent aborts pruning when more than this share of the output
+	// would go, which usually means a wrong input or an unmounted share.
+	// 0 disables the check, Force overrides it.
+	MaxPercent float64
+	Force      bool
+
+	// Expected holds the outputs collected by the processing pass. Without
+	// it, Prune walks the input itself.
+	Expected *Expected
+	// Workers walks the input and removes orphans in this many top-level
+	// directories at once
+	Workers int
 }
 
 // NewPruner creates a new pruner
@@ -31,94 +62,224 @@ func NewPruner(inputDir, outputDir, format string, matcher *discovery.IgnoreMatc
 
 // Prune removes files from output that don't exist in input or match ignore patterns
 func (p *Pruner) Prune() (int, error) {
-	// Build a set of expected output files based on input
-	expectedFiles := make(map[string]bool)
+	expected := p.Expected
+	if expected == nil {
+		expected = p.walkInput()
+	}
 
-	// Walk input directory to find all valid source files
-	files := make(chan discovery.File, 1000)
-	go discovery.WalkFiles(p.InputDir, files, p.Matcher)
+	// Only files the pruner may touch are candidates
+	candidates, err := p.candidates()
+	if err != nil {
+		return 0, err
+	}
+	var orphans []string
+	for _, relPath := range candidates {
+		if !expected.Keeps(relPath, p.Exclude) || p.outdated(relPath, expected.Params(relPath)) {
+			orphans = append(orphans, relPath)
+		}
+	}
 
+	total := len(candidates)
+	if percent := 100 * float64(len(orphans)) / float64(max(total, 1)); p.MaxPercent > 0 && percent > p.MaxPercent && !p.Force {
+		return 0, fmt.Errorf("pruning would remove %d of %d output files (%.0f%%), more than %.0f%%: check the input directory and ignore rules, or force it", len(orphans), total, percent, p.MaxPercent)
+	}
+
+	// Top-level directories are disjoint, so each is pruned on its own
+	var removedCount atomic.Int64
+	subtrees := make(chan []string)
+	var wg sync.WaitGroup
+	for i := 0; i < max(p.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for orphans := range subtrees {
+				removedCount.Add(int64(p.removeAll(orphans)))
+			}
+		}()
+	}
+	for _, group := range bySubtree(orphans) {
+		subtrees <- group
+	}
+	close(subtrees)
+	wg.Wait()
+
+	return int(removedCount.Load()), nil
+}
+
+// Remove removes outputs, relative to the output directory, the way
+// orphans are pruned. Protected outputs, outputs the manifest doesn't
+// record and outputs another expected source still produces are kept.
+// It returns how many were removed.
+func (p *Pruner) Remove(relPaths []string) int {
+	var outputs []string
+	for _, relPath := range relPaths {
+		if p.protected(relPath) {
+			continue
+		}
+		if p.Manifest != nil {
+			if _, ok := p.Manifest.Get(filepath.Join(p.OutputDir, relPath)); !ok {
+				continue
+			}
+		}
+		if p.Expected != nil && p.Expected.Keeps(relPath, p.Exclude) {
+			continue
+		}
+		outputs = append(outputs, relPath)
+	}
+	return p.removeAll(outputs)
+}
+
+// walkInput collects the outputs of every valid source file
+func (p *Pruner) walkInput() *Expected {
+	expected := NewExpected(p.Format)
+	files := make(chan discovery.File, 1000)
+	if p.Workers > 1 {
+		go discovery.WalkSubtrees(p.InputDir, files, p.Matcher, p.Workers, p.Filters...)
+	} else {
+		go discovery.WalkFiles(p.InputDir, files, p.Matcher, p.Filters...)
+	}
 	for file := range files {
-		// Determine what the output filename would be
-		outputRelPath := p.getOutputPath(file.RelativePath)
-		expectedFiles[outputRelPath] = true
+		expected.Add(file, "")
 	}
+	return expected
+}
 
-	// Walk output directory and remove files not in expected set
+// removeAll removes orphaned files and returns how many went
+func (p *Pruner) removeAll(orphans []string) int {
 	removedCount := 0
+	for _, relPath := range orphans {
+		if p.DryRun {
+			log.Info().Str("file", relPath).Msg("[DRY RUN] Would prune orphaned file")
+			removedCount++
+			continue
+		}
+
+		log.Info().Str("file", relPath).Msg("Pruning orphaned file")
+		if err := p.remove(relPath); err != nil {
+			log.Warn().Err(err).Str("file", relPath).Msg("Failed to remove file")
+			continue
+		}
+		removedCount++
+		if p.Manifest != nil {
+			p.Manifest.Delete(filepath.Join(p.OutputDir, relPath))
+		}
+		p.removeEmptyParents(relPath)
+	}
+	return removedCount
+}
+
+// bySubtree groups files by their top-level directory, keeping files at
+// the top level together
+func bySubtree(relPaths []string) [][]string {
+	var groups [][]string
+	index := make(map[string]int)
+	for _, relPath := range relPaths {
+		top := "."
+		if dir, _, found := strings.Cut(filepath.ToSlash(relPath), "/"); found {
+			top = dir
+		}
+		i, ok := index[top]
+		if !ok {
+			i = len(groups)
+			index[top] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], relPath)
+	}
+	return groups
+}
+
+// candidates lists the output files the pruner may remove, relative to the
+// output directory: those recorded in the manifest when there is one,
+// otherwise every file. The trash, the manifest and protected files are
+// never candidates.
+func (p *Pruner) candidates() ([]string, error) {
+	var files []string
+	add := func(relPath string) {
+		if relPath == manifest.FileName || relPath == ProtectFile || trash.IsTrash(relPath) {
+			return
+		}
+		if p.protected(relPath) {
+			return
+		}
+		files = append(files, relPath)
+	}
+
+	if p.Manifest != nil {
+		for _, relPath := range p.Manifest.Outputs() {
+			info, err := os.Stat(filepath.Join(p.OutputDir, relPath))
+			if err == nil && !info.IsDir() {
+				add(relPath)
+			}
+		}
+		return files, nil
+	}
+
 	err := filepath.Walk(p.OutputDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
-
 		// Get relative path from output dir
 		relPath, err := filepath.Rel(p.OutputDir, path)
 		if err != nil {
 			return err
 		}
 
-		// Check if this file should exist
-		if !expectedFiles[relPath] {
-			if p.DryRun {
-				log.Info().Str("file", relPath).Msg("[DRY RUN] Would prune orphaned file")
-				removedCount++
-			} else {
-				log.Info().Str("file", relPath).Msg("Pruning orphaned file")
-				if err := os.Remove(path); err != nil {
-					log.Warn().Err(err).Str("file", path).Msg("Failed to remove file")
-				} else {
-					removedCount++
-				}
+		// Files already pruned stay in the trash until they expire
+		if info.IsDir() {
+			if trash.IsTrash(relPath) {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 
+		add(relPath)
 		return nil
 	})
+	return files, err
+}
 
-	// Clean up empty directories
-	if err == nil {
-		p.removeEmptyDirs(p.OutputDir)
+// outdated reports whether the manifest records an output as written
+// with other settings than expected. Outdated outputs are pruned even
+// with a source.
+func (p *Pruner) outdated(relPath, params string) bool {
+	if params == "" || p.Manifest == nil {
+		return false
 	}
-
-	return removedCount, err
+	source, ok := p.Manifest.Get(filepath.Join(p.OutputDir, relPath))
+	if !ok || source.Params == "" || source.Params == params {
+		return false
+	}
+	log.Debug().Str("file", relPath).Msg("Output written with other settings")
+	return true
 }
 
-// getOutputPath converts input relative path to expected output relative path
-func (p *Pruner) getOutputPath(inputRelPath string) string {
-	// Get the directory and filename
-	dir := filepath.Dir(inputRelPath)
-	filename := filepath.Base(inputRelPath)
-
-	// Use shared utility to get normalized output filename
-	outputFilename := fileutil.GetOutputFilename(filename, p.Format)
-	return filepath.Join(dir, outputFilename)
+// protected reports whether .frameoprotect keeps an output
+func (p *Pruner) protected(relPath string) bool {
+	if p.Protect != nil && p.Protect.Matches(relPath, false) {
+		log.Debug().Str("file", relPath).Msg("Keeping protected file")
+		return true
+	}
+	return false
 }
 
-// removeEmptyDirs recursively removes empty directories
-func (p *Pruner) removeEmptyDirs(dir string) {
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || !info.IsDir() || path == dir {
-			return err
-		}
+// remove moves a file into the trash, or deletes it without one
+func (p *Pruner) remove(relPath string) error {
+	if p.Trash != nil {
+		return p.Trash.Move(relPath)
+	}
+	return os.Remove(filepath.Join(p.OutputDir, relPath))
+}
 
-		if p.DryRun {
-			// In dry-run mode, just check if directory is empty
-			entries, err := os.ReadDir(path)
-			if err == nil && len(entries) == 0 {
-				log.Debug().Str("dir", path).Msg("[DRY RUN] Would remove empty directory")
-			}
-		} else {
-			// Try to remove directory (will only succeed if empty)
-			if err := os.Remove(path); err == nil {
-				log.Debug().Str("dir", path).Msg("Removed empty directory")
-			}
+// removeEmptyParents removes the directories of a pruned file that are
+// left empty, up to the output directory
+func (p *Pruner) removeEmptyParents(relPath string) {
+	for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+		// Only succeeds when empty
+		if err := os.Remove(filepath.Join(p.OutputDir, dir)); err != nil {
+			return
 		}
-
-		return nil
-	})
+		log.Debug().Str("dir", dir).Msg("Removed empty directory")
+	}
 }
@@ -4,10 +4,13 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tgagor/frameo-miniatures/internal/discovery"
+	"github.com/tgagor/frameo-miniatures/internal/manifest"
+	"github.com/tgagor/frameo-miniatures/internal/trash"
 )
 
 func TestPruner_Prune(t *testing.T) {
@@ -236,3 +239,303 @@ func TestPruner_FormatConversion(t *testing.T) {
 	assert.FileExists(t, outputWebP)
 	assert.NoFileExists(t, outputJPG)
 }
+
+func TestPruner_Exclude(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pruner-exclude-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	inputDir := filepath.Join(tmpDir, "input")
+	outputDir := filepath.Join(tmpDir, "output")
+	require.NoError(t, os.MkdirAll(inputDir, 0755))
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+
+	for _, f := range []string{"photo.jpg", "photo copy.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(inputDir, f), []byte("test"), 0644))
+	}
+	for _, f := range []string{"photo.webp", "photo copy.webp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, f), []byte("test"), 0644))
+	}
+
+	// The copy was rejected as a duplicate, so its output is an orphan
+	pruner := NewPruner(inputDir, outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.Exclude = map[string]bool{filepath.Join(inputDir, "photo copy.jpg"): true}
+
+	removedCount, err := pruner.Prune()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, removedCount)
+	assert.FileExists(t, filepath.Join(outputDir, "photo.webp"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "photo copy.webp"))
+}
+
+type skipFilter string
+
+func (f skipFilter) Match(file *discovery.File) bool {
+	return file.RelativePath != string(f)
+}
+
+func TestPruner_Filters(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pruner-filter-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	inputDir := filepath.Join(tmpDir, "input")
+	outputDir := filepath.Join(tmpDir, "output")
+	require.NoError(t, os.MkdirAll(inputDir, 0755))
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+
+	for _, f := range []string{"2019.jpg", "2023.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(inputDir, f), []byte("test"), 0644))
+	}
+	for _, f := range []string{"2019.webp", "2023.webp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, f), []byte("test"), 0644))
+	}
+
+	// Filtered out sources are treated like ignored ones
+	pruner := NewPruner(inputDir, outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.Filters = []discovery.Filter{skipFilter("2023.jpg")}
+
+	removedCount, err := pruner.Prune()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, removedCount)
+	assert.FileExists(t, filepath.Join(outputDir, "2019.webp"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "2023.webp"))
+}
+
+func TestPruner_Trash(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "input")
+	outputDir := filepath.Join(tmpDir, "output")
+	require.NoError(t, os.MkdirAll(inputDir, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(outputDir, "sub"), 0755))
+
+	require.NoError(t, os.WriteFile(filepath.Join(inputDir, "kept.jpg"), []byte("test"), 0644))
+	for _, f := range []string{"kept.webp", "sub/gone.webp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, f), []byte("test"), 0644))
+	}
+
+	pruner := NewPruner(inputDir, outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.Trash = trash.New(outputDir, time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local))
+
+	removedCount, err := pruner.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removedCount)
+	assert.NoFileExists(t, filepath.Join(outputDir, "sub/gone.webp"))
+	assert.FileExists(t, filepath.Join(outputDir, trash.DirName, "20240501-100000.000", "sub/gone.webp"))
+
+	// The trash is not pruned itself
+	removedCount, err = pruner.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 0, removedCount)
+}
+
+func TestPruner_MaxPercent(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "input")
+	outputDir := filepath.Join(tmpDir, "output")
+	require.NoError(t, os.MkdirAll(inputDir, 0755))
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+
+	// An empty input, e.g. an unmounted share, orphans the whole output
+	for _, f := range []string{"a.webp", "b.webp", "c.webp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, f), []byte("test"), 0644))
+	}
+
+	pruner := NewPruner(inputDir, outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.MaxPercent = 50
+
+	_, err := pruner.Prune()
+	assert.ErrorContains(t, err, "would remove 3 of 3")
+	assert.FileExists(t, filepath.Join(outputDir, "a.webp"))
+
+	pruner.Force = true
+	removedCount, err := pruner.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 3, removedCount)
+}
+
+func TestPruner_Manifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "input")
+	outputDir := filepath.Join(tmpDir, "output")
+	require.NoError(t, os.MkdirAll(inputDir, 0755))
+	for _, d := range []string{"2020", "notes", "empty"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(outputDir, d), 0755))
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(inputDir, "kept.jpg"), []byte("test"), 0644))
+	for _, f := range []string{"kept.webp", "2020/gone.webp", "notes/todo.txt", ".nomedia", "added.webp", "keep.webp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, f), []byte("test"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, ProtectFile), []byte("keep.webp\n"), 0644))
+
+	// Only outputs written by the processor are owned
+	m, err := manifest.Load(outputDir)
+	require.NoError(t, err)
+	for _, f := range []string{"kept.webp", "2020/gone.webp", "keep.webp"} {
+		m.Put(filepath.Join(outputDir, f), manifest.Source{Path: f})
+	}
+	protect, err := discovery.LoadIgnoreFile(filepath.Join(outputDir, ProtectFile))
+	require.NoError(t, err)
+
+	pruner := NewPruner(inputDir, outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.Manifest = m
+	pruner.Protect = protect
+
+	removedCount, err := pruner.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removedCount)
+
+	assert.NoFileExists(t, filepath.Join(outputDir, "2020/gone.webp"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "2020"))
+	assert.Equal(t, []string{"keep.webp", "kept.webp"}, m.Outputs())
+
+	// Files of others, protected files and unrelated directories stay
+	for _, f := range []string{"kept.webp", "notes/todo.txt", ".nomedia", "added.webp", "keep.webp"} {
+		assert.FileExists(t, filepath.Join(outputDir, f))
+	}
+	assert.DirExists(t, filepath.Join(outputDir, "empty"))
+}
+
+func TestPruner_Expected(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "input")
+	outputDir := filepath.Join(tmpDir, "output")
+	for _, f := range []string{"a.webp", "2020/b.webp", "2020/c.webp", "2021/d.webp", "2021/e.webp"} {
+		path := filepath.Join(outputDir, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("test"), 0644))
+	}
+
+	// The processing pass saw these sources, the input isn't walked again
+	expected := NewExpected("webp")
+	expected.Add(discovery.File{Path: "/in/a.jpg", RelativePath: "a.jpg"}, "")
+	expected.Add(discovery.File{Path: "/in/2020/b.jpg", RelativePath: "2020/b.jpg"}, "")
+	expected.Add(discovery.File{Path: "/in/2021/d.jpg", RelativePath: "2021/d.jpg"}, "")
+	expected.Add(discovery.File{Path: "/in/2021/d.png", RelativePath: "2021/d.png"}, "")
+
+	pruner := NewPruner(inputDir, outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.Expected = expected
+	pruner.Workers = 4
+	// An output stays while any of its sources is kept
+	pruner.Exclude = map[string]bool{"/in/2021/d.jpg": true}
+
+	removedCount, err := pruner.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 2, removedCount)
+
+	for _, f := range []string{"a.webp", "2020/b.webp", "2021/d.webp"} {
+		assert.FileExists(t, filepath.Join(outputDir, f))
+	}
+	assert.NoFileExists(t, filepath.Join(outputDir, "2020/c.webp"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "2021/e.webp"))
+}
+
+func TestPruner_Workers(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "input")
+	outputDir := filepath.Join(tmpDir, "output")
+	for _, f := range []string{"2019/a.jpg", "2020/b.jpg", "top.jpg"} {
+		path := filepath.Join(inputDir, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("test"), 0644))
+	}
+	for _, f := range []string{"2019/a.webp", "2019/old.webp", "2020/b.webp", "2022/c.webp", "top.webp"} {
+		path := filepath.Join(outputDir, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("test"), 0644))
+	}
+
+	// Without collected outputs the input is walked, one subtree per worker
+	pruner := NewPruner(inputDir, outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.Workers = 3
+
+	removedCount, err := pruner.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 2, removedCount)
+
+	for _, f := range []string{"2019/a.webp", "2020/b.webp", "top.webp"} {
+		assert.FileExists(t, filepath.Join(outputDir, f))
+	}
+	assert.NoFileExists(t, filepath.Join(outputDir, "2019/old.webp"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "2022"))
+}
+
+func TestPruner_Params(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "input")
+	outputDir := filepath.Join(tmpDir, "output")
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+
+	m, err := manifest.Load(outputDir)
+	require.NoError(t, err)
+	expected := NewExpected("webp")
+	for f, params := range map[string]string{"current": "new", "outdated": "old", "legacy": "", "failed": "old"} {
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, f+".webp"), []byte("test"), 0644))
+		m.Put(filepath.Join(outputDir, f+".webp"), manifest.Source{Path: f, Params: params})
+		// A failed rebuild has no settings to expect
+		want := "new"
+		if f == "failed" {
+			want = ""
+		}
+		expected.Add(discovery.File{Path: filepath.Join(inputDir, f+".jpg"), RelativePath: f + ".jpg"}, want)
+	}
+
+	pruner := NewPruner(inputDir, outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.Manifest = m
+	pruner.Expected = expected
+
+	removedCount, err := pruner.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removedCount)
+
+	// Outputs recorded without settings are kept, and so are the previous
+	// outputs of failed rebuilds
+	assert.FileExists(t, filepath.Join(outputDir, "current.webp"))
+	assert.FileExists(t, filepath.Join(outputDir, "legacy.webp"))
+	assert.FileExists(t, filepath.Join(outputDir, "failed.webp"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "outdated.webp"))
+}
+
+func TestPruner_Remove(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "output")
+	require.NoError(t, os.MkdirAll(filepath.Join(outputDir, "2020"), 0755))
+
+	m, err := manifest.Load(outputDir)
+	require.NoError(t, err)
+	for _, f := range []string{"2020/small.webp", "photo.webp", "keep.webp", "foreign.webp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, f), []byte("test"), 0644))
+		if f != "foreign.webp" {
+			m.Put(filepath.Join(outputDir, f), manifest.Source{Path: f})
+		}
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, ProtectFile), []byte("keep.webp\n"), 0644))
+	protect, err := discovery.LoadIgnoreFile(filepath.Join(outputDir, ProtectFile))
+	require.NoError(t, err)
+
+	// photo.jpg lost, but photo.heic makes the same output
+	expected := NewExpected("webp")
+	expected.Add(discovery.File{Path: "/in/photo.jpg", RelativePath: "photo.jpg"}, "")
+	expected.Add(discovery.File{Path: "/in/photo.heic", RelativePath: "photo.heic"}, "")
+
+	pruner := NewPruner("/in", outputDir, "webp", &discovery.IgnoreMatcher{}, false)
+	pruner.Manifest = m
+	pruner.Protect = protect
+	pruner.Expected = expected
+	pruner.Exclude = map[string]bool{"/in/photo.jpg": true}
+	pruner.Trash = trash.New(outputDir, time.Now())
+
+	removed := pruner.Remove([]string{"2020/small.webp", "photo.webp", "keep.webp", "foreign.webp"})
+	assert.Equal(t, 1, removed)
+
+	// Removed outputs can be restored from the trash and leave the manifest
+	assert.NoFileExists(t, filepath.Join(outputDir, "2020/small.webp"))
+	assert.FileExists(t, filepath.Join(outputDir, trash.DirName, pruner.Trash.Batch, "2020/small.webp"))
+	assert.Equal(t, []string{"keep.webp", "photo.webp"}, m.Outputs())
+	for _, f := range []string{"photo.webp", "keep.webp", "foreign.webp"} {
+		assert.FileExists(t, filepath.Join(outputDir, f))
+	}
+}
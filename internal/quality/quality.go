@@ -0,0 +1,144 @@
+package quality
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Sharpness returns the variance of the Laplacian of the grayscale image.
+// Blurry photos have few edges and score low, crisp photos score high.
+// Scores are only comparable between images of similar size.
+func Sharpness(img image.Image) float64 {
+	gray := imaging.Grayscale(img)
+	w, h := gray.Rect.Dx(), gray.Rect.Dy()
+	if w < 3 || h < 3 {
+		return 0
+	}
+
+	lum := func(x, y int) float64 {
+		return float64(gray.Pix[y*gray.Stride+x*4])
+	}
+
+	var sum, sumSq float64
+	n := float64((w - 2) * (h - 2))
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			v := lum(x-1, y) + lum(x+1, y) + lum(x, y-1) + lum(x, y+1) - 4*lum(x, y)
+			sum += v
+			sumSq += v * v
+		}
+	}
+	mean := sum / n
+	return sumSq/n - mean*mean
+}
+
+// Exposure describes the brightness distribution of an image
+type Exposure struct {
+	Mean       float64 // Mean luminance, 0 (black) to 1 (white)
+	Shadows    float64 // Fraction of nearly black pixels
+	Highlights float64 // Fraction of nearly white pixels
+}
+
+// MeasureExposure builds a luminance histogram of the image
+func MeasureExposure(img image.Image) Exposure {
+	gray := imaging.Grayscale(img)
+	w, h := gray.Rect.Dx(), gray.Rect.Dy()
+	if w == 0 || h == 0 {
+		return Exposure{}
+	}
+
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		row := gray.Pix[y*gray.Stride : y*gray.Stride+w*4]
+		for x := 0; x < len(row); x += 4 {
+			hist[row[x]]++
+		}
+	}
+
+	total := float64(w * h)
+	var sum float64
+	var dark, bright int
+	for v, count := range hist {
+		sum += float64(v * count)
+		if v <= 8 {
+			dark += count
+		}
+		if v >= 247 {
+			bright += count
+		}
+	}
+
+	return Exposure{
+		Mean:       sum / total / 255,
+		Shadows:    float64(dark) / total,
+		Highlights: float64(bright) / total,
+	}
+}
+
+// Score rates the exposure from 0 to 1: well exposed photos have a mid-tone
+// mean and little clipping at either end of the histogram
+func (e Exposure) Score() float64 {
+	score := 1 - math.Abs(e.Mean-0.5)*2 - e.Shadows - e.Highlights
+	return math.Max(score, 0)
+}
+
+// Scores holds all quality measurements of a photo
+type Scores struct {
+	Width     int // Source dimensions
+	Height    int
+	Sharpness float64
+	Exposure  Exposure
+}
+
+// Measure computes the scores of an image. Sharpness should be measured on the
+// image resized to the frame, so scores are comparable across source sizes.
+func Measure(img image.Image, srcWidth, srcHeight int) Scores {
+	return Scores{
+		Width:     srcWidth,
+		Height:    srcHeight,
+		Sharpness: Sharpness(img),
+		Exposure:  MeasureExposure(img),
+	}
+}
+
+// Gates are thresholds a photo has to pass to be processed. Zero values disable a gate.
+type Gates struct {
+	MinSharpness  float64 // Minimum Laplacian variance
+	MinBrightness float64 // Minimum mean luminance (0-1)
+	MaxBrightness float64 // Maximum mean luminance (0-1)
+	MaxClipped    float64 // Maximum fraction of clipped shadows plus highlights (0-1)
+	MinLong       int     // Minimum source size of the long side
+	MinShort      int     // Minimum source size of the short side
+}
+
+// Enabled reports whether any gate is configured
+func (g Gates) Enabled() bool {
+	return g != Gates{}
+}
+
+// Check returns the reason and details of the first failed gate, or an empty reason
+func (g Gates) Check(s Scores) (reason, detail string) {
+	long, short := s.Width, s.Height
+	if short > long {
+		long, short = short, long
+	}
+	if (g.MinLong > 0 && long < g.MinLong) || (g.MinShort > 0 && short < g.MinShort) {
+		return "low-resolution", fmt.Sprintf("%dx%d below %dx%d", s.Width, s.Height, g.MinLong, g.MinShort)
+	}
+	if g.MinSharpness > 0 && s.Sharpness < g.MinSharpness {
+		return "blurry", fmt.Sprintf("sharpness %.1f below %.1f", s.Sharpness, g.MinSharpness)
+	}
+	if g.MinBrightness > 0 && s.Exposure.Mean < g.MinBrightness {
+		return "dark", fmt.Sprintf("brightness %.3f below %.3f", s.Exposure.Mean, g.MinBrightness)
+	}
+	if g.MaxBrightness > 0 && s.Exposure.Mean > g.MaxBrightness {
+		return "bright", fmt.Sprintf("brightness %.3f above %.3f", s.Exposure.Mean, g.MaxBrightness)
+	}
+	if clipped := s.Exposure.Shadows + s.Exposure.Highlights; g.MaxClipped > 0 && clipped > g.MaxClipped {
+		return "clipped", fmt.Sprintf("%.1f%% clipped pixels above %.1f%%", clipped*100, g.MaxClipped*100)
+	}
+	return "", ""
+}
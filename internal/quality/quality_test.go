@@ -0,0 +1,78 @@
+package quality
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func checkerboard(w, h, cell int, dark, light uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := dark
+			if (x/cell+y/cell)%2 == 0 {
+				v = light
+			}
+			img.SetGray(x, y, color.Gray{v})
+		}
+	}
+	return img
+}
+
+func TestSharpness(t *testing.T) {
+	sharp := checkerboard(200, 200, 10, 0, 255)
+	blurry := imaging.Blur(sharp, 4)
+
+	assert.Greater(t, Sharpness(sharp), Sharpness(blurry)*10)
+	assert.Equal(t, 0.0, Sharpness(image.NewGray(image.Rect(0, 0, 50, 50))))
+}
+
+func TestMeasureExposure(t *testing.T) {
+	black := image.NewGray(image.Rect(0, 0, 10, 10))
+	e := MeasureExposure(black)
+	assert.Equal(t, 0.0, e.Mean)
+	assert.Equal(t, 1.0, e.Shadows)
+	assert.Equal(t, 0.0, e.Score())
+
+	mid := checkerboard(10, 10, 1, 100, 156)
+	e = MeasureExposure(mid)
+	assert.InDelta(t, 0.5, e.Mean, 0.01)
+	assert.Equal(t, 0.0, e.Highlights)
+	assert.InDelta(t, 1.0, e.Score(), 0.02)
+
+	assert.Greater(t, MeasureExposure(mid).Score(), MeasureExposure(checkerboard(10, 10, 1, 0, 255)).Score())
+}
+
+func TestGates_Check(t *testing.T) {
+	good := Scores{Width: 4000, Height: 3000, Sharpness: 500, Exposure: Exposure{Mean: 0.5}}
+
+	assert.False(t, Gates{}.Enabled())
+
+	tests := []struct {
+		name   string
+		gates  Gates
+		scores Scores
+		reason string
+	}{
+		{"no gates", Gates{}, Scores{}, ""},
+		{"passes all", Gates{MinSharpness: 100, MinBrightness: 0.1, MaxBrightness: 0.9, MaxClipped: 0.2, MinLong: 1280, MinShort: 800}, good, ""},
+		{"portrait counts as landscape", Gates{MinLong: 1280, MinShort: 800}, Scores{Width: 900, Height: 1300}, ""},
+		{"too small", Gates{MinLong: 1280, MinShort: 800}, Scores{Width: 640, Height: 480}, "low-resolution"},
+		{"blurry", Gates{MinSharpness: 100}, Scores{Sharpness: 12}, "blurry"},
+		{"dark", Gates{MinBrightness: 0.1}, Scores{Exposure: Exposure{Mean: 0.02}}, "dark"},
+		{"bright", Gates{MaxBrightness: 0.9}, Scores{Exposure: Exposure{Mean: 0.97}}, "bright"},
+		{"clipped", Gates{MaxClipped: 0.2}, Scores{Exposure: Exposure{Mean: 0.5, Shadows: 0.15, Highlights: 0.1}}, "clipped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, detail := tt.gates.Check(tt.scores)
+			assert.Equal(t, tt.reason, reason)
+			assert.Equal(t, tt.reason == "", detail == "")
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ReasonUpToDate is the skip reason of files whose output is up to date
+const ReasonUpToDate = "up-to-date"
+
+// Entry is a single file mentioned in the report
+type Entry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Group lists photos that were compared against each other, e.g. duplicates
+type Group struct {
+	Kind     string   `json:"kind"`
+	Kept     string   `json:"kept"`
+	Rejected []string `json:"rejected"`
+}
+
+// Report collects the outcome of a run. It is safe for concurrent use.
+type Report struct {
+	mu        sync.Mutex
+	Processed int     `json:"processed"`
+	UpToDate  int     `json:"up_to_date"` // Skipped as up to date, not listed to keep the report small
+	Skipped   []Entry `json:"skipped,omitempty"`
+	Failed    []Entry `json:"failed,omitempty"`
+	Groups    []Group `json:"groups,omitempty"`
+	// Locations counts processed photos by place, from GPS coordinates
+	Locations map[string]int `json:"locations,omitempty"`
+	// Faces counts the faces found in each photo by face-aware cropping
+	Faces map[string]int `json:"faces,omitempty"`
+}
+
+// New creates an empty report
+func New() *Report {
+	return &Report{}
+}
+
+// AddProcessed counts a successfully processed file
+func (r *Report) AddProcessed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Processed++
+}
+
+// AddUpToDate counts a file skipped because its output is up to date
+func (r *Report) AddUpToDate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.UpToDate++
+}
+
+// AddSkipped records a file that was deliberately not processed
+func (r *Report) AddSkipped(path, reason, detail string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Skipped = append(r.Skipped, Entry{Path: path, Reason: reason, Detail: detail})
+}
+
+// SkippedPaths returns the paths of all skipped files
+func (r *Report) SkippedPaths() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths := make([]string, 0, len(r.Skipped))
+	for _, e := range r.Skipped {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+// AddFailed records a file that could not be processed
+func (r *Report) AddFailed(path string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Failed = append(r.Failed, Entry{Path: path, Reason: "error", Detail: err.Error()})
+}
+
+// AddGroup records a group of related photos
+func (r *Report) AddGroup(g Group) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Groups = append(r.Groups, g)
+}
+
+// AddLocation counts a processed photo taken at place
+func (r *Report) AddLocation(place string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Locations == nil {
+		r.Locations = make(map[string]int)
+	}
+	r.Locations[place]++
+}
+
+// AddFaces records the number of faces found in a photo
+func (r *Report) AddFaces(path string, faces int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Faces == nil {
+		r.Faces = make(map[string]int)
+	}
+	r.Faces[path] = faces
+}
+
+// Log prints a summary of the run
+func (r *Report) Log() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reasons := make(map[string]int)
+	for _, e := range r.Skipped {
+		reasons[e.Reason]++
+	}
+
+	if r.UpToDate > 0 {
+		reasons[ReasonUpToDate] = r.UpToDate
+	}
+
+	event := log.Info().
+		Int("processed", r.Processed).
+		Int("skipped", len(r.Skipped)+r.UpToDate).
+		Int("failed", len(r.Failed))
+	for reason, count := range reasons {
+		event = event.Int("skipped_"+reason, count)
+	}
+	if r.Faces != nil {
+		total, people := 0, 0
+		for _, n := range r.Faces {
+			total += n
+			if n > 0 {
+				people++
+			}
+		}
+		event = event.Int("faces", total).Int("with_people", people)
+	}
+	event.Msg("Run summary")
+
+	for _, g := range r.Groups {
+		log.Info().Str("kind", g.Kind).Str("kept", g.Kept).Strs("rejected", g.Rejected).Msg("Similar photos")
+	}
+}
+
+// WriteFile stores the report as JSON
+func (r *Report) WriteFile(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.Slice(r.Skipped, func(i, j int) bool { return r.Skipped[i].Path < r.Skipped[j].Path })
+	sort.Slice(r.Failed, func(i, j int) bool { return r.Failed[i].Path < r.Failed[j].Path })
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,54 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport_WriteFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "report-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	r := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.AddProcessed()
+		}()
+	}
+	wg.Wait()
+
+	r.AddSkipped("b.jpg", "duplicate", "a.jpg")
+	r.AddUpToDate()
+	r.AddFailed("broken.jpg", errors.New("unexpected EOF"))
+	r.AddGroup(Group{Kind: "duplicate", Kept: "a.jpg", Rejected: []string{"b.jpg"}})
+	r.AddLocation("Rome, Italy")
+	r.AddLocation("Rome, Italy")
+	r.AddFaces("a.jpg", 3)
+
+	path := filepath.Join(tmpDir, "report.json")
+	require.NoError(t, r.WriteFile(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var decoded Report
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, 10, decoded.Processed)
+	assert.Equal(t, 1, decoded.UpToDate)
+	assert.Equal(t, []Entry{{Path: "b.jpg", Reason: "duplicate", Detail: "a.jpg"}}, decoded.Skipped)
+	assert.Equal(t, "unexpected EOF", decoded.Failed[0].Detail)
+	assert.Equal(t, "a.jpg", decoded.Groups[0].Kept)
+	assert.Equal(t, map[string]int{"Rome, Italy": 2}, decoded.Locations)
+	assert.Equal(t, map[string]int{"a.jpg": 3}, decoded.Faces)
+}
@@ -0,0 +1,250 @@
+package selection
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+)
+
+// Mode is a strategy for picking a subset of the library
+type Mode string
+
+const (
+	// ModeAll keeps every file
+	ModeAll Mode = ""
+	// ModeRandom picks Count random files
+	ModeRandom Mode = "random"
+	// ModePerYear picks up to Count random files from each capture year
+	ModePerYear Mode = "per-year"
+	// ModePerFolder picks up to Count random files from each directory
+	ModePerFolder Mode = "per-folder"
+	// ModeOnThisDay picks files taken within Days of today's date in any year
+	ModeOnThisDay Mode = "on-this-day"
+	// ModeRecent picks the Count most recently taken files
+	ModeRecent Mode = "recent"
+)
+
+// DefaultDays is the default window of the "on this day" mode
+const DefaultDays = 3
+
+// Options configures the selection
+type Options struct {
+	Mode  Mode
+	Count int   // Number of files (per group for per-year and per-folder), 0 = no limit for on-this-day
+	Seed  int64 // Seed for random picks, 0 picks a new one on every run
+	Days  int   // Window of the on-this-day mode
+	Now   time.Time
+
+	Workers int // Concurrent metadata readers
+}
+
+// ParseMode validates a selection mode name
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(name); m {
+	case ModeAll, ModeRandom, ModePerYear, ModePerFolder, ModeOnThisDay, ModeRecent:
+		return m, nil
+	}
+	if name == "all" {
+		return ModeAll, nil
+	}
+	return ModeAll, fmt.Errorf("invalid selection mode: %s (expected random, per-year, per-folder, on-this-day or recent)", name)
+}
+
+// Validate checks that the options are complete for the chosen mode
+func (o Options) Validate() error {
+	switch o.Mode {
+	case ModeAll:
+		return nil
+	case ModeOnThisDay:
+		if o.Days < 0 {
+			return fmt.Errorf("selection window can't be negative: %d days", o.Days)
+		}
+		if o.Count < 0 {
+			return fmt.Errorf("selection count can't be negative: %d", o.Count)
+		}
+		return nil
+	}
+	if o.Count <= 0 {
+		return fmt.Errorf("selection mode %s needs a positive count", o.Mode)
+	}
+	return nil
+}
+
+// Set is the outcome of a selection, keyed by source path.
+// It implements discovery.Filter, so the pruner sees the same subset.
+type Set map[string]bool
+
+// Match reports whether the file was selected
+func (s Set) Match(file *discovery.File) bool {
+	return s[file.Path]
+}
+
+// Select picks a subset of files. The result keeps the input order.
+func Select(files []discovery.File, opts Options) Set {
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	log.Info().
+		Str("mode", string(opts.Mode)).
+		Int("count", opts.Count).
+		Int64("seed", opts.Seed).
+		Int("candidates", len(files)).
+		Msg("Selecting files")
+
+	var dates []time.Time
+	if opts.Mode != ModeRandom && opts.Mode != ModePerFolder {
+		dates = captureDates(files, opts.Workers)
+	}
+
+	picked := selectFiles(files, dates, opts)
+	set := make(Set, len(picked))
+	for _, i := range picked {
+		set[files[i].Path] = true
+	}
+	log.Info().Int("selected", len(set)).Msg("Selection completed")
+	return set
+}
+
+// selectFiles returns the indexes of the picked files.
+// dates holds the capture time of each file when the mode needs it.
+func selectFiles(files []discovery.File, dates []time.Time, opts Options) []int {
+	// Sort by path so a seed gives the same result regardless of walk order
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return files[order[a]].Path < files[order[b]].Path })
+
+	rng := rand.New(rand.NewPCG(uint64(opts.Seed), uint64(opts.Seed)>>32))
+
+	var picked []int
+	switch opts.Mode {
+	case ModeAll:
+		picked = order
+	case ModeRandom:
+		picked = sample(rng, order, opts.Count)
+	case ModePerYear:
+		picked = perGroup(rng, order, opts.Count, func(i int) string {
+			if dates[i].IsZero() {
+				return ""
+			}
+			return fmt.Sprint(dates[i].Year())
+		})
+	case ModePerFolder:
+		picked = perGroup(rng, order, opts.Count, func(i int) string {
+			return filepath.Dir(files[i].RelativePath)
+		})
+	case ModeOnThisDay:
+		var matching []int
+		for _, i := range order {
+			if !dates[i].IsZero() && daysApart(dates[i], opts.Now) <= opts.Days {
+				matching = append(matching, i)
+			}
+		}
+		picked = matching
+		if opts.Count > 0 {
+			picked = sample(rng, matching, opts.Count)
+		}
+	case ModeRecent:
+		recent := append([]int(nil), order...)
+		sort.SliceStable(recent, func(a, b int) bool { return dates[recent[a]].After(dates[recent[b]]) })
+		if len(recent) > opts.Count {
+			recent = recent[:opts.Count]
+		}
+		picked = recent
+	}
+
+	sort.Ints(picked)
+	return picked
+}
+
+// sample picks n random indexes, or all of them when there are fewer
+func sample(rng *rand.Rand, idx []int, n int) []int {
+	if len(idx) <= n {
+		return idx
+	}
+	shuffled := append([]int(nil), idx...)
+	rng.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+	return shuffled[:n]
+}
+
+// perGroup picks up to n random indexes from every group
+func perGroup(rng *rand.Rand, idx []int, n int, key func(int) string) []int {
+	groups := make(map[string][]int)
+	var keys []string
+	for _, i := range idx {
+		k := key(i)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+	sort.Strings(keys)
+
+	var picked []int
+	for _, k := range keys {
+		picked = append(picked, sample(rng, groups[k], n)...)
+	}
+	return picked
+}
+
+// daysApart returns the distance in days between the calendar day of t and
+// the calendar day of now, ignoring the year
+func daysApart(t, now time.Time) int {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	best := -1
+	for _, year := range []int{now.Year() - 1, now.Year(), now.Year() + 1} {
+		day := time.Date(year, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		d := int(day.Sub(today).Hours() / 24)
+		if d < 0 {
+			d = -d
+		}
+		if best < 0 || d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// captureDates returns the EXIF capture time of every file,
+// falling back to the modification time
+func captureDates(files []discovery.File, workers int) []time.Time {
+	if workers <= 0 {
+		workers = 1
+	}
+	dates := make([]time.Time, len(files))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				dates[i] = files[i].Metadata().Taken
+				if dates[i].IsZero() {
+					if info, err := os.Stat(files[i].Path); err == nil {
+						dates[i] = info.ModTime()
+					}
+				}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return dates
+}
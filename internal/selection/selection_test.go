@@ -0,0 +1,135 @@
+package selection
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tgagor/frameo-miniatures/internal/discovery"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// library builds files in two folders with one photo per month of 2020-2022
+func library() ([]discovery.File, []time.Time) {
+	var files []discovery.File
+	var dates []time.Time
+	for year := 2020; year <= 2022; year++ {
+		for month := 1; month <= 12; month++ {
+			dir := "home"
+			if month%2 == 0 {
+				dir = "trips"
+			}
+			rel := fmt.Sprintf("%s/%d-%02d.jpg", dir, year, month)
+			files = append(files, discovery.File{Path: "/photos/" + rel, RelativePath: rel})
+			dates = append(dates, time.Date(year, time.Month(month), 15, 12, 0, 0, 0, time.UTC))
+		}
+	}
+	return files, dates
+}
+
+func paths(files []discovery.File, idx []int) []string {
+	var result []string
+	for _, i := range idx {
+		result = append(result, files[i].RelativePath)
+	}
+	return result
+}
+
+func TestParseMode(t *testing.T) {
+	for _, name := range []string{"", "all", "random", "per-year", "per-folder", "on-this-day", "recent"} {
+		_, err := ParseMode(name)
+		assert.NoError(t, err, name)
+	}
+	_, err := ParseMode("newest")
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Options{}.Validate())
+	assert.NoError(t, Options{Mode: ModeOnThisDay, Days: 3}.Validate())
+	assert.Error(t, Options{Mode: ModeRandom}.Validate(), "random needs a count")
+	assert.Error(t, Options{Mode: ModeOnThisDay, Days: -1}.Validate())
+}
+
+func TestSelect_Random(t *testing.T) {
+	files, _ := library()
+
+	first := selectFiles(files, nil, Options{Mode: ModeRandom, Count: 5, Seed: 42})
+	assert.Len(t, first, 5)
+
+	// The same seed gives the same photos, even in a different walk order
+	reversed := make([]discovery.File, len(files))
+	for i := range files {
+		reversed[len(files)-1-i] = files[i]
+	}
+	second := selectFiles(reversed, nil, Options{Mode: ModeRandom, Count: 5, Seed: 42})
+	assert.ElementsMatch(t, paths(files, first), paths(reversed, second))
+
+	other := selectFiles(files, nil, Options{Mode: ModeRandom, Count: 5, Seed: 7})
+	assert.NotEqual(t, paths(files, first), paths(files, other))
+
+	// Asking for more than available returns everything
+	all := selectFiles(files, nil, Options{Mode: ModeRandom, Count: 100, Seed: 1})
+	assert.Len(t, all, len(files))
+}
+
+func TestSelect_PerGroup(t *testing.T) {
+	files, dates := library()
+
+	perYear := selectFiles(files, dates, Options{Mode: ModePerYear, Count: 2, Seed: 1})
+	years := make(map[int]int)
+	for _, i := range perYear {
+		years[dates[i].Year()]++
+	}
+	assert.Equal(t, map[int]int{2020: 2, 2021: 2, 2022: 2}, years)
+
+	perFolder := selectFiles(files, nil, Options{Mode: ModePerFolder, Count: 3, Seed: 1})
+	folders := make(map[string]int)
+	for _, p := range paths(files, perFolder) {
+		folders[p[:4]]++
+	}
+	assert.Equal(t, map[string]int{"home": 3, "trip": 3}, folders)
+}
+
+func TestSelect_OnThisDay(t *testing.T) {
+	files, dates := library()
+
+	picked := selectFiles(files, dates, Options{Mode: ModeOnThisDay, Days: 3, Now: date("2025-03-13")})
+	assert.Equal(t, []string{"home/2020-03.jpg", "home/2021-03.jpg", "home/2022-03.jpg"}, paths(files, picked))
+
+	limited := selectFiles(files, dates, Options{Mode: ModeOnThisDay, Days: 3, Count: 1, Seed: 1, Now: date("2025-03-13")})
+	assert.Len(t, limited, 1)
+
+	none := selectFiles(files, dates, Options{Mode: ModeOnThisDay, Days: 3, Now: date("2025-03-01")})
+	assert.Empty(t, none)
+}
+
+func TestDaysApart(t *testing.T) {
+	assert.Equal(t, 0, daysApart(date("2019-07-04"), date("2025-07-04")))
+	assert.Equal(t, 2, daysApart(date("2019-07-02"), date("2025-07-04")))
+	// Windows wrap around the new year
+	assert.Equal(t, 2, daysApart(date("2019-12-31"), date("2025-01-02")))
+	assert.Equal(t, 2, daysApart(date("2019-01-01"), date("2025-12-30")))
+}
+
+func TestSelect_Recent(t *testing.T) {
+	files, dates := library()
+
+	picked := selectFiles(files, dates, Options{Mode: ModeRecent, Count: 3})
+	assert.ElementsMatch(t, []string{"trips/2022-10.jpg", "home/2022-11.jpg", "trips/2022-12.jpg"}, paths(files, picked))
+}
+
+func TestSet_Match(t *testing.T) {
+	set := Set{"/photos/a.jpg": true}
+	require.True(t, set.Match(&discovery.File{Path: "/photos/a.jpg"}))
+	require.False(t, set.Match(&discovery.File{Path: "/photos/b.jpg"}))
+}
@@ -0,0 +1,117 @@
+package tonemap
+
+import (
+	"fmt"
+	"math"
+)
+
+// Operator selects how light brighter than SDR white is brought into range
+type Operator string
+
+// Supported operators
+const (
+	Reinhard Operator = "reinhard"
+	Hable    Operator = "hable"
+	// GainMap applies the HDR gain map of a photo where present, then
+	// compresses highlights like Reinhard
+	GainMap Operator = "gainmap"
+	// Clip cuts everything above SDR white
+	Clip Operator = "clip"
+)
+
+// SDRWhite is the luminance of SDR reference white in nits (ITU-R BT.2408)
+const SDRWhite = 203.0
+
+// DefaultHeadroom is the brightness of gain map highlights relative to
+// SDR white, used when the photo doesn't say
+const DefaultHeadroom = 4.0
+
+// knee is the linear level up to which tones are left alone. Only
+// highlights above it are compressed, so midtones keep their contrast.
+const knee = 0.75
+
+// Parse validates an operator name, empty means Reinhard
+func Parse(name string) (Operator, error) {
+	switch op := Operator(name); op {
+	case "":
+		return Reinhard, nil
+	case Reinhard, Hable, GainMap, Clip:
+		return op, nil
+	}
+	return "", fmt.Errorf("invalid tone mapping operator: %s (expected reinhard, hable, gainmap or clip)", name)
+}
+
+// Curve returns a function mapping linear light relative to SDR white
+// (1 = SDR white, peak = brightest value in the image) into 0-1
+func (op Operator) Curve(peak float64) func(float64) float64 {
+	if op == Clip || peak <= 1 {
+		return func(v float64) float64 { return math.Min(math.Max(v, 0), 1) }
+	}
+
+	// The shoulder maps knee..peak onto knee..1
+	white := (peak - knee) / (1 - knee)
+	var shoulder func(x float64) float64
+	if op == Hable {
+		norm := hable(white)
+		shoulder = func(x float64) float64 { return hable(x) / norm }
+	} else {
+		shoulder = func(x float64) float64 { return x * (1 + x/(white*white)) / (1 + x) }
+	}
+
+	return func(v float64) float64 {
+		if v <= knee {
+			return math.Max(v, 0)
+		}
+		return math.Min(knee+(1-knee)*shoulder((v-knee)/(1-knee)), 1)
+	}
+}
+
+// hable is John Hable's filmic curve from Uncharted 2
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+// PQ decodes a SMPTE ST 2084 (perceptual quantizer) value into linear
+// light relative to SDR white
+func PQ(v float64) float64 {
+	const (
+		m1 = 2610.0 / 16384
+		m2 = 2523.0 / 4096 * 128
+		c1 = 3424.0 / 4096
+		c2 = 2413.0 / 4096 * 32
+		c3 = 2392.0 / 4096 * 32
+	)
+	p := math.Pow(math.Max(v, 0), 1/m2)
+	nits := 10000 * math.Pow(math.Max(p-c1, 0)/(c2-c3*p), 1/m1)
+	return nits / SDRWhite
+}
+
+// HLG decodes hybrid log-gamma (ARIB STD-B67) values into linear display
+// light relative to SDR white, for a 1000 nit display as in ITU-R BT.2100.
+// The luminance weights are those of the BT.2020 primaries HLG is used with.
+func HLG(r, g, b float64) (float64, float64, float64) {
+	const (
+		a        = 0.17883277
+		bb       = 0.28466892
+		c        = 0.55991073
+		peak     = 1000.0
+		sysGamma = 1.2
+	)
+	scene := func(v float64) float64 {
+		v = math.Max(v, 0)
+		if v <= 0.5 {
+			return v * v / 3
+		}
+		return (math.Exp((v-c)/a) + bb) / 12
+	}
+	r, g, b = scene(r), scene(g), scene(b)
+
+	// The OOTF brightens by scene luminance, keeping hues
+	y := 0.2627*r + 0.6780*g + 0.0593*b
+	if y <= 0 {
+		return 0, 0, 0
+	}
+	scale := peak * math.Pow(y, sysGamma-1) / SDRWhite
+	return r * scale, g * scale, b * scale
+}
@@ -0,0 +1,67 @@
+package tonemap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	op, err := Parse("")
+	require.NoError(t, err)
+	assert.Equal(t, Reinhard, op)
+
+	op, err = Parse("hable")
+	require.NoError(t, err)
+	assert.Equal(t, Hable, op)
+
+	_, err = Parse("aces")
+	assert.Error(t, err)
+}
+
+func TestOperator_Curve(t *testing.T) {
+	for _, op := range []Operator{Reinhard, Hable, GainMap} {
+		t.Run(string(op), func(t *testing.T) {
+			curve := op.Curve(8)
+
+			// Midtones are untouched, highlights compressed into range
+			assert.Equal(t, 0.0, curve(0))
+			assert.Equal(t, 0.5, curve(0.5))
+			assert.InDelta(t, 1.0, curve(8), 0.001)
+			assert.Less(t, curve(1), 1.0)
+			assert.Greater(t, curve(1), 0.75)
+
+			prev := 0.0
+			for v := 0.0; v <= 8; v += 0.05 {
+				assert.GreaterOrEqual(t, curve(v), prev, "must be monotonic at %g", v)
+				prev = curve(v)
+			}
+		})
+	}
+
+	clip := Clip.Curve(8)
+	assert.Equal(t, 1.0, clip(2))
+	assert.Equal(t, 0.9, clip(0.9))
+
+	// Nothing to compress in SDR content
+	assert.Equal(t, 0.9, Reinhard.Curve(1)(0.9))
+}
+
+func TestPQ(t *testing.T) {
+	assert.Equal(t, 0.0, PQ(0))
+	assert.InDelta(t, 10000/SDRWhite, PQ(1), 0.01)
+	// BT.2408 reference white is coded at 58%
+	assert.InDelta(t, 1.0, PQ(0.5807), 0.01)
+}
+
+func TestHLG(t *testing.T) {
+	// BT.2408 reference white is coded at 75%
+	r, g, b := HLG(0.75, 0.75, 0.75)
+	assert.InDelta(t, 1.0, r, 0.03)
+	assert.Equal(t, r, g)
+	assert.Equal(t, r, b)
+
+	r, _, _ = HLG(1, 1, 1)
+	assert.InDelta(t, 1000/SDRWhite, r, 0.01)
+}
@@ -0,0 +1,237 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DirName is the directory in the output that pruned files are moved to.
+// Every prune run gets its own timestamped batch below it.
+const DirName = ".trash"
+
+// DefaultRetention is how long pruned files are kept
+const DefaultRetention = 30 * 24 * time.Hour
+
+// batchLayout names batch directories, sortable and free of characters
+// that FAT32 rejects. Batches started within the same millisecond get a
+// "-2", "-3"... suffix.
+const batchLayout = "20060102-150405.000"
+
+// secondsLayout parses batch names with or without milliseconds, the
+// latter written by earlier versions
+const secondsLayout = "20060102-150405"
+
+// Trash moves files of an output directory into a batch of the trash
+type Trash struct {
+	OutputDir string
+	Batch     string // Name of the batch files are moved to, final once the first file is
+
+	once sync.Once
+	err  error
+}
+
+// Batch is one prune run in the trash
+type Batch struct {
+	Name  string
+	Time  time.Time
+	Files int
+}
+
+// New creates a trash for the output directory, moving files into a new
+// batch named after now
+func New(outputDir string, now time.Time) *Trash {
+	return &Trash{OutputDir: outputDir, Batch: now.Format(batchLayout)}
+}
+
+// Move moves a file, given relative to the output directory, into the
+// batch, keeping its relative path
+func (t *Trash) Move(relPath string) error {
+	t.once.Do(func() { t.err = t.create() })
+	if t.err != nil {
+		return t.err
+	}
+	dest := filepath.Join(t.OutputDir, DirName, t.Batch, relPath)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	return os.Rename(filepath.Join(t.OutputDir, relPath), dest)
+}
+
+// create creates the batch directory. A batch that exists already belongs
+// to another run, so a suffix is added until the name is free.
+func (t *Trash) create() error {
+	root := filepath.Join(t.OutputDir, DirName)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	name := t.Batch
+	for i := 2; ; i++ {
+		err := os.Mkdir(filepath.Join(root, name), 0755)
+		if err == nil {
+			t.Batch = name
+			return nil
+		}
+		if !errors.Is(err, fs.ErrExist) || i > 1000 {
+			return fmt.Errorf("failed to create trash batch: %w", err)
+		}
+		name = fmt.Sprintf("%s-%d", t.Batch, i)
+	}
+}
+
+// parseBatch returns the time a batch was created from its name
+func parseBatch(name string) (time.Time, bool) {
+	stamp := name
+	if i := strings.LastIndexByte(name, '-'); i > len("20060102") {
+		if _, err := strconv.Atoi(name[i+1:]); err != nil {
+			return time.Time{}, false
+		}
+		stamp = name[:i]
+	}
+	at, err := time.ParseInLocation(secondsLayout, stamp, time.Local)
+	return at, err == nil
+}
+
+// IsTrash reports whether a path relative to the output directory is in
+// the trash
+func IsTrash(relPath string) bool {
+	return relPath == DirName || strings.HasPrefix(relPath, DirName+string(filepath.Separator))
+}
+
+// Batches lists the batches in the trash of an output directory, oldest
+// first
+func Batches(outputDir string) ([]Batch, error) {
+	entries, err := os.ReadDir(filepath.Join(outputDir, DirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []Batch
+	for _, e := range entries {
+		at, ok := parseBatch(e.Name())
+		if !e.IsDir() || !ok {
+			continue
+		}
+		b := Batch{Name: e.Name(), Time: at}
+		filepath.WalkDir(filepath.Join(outputDir, DirName, e.Name()), func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				b.Files++
+			}
+			return nil
+		})
+		batches = append(batches, b)
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		a, b := batches[i], batches[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		// Suffixed batches came later, "-10" after "-9"
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) < len(b.Name)
+		}
+		return a.Name < b.Name
+	})
+	return batches, nil
+}
+
+// Purge removes batches older than the retention period and returns how
+// many were removed
+func Purge(outputDir string, retention time.Duration, now time.Time) (int, error) {
+	batches, err := Batches(outputDir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, b := range batches {
+		if now.Sub(b.Time) <= retention {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(outputDir, DirName, b.Name)); err != nil {
+			return removed, err
+		}
+		log.Info().Str("batch", b.Name).Int("files", b.Files).Msg("Emptied trash batch")
+		removed++
+	}
+	return removed, nil
+}
+
+// Restore moves the files of a batch back into the output directory, the
+// latest batch when name is empty. Files that were written again since
+// are left in the trash. It returns the restored files, relative to the
+// output directory.
+func Restore(outputDir, name string) ([]string, error) {
+	if name == "" {
+		batches, err := Batches(outputDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(batches) == 0 {
+			return nil, fmt.Errorf("trash is empty")
+		}
+		name = batches[len(batches)-1].Name
+	}
+	root := filepath.Join(outputDir, DirName, name)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() || filepath.Base(name) != name {
+		return nil, fmt.Errorf("no trash batch %s in %s", name, outputDir)
+	}
+
+	var restored []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(outputDir, relPath)
+		if _, err := os.Stat(dest); err == nil {
+			log.Warn().Str("file", relPath).Msg("Output exists, leaving the trashed copy")
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(path, dest); err != nil {
+			return err
+		}
+		log.Debug().Str("file", relPath).Msg("Restored file")
+		restored = append(restored, relPath)
+		return nil
+	})
+	if err != nil {
+		return restored, err
+	}
+
+	removeEmpty(root)
+	os.Remove(filepath.Dir(root)) // The trash itself, once empty
+	return restored, nil
+}
+
+// removeEmpty removes empty directories below and including dir, deepest
+// first
+func removeEmpty(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			removeEmpty(filepath.Join(dir, e.Name()))
+		}
+	}
+	os.Remove(dir) // Only succeeds when empty
+}
@@ -0,0 +1,110 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrash_MoveAndRestore(t *testing.T) {
+	out := t.TempDir()
+	for _, f := range []string{"a.webp", "sub/b.webp"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(out, f)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(out, f), []byte(f), 0644))
+	}
+
+	first := New(out, time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local))
+	require.NoError(t, first.Move("a.webp"))
+	second := New(out, time.Date(2024, 5, 2, 10, 0, 0, 0, time.Local))
+	require.NoError(t, second.Move("sub/b.webp"))
+	assert.NoFileExists(t, filepath.Join(out, "sub/b.webp"))
+
+	batches, err := Batches(out)
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	assert.Equal(t, "20240501-100000.000", batches[0].Name)
+	assert.Equal(t, 1, batches[1].Files)
+
+	// The latest batch by default
+	restored, err := Restore(out, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("sub", "b.webp")}, restored)
+	assert.FileExists(t, filepath.Join(out, "sub/b.webp"))
+	assert.NoDirExists(t, filepath.Join(out, DirName, "20240502-100000.000"))
+
+	// Outputs written again since are not overwritten
+	require.NoError(t, os.WriteFile(filepath.Join(out, "a.webp"), []byte("new"), 0644))
+	restored, err = Restore(out, "20240501-100000.000")
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+	data, err := os.ReadFile(filepath.Join(out, "a.webp"))
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	_, err = Restore(out, "../sub")
+	assert.Error(t, err)
+}
+
+func TestTrash_UniqueBatches(t *testing.T) {
+	out := t.TempDir()
+	for _, f := range []string{"a.webp", "b.webp", "c.webp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(out, f), []byte(f), 0644))
+	}
+
+	// Batches of earlier versions are named to the second
+	require.NoError(t, os.MkdirAll(filepath.Join(out, DirName, "20240501-100000"), 0755))
+
+	// Runs started at the same moment don't share a batch
+	now := time.Date(2024, 5, 1, 10, 0, 0, 250*int(time.Millisecond), time.Local)
+	first, second := New(out, now), New(out, now)
+	require.NoError(t, first.Move("a.webp"))
+	require.NoError(t, second.Move("b.webp"))
+	require.NoError(t, second.Move("c.webp"))
+	assert.Equal(t, "20240501-100000.250", first.Batch)
+	assert.Equal(t, "20240501-100000.250-2", second.Batch)
+
+	batches, err := Batches(out)
+	require.NoError(t, err)
+	var names []string
+	for _, b := range batches {
+		names = append(names, b.Name)
+	}
+	assert.Equal(t, []string{"20240501-100000", "20240501-100000.250", "20240501-100000.250-2"}, names)
+	assert.True(t, batches[2].Time.Equal(now))
+	assert.Equal(t, 2, batches[2].Files)
+
+	// The latest batch is restored by default
+	restored, err := Restore(out, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.webp", "c.webp"}, restored)
+}
+
+func TestPurge(t *testing.T) {
+	out := t.TempDir()
+	for _, name := range []string{"old.webp", "new.webp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(out, name), []byte(name), 0644))
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	require.NoError(t, New(out, now.Add(-40*24*time.Hour)).Move("old.webp"))
+	require.NoError(t, New(out, now.Add(-2*24*time.Hour)).Move("new.webp"))
+
+	removed, err := Purge(out, DefaultRetention, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	batches, err := Batches(out)
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	assert.Equal(t, 1, batches[0].Files)
+}
+
+func TestIsTrash(t *testing.T) {
+	assert.True(t, IsTrash(".trash"))
+	assert.True(t, IsTrash(filepath.Join(".trash", "20240501-100000.000", "a.webp")))
+	assert.False(t, IsTrash(".trashy/a.webp"))
+	assert.False(t, IsTrash("a.webp"))
+}
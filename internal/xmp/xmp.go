@@ -0,0 +1,368 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Namespaces of the properties written by common photo managers
+const (
+	NSRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	NSXMP       = "http://ns.adobe.com/xap/1.0/"
+	NSDC        = "http://purl.org/dc/elements/1.1/"
+	NSLightroom = "http://ns.adobe.com/lightroom/1.0/"
+	NSDigiKam   = "http://www.digikam.org/ns/1.0/"
+	NSDarktable = "http://darktable.sf.net/"
+	NSCRS       = "http://ns.adobe.com/camera-raw-settings/1.0/"
+	NSTIFF      = "http://ns.adobe.com/tiff/1.0/"
+)
+
+// Packet holds the simple and list properties of an XMP packet
+type Packet struct {
+	props map[xml.Name]string
+	lists map[xml.Name][]string
+}
+
+// Parse reads an XMP packet. Both attribute and element forms of
+// properties are understood, as well as rdf:Bag, rdf:Seq and rdf:Alt lists.
+func Parse(data []byte) (*Packet, error) {
+	p := &Packet{
+		props: make(map[xml.Name]string),
+		lists: make(map[xml.Name][]string),
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+
+	var (
+		stack []xml.Name // Open property elements
+		text  strings.Builder
+		inLi  bool
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xmp: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			text.Reset()
+			if t.Name.Space == NSRDF {
+				if t.Name.Local == "li" {
+					inLi = true
+				}
+				p.addAttrs(t.Attr)
+				continue
+			}
+			stack = append(stack, t.Name)
+			p.addAttrs(t.Attr)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+			if t.Name.Space == NSRDF {
+				if t.Name.Local == "li" && inLi && len(stack) > 0 {
+					name := stack[len(stack)-1]
+					p.lists[name] = append(p.lists[name], value)
+					inLi = false
+				}
+				continue
+			}
+			if len(stack) == 0 {
+				continue
+			}
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if items := p.lists[name]; len(items) > 0 {
+				// rdf:Alt and single item lists also work as simple values
+				if _, ok := p.props[name]; !ok {
+					p.props[name] = items[0]
+				}
+			} else if value != "" {
+				p.props[name] = value
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *Packet) addAttrs(attrs []xml.Attr) {
+	for _, a := range attrs {
+		if a.Name.Space == "xmlns" || a.Name.Space == NSRDF || a.Name.Space == "" || a.Name.Local == "xmlns" {
+			continue
+		}
+		p.props[a.Name] = strings.TrimSpace(a.Value)
+	}
+}
+
+// Get returns a simple property
+func (p *Packet) Get(ns, name string) (string, bool) {
+	v, ok := p.props[xml.Name{Space: ns, Local: name}]
+	return v, ok
+}
+
+// List returns the items of a list property
+func (p *Packet) List(ns, name string) []string {
+	return p.lists[xml.Name{Space: ns, Local: name}]
+}
+
+// Merge copies all properties of other into p, overriding existing ones
+func (p *Packet) Merge(other *Packet) {
+	for k, v := range other.props {
+		p.props[k] = v
+	}
+	for k, v := range other.lists {
+		p.lists[k] = v
+	}
+}
+
+// Rating returns the star rating, 0 for unrated and -1 for rejected photos
+func (p *Packet) Rating() int {
+	v, ok := p.Get(NSXMP, "Rating")
+	if !ok {
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0
+	}
+	return int(f)
+}
+
+// darktable stores colour labels as numbers
+var darktableLabels = []string{"red", "yellow", "green", "blue", "purple"}
+
+// digiKam stores colour labels as numbers, 0 means none
+var digiKamLabels = []string{"", "red", "orange", "yellow", "green", "blue", "magenta", "gray", "black", "white"}
+
+// Label returns the lowercase colour label, empty when unset
+func (p *Packet) Label() string {
+	if v, ok := p.Get(NSXMP, "Label"); ok && v != "" {
+		return strings.ToLower(v)
+	}
+	if items := p.List(NSDarktable, "colorlabels"); len(items) > 0 {
+		if i, err := strconv.Atoi(items[0]); err == nil && i >= 0 && i < len(darktableLabels) {
+			return darktableLabels[i]
+		}
+	}
+	if v, ok := p.Get(NSDigiKam, "ColorLabel"); ok {
+		if i, err := strconv.Atoi(v); err == nil && i >= 0 && i < len(digiKamLabels) {
+			return digiKamLabels[i]
+		}
+	}
+	return ""
+}
+
+// Keywords returns all tags. Hierarchical tags ("People|Family") are
+// included as a whole and by each of their parts.
+func (p *Packet) Keywords() []string {
+	seen := make(map[string]bool)
+	var keywords []string
+	add := func(k string) {
+		k = strings.TrimSpace(k)
+		if k != "" && !seen[strings.ToLower(k)] {
+			seen[strings.ToLower(k)] = true
+			keywords = append(keywords, k)
+		}
+	}
+
+	for _, k := range p.List(NSDC, "subject") {
+		add(k)
+	}
+	hierarchical := append(append([]string(nil), p.List(NSLightroom, "hierarchicalSubject")...), p.List(NSDigiKam, "TagsList")...)
+	for _, k := range hierarchical {
+		add(k)
+		for _, part := range strings.FieldsFunc(k, func(r rune) bool { return r == '|' || r == '/' }) {
+			add(part)
+		}
+	}
+	return keywords
+}
+
+// Pick returns 1 for picked, -1 for rejected and 0 for undecided photos
+func (p *Packet) Pick() int {
+	if v, ok := p.Get(NSDigiKam, "PickLabel"); ok {
+		switch v {
+		case "1":
+			return -1
+		case "3":
+			return 1
+		}
+	}
+	if p.Rating() < 0 {
+		return -1
+	}
+	return 0
+}
+
+// Crop is a non-destructive crop in fractions of the stored image, before
+// EXIF orientation is applied, as written by Lightroom and Camera Raw
+type Crop struct {
+	Left, Top, Right, Bottom float64
+	Angle                    float64 // Straightening in degrees, counter-clockwise
+}
+
+// Crop returns the crop rectangle, if the photo was cropped
+func (p *Packet) Crop() (Crop, bool) {
+	if v, _ := p.Get(NSCRS, "HasCrop"); !strings.EqualFold(v, "true") {
+		return Crop{}, false
+	}
+
+	var c Crop
+	for _, f := range []struct {
+		name string
+		dst  *float64
+	}{
+		{"CropLeft", &c.Left},
+		{"CropTop", &c.Top},
+		{"CropRight", &c.Right},
+		{"CropBottom", &c.Bottom},
+		{"CropAngle", &c.Angle},
+	} {
+		if v, ok := p.Get(NSCRS, f.name); ok {
+			*f.dst, _ = strconv.ParseFloat(v, 64)
+		}
+	}
+
+	if c.Left < 0 || c.Top < 0 || c.Right > 1 || c.Bottom > 1 || c.Left >= c.Right || c.Top >= c.Bottom {
+		return Crop{}, false
+	}
+	if c.Left == 0 && c.Top == 0 && c.Right == 1 && c.Bottom == 1 && c.Angle == 0 {
+		return Crop{}, false
+	}
+	return c, true
+}
+
+// Orientation returns the tiff:Orientation written by a photo manager when
+// the photo was rotated, which takes precedence over the EXIF value
+func (p *Packet) Orientation() (int, bool) {
+	v, ok := p.Get(NSTIFF, "Orientation")
+	if !ok {
+		return 0, false
+	}
+	o, err := strconv.Atoi(v)
+	if err != nil || o < 1 || o > 8 {
+		return 0, false
+	}
+	return o, true
+}
+
+// FindSidecar returns the XMP sidecar of a photo, or an empty string.
+// Both IMG_1234.jpg.xmp (darktable, digiKam) and IMG_1234.xmp (Lightroom)
+// naming schemes are recognized.
+func FindSidecar(path string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, candidate := range []string{path + ".xmp", path + ".XMP", base + ".xmp", base + ".XMP"} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Load reads the embedded XMP packet of a photo and its sidecar. Sidecar
+// properties take precedence. It returns nil when neither exists.
+func Load(path string) (*Packet, string, error) {
+	var packet *Packet
+
+	if data, err := ReadEmbedded(path); err == nil && data != nil {
+		packet, err = Parse(data)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	side, sidecar, err := LoadSidecar(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if side != nil {
+		if packet == nil {
+			packet = side
+		} else {
+			packet.Merge(side)
+		}
+	}
+	return packet, sidecar, nil
+}
+
+// LoadSidecar reads only the XMP sidecar of a photo. Edits such as crops
+// should come from here: exported files often carry the develop settings
+// of their original in the embedded packet, although they are applied already.
+func LoadSidecar(path string) (*Packet, string, error) {
+	sidecar := FindSidecar(path)
+	if sidecar == "" {
+		return nil, "", nil
+	}
+	data, err := os.ReadFile(sidecar)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read sidecar: %w", err)
+	}
+	packet, err := Parse(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid sidecar %s: %w", sidecar, err)
+	}
+	return packet, sidecar, nil
+}
+
+var jpegXMPHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// ReadEmbedded extracts the XMP packet from a JPEG APP1 segment.
+// It returns nil without error when the file has none.
+func ReadEmbedded(path string) ([]byte, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".jpg" && ext != ".jpeg" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var marker [2]byte
+	if _, err := io.ReadFull(f, marker[:]); err != nil || marker != [2]byte{0xFF, 0xD8} {
+		return nil, fmt.Errorf("not a jpeg file")
+	}
+
+	// Walk the header segments until the image data starts
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(f, hdr[:]); err != nil {
+			return nil, nil
+		}
+		if hdr[0] != 0xFF || hdr[1] == 0xDA || hdr[1] == 0xD9 {
+			return nil, nil
+		}
+		size := int(hdr[2])<<8 | int(hdr[3]) - 2
+		if size < 0 {
+			return nil, nil
+		}
+		if hdr[1] != 0xE1 {
+			if _, err := f.Seek(int64(size), io.SeekCurrent); err != nil {
+				return nil, nil
+			}
+			continue
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(f, data); err != nil {
+			return nil, nil
+		}
+		if bytes.HasPrefix(data, jpegXMPHeader) {
+			return data[len(jpegXMPHeader):], nil
+		}
+	}
+}
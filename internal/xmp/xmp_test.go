@@ -0,0 +1,162 @@
+package xmp
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Attribute form, as written by Lightroom and darktable
+const lightroomXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:lr="http://ns.adobe.com/lightroom/1.0/"
+   xmp:Rating="4"
+   xmp:Label="Red">
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>holiday</rdf:li>
+     <rdf:li>beach</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <lr:hierarchicalSubject>
+    <rdf:Bag>
+     <rdf:li>People|Family|Dad</rdf:li>
+    </rdf:Bag>
+   </lr:hierarchicalSubject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+// Element form, as written by digiKam
+const digiKamXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:digiKam="http://www.digikam.org/ns/1.0/">
+   <xmp:Rating>2</xmp:Rating>
+   <digiKam:ColorLabel>4</digiKam:ColorLabel>
+   <digiKam:PickLabel>1</digiKam:PickLabel>
+   <digiKam:TagsList>
+    <rdf:Seq>
+     <rdf:li>Private</rdf:li>
+    </rdf:Seq>
+   </digiKam:TagsList>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestParse_Lightroom(t *testing.T) {
+	p, err := Parse([]byte(lightroomXMP))
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, p.Rating())
+	assert.Equal(t, "red", p.Label())
+	assert.Equal(t, []string{"holiday", "beach", "People|Family|Dad", "People", "Family", "Dad"}, p.Keywords())
+	assert.Equal(t, 0, p.Pick())
+}
+
+func TestParse_DigiKam(t *testing.T) {
+	p, err := Parse([]byte(digiKamXMP))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, p.Rating())
+	assert.Equal(t, "green", p.Label())
+	assert.Equal(t, []string{"Private"}, p.Keywords())
+	assert.Equal(t, -1, p.Pick())
+}
+
+func TestParse_Rejected(t *testing.T) {
+	p, err := Parse([]byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="-1"/></rdf:RDF></x:xmpmeta>`))
+	require.NoError(t, err)
+
+	assert.Equal(t, -1, p.Rating())
+	assert.Equal(t, -1, p.Pick())
+}
+
+func TestLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil))
+
+	// Embed the digiKam packet in an APP1 segment right after SOI
+	payload := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), digiKamXMP...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	data := append([]byte{0xFF, 0xD8}, segment...)
+	data = append(data, payload...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	photo := filepath.Join(tmpDir, "IMG_0001.jpg")
+	require.NoError(t, os.WriteFile(photo, data, 0644))
+
+	embedded, err := ReadEmbedded(photo)
+	require.NoError(t, err)
+	assert.Contains(t, string(embedded), "digiKam:PickLabel")
+
+	p, sidecar, err := Load(photo)
+	require.NoError(t, err)
+	assert.Empty(t, sidecar)
+	assert.Equal(t, 2, p.Rating())
+
+	// Sidecar values override embedded ones, the rest is kept
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "IMG_0001.xmp"), []byte(lightroomXMP), 0644))
+	p, sidecar, err = Load(photo)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, "IMG_0001.xmp"), sidecar)
+	assert.Equal(t, 4, p.Rating())
+	assert.Equal(t, "red", p.Label())
+	assert.Equal(t, -1, p.Pick(), "pick label only comes from the embedded packet")
+}
+
+func TestFindSidecar(t *testing.T) {
+	tmpDir := t.TempDir()
+	photo := filepath.Join(tmpDir, "IMG_0002.jpg")
+	require.NoError(t, os.WriteFile(photo, nil, 0644))
+
+	assert.Empty(t, FindSidecar(photo))
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "IMG_0002.xmp"), nil, 0644))
+	assert.Equal(t, filepath.Join(tmpDir, "IMG_0002.xmp"), FindSidecar(photo))
+
+	// darktable style sidecars win over the shorter name
+	require.NoError(t, os.WriteFile(photo+".xmp", nil, 0644))
+	assert.Equal(t, photo+".xmp", FindSidecar(photo))
+}
+
+func TestPacket_CropAndOrientation(t *testing.T) {
+	p, err := Parse([]byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:crs="http://ns.adobe.com/camera-raw-settings/1.0/" xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+ crs:HasCrop="True" crs:CropTop="0.1" crs:CropLeft="0.2" crs:CropBottom="0.9" crs:CropRight="0.7" crs:CropAngle="-1.5"
+ tiff:Orientation="6"/></rdf:RDF></x:xmpmeta>`))
+	require.NoError(t, err)
+
+	crop, ok := p.Crop()
+	require.True(t, ok)
+	assert.Equal(t, Crop{Left: 0.2, Top: 0.1, Right: 0.7, Bottom: 0.9, Angle: -1.5}, crop)
+
+	o, ok := p.Orientation()
+	require.True(t, ok)
+	assert.Equal(t, 6, o)
+
+	// Crop settings without HasCrop are leftovers of a reset crop
+	p, err = Parse([]byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:crs="http://ns.adobe.com/camera-raw-settings/1.0/"
+ crs:HasCrop="False" crs:CropTop="0.1" crs:CropLeft="0.2" crs:CropBottom="0.9" crs:CropRight="0.7"/></rdf:RDF></x:xmpmeta>`))
+	require.NoError(t, err)
+	_, ok = p.Crop()
+	assert.False(t, ok)
+	_, ok = p.Orientation()
+	assert.False(t, ok)
+}